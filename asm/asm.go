@@ -0,0 +1,483 @@
+// Package asm assembles CHIP-8, SUPER-CHIP and XO-CHIP programs written with the mnemonics
+// used in the interpreter's opcode comments and the disassembler's listings.
+//
+// Each line holds an optional label, an instruction or directive, and an optional comment
+// starting with a semicolon:
+//
+//     loop:   ADD V0, 1           ; count frames
+//             JP loop
+//     SPEED = 3                   ; constant
+//     ship:   SPRITE ..XXXX..     ; one row of pixels, 8 or 16 wide
+//             DB 0x3C, 0b01000010, SPEED + 1
+//             DW ship
+//             INCLUDE "font.asm"
+//
+// Mnemonics, registers and directives are case-insensitive. Values are decimal, 0x hex, 0b
+// binary or 0o octal numbers, labels and constants, combined with + and -.
+package asm
+
+import (
+    "bytes"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// Programs start here unless the Assembler's Origin is changed
+const DefaultOrigin = 0x200
+
+// Problem at a line of source
+type Error struct {
+    File string
+    Line int
+    Msg  string
+}
+
+func (e *Error) Error() string {
+    return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+// Every problem found in a source, in order
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+    lines := make([]string, len(l))
+    for k, e := range l {
+        lines[k] = e.Error()
+    }
+    return strings.Join(lines, "\n")
+}
+
+// Assembled ROM image
+type Program struct {
+    Origin uint16
+    Bytes  []byte
+    Labels map[string]uint16
+    Lines  []SourceLine // Where each instruction came from, ordered by address
+}
+
+// Source line of the instruction at an address
+type SourceLine struct {
+    Addr uint16
+    File string
+    Line int
+}
+
+// Write a symbol file with one "ADDR name" line per label, ordered by address
+func (p *Program) WriteSymbols(w io.Writer) error {
+    names := []string{}
+    for name := range p.Labels {
+        names = append(names, name)
+    }
+    sort.Slice(names, func(i, j int) bool {
+        a, b := p.Labels[names[i]], p.Labels[names[j]]
+        return a < b || a == b && names[i] < names[j]
+    })
+    var buf bytes.Buffer
+    for _, name := range names {
+        fmt.Fprintf(&buf, "%04X %s\n", p.Labels[name], name)
+    }
+    _, err := w.Write(buf.Bytes())
+    return err
+}
+
+// Write a line map with one "ADDR file:line" line per instruction, ordered by address
+func (p *Program) WriteLines(w io.Writer) error {
+    var buf bytes.Buffer
+    for _, line := range p.Lines {
+        fmt.Fprintf(&buf, "%04X %s:%d\n", line.Addr, line.File, line.Line)
+    }
+    _, err := w.Write(buf.Bytes())
+    return err
+}
+
+// Read a symbol file written by WriteSymbols
+func ReadSymbols(r io.Reader) (map[string]uint16, error) {
+    labels := map[string]uint16{}
+    err := readMap(r, func(addr uint16, text string) error {
+        labels[text] = addr
+        return nil
+    })
+    return labels, err
+}
+
+// Read a line map written by WriteLines
+func ReadLines(r io.Reader) ([]SourceLine, error) {
+    var lines []SourceLine
+    err := readMap(r, func(addr uint16, text string) error {
+        i := strings.LastIndexByte(text, ':')
+        if i < 0 {
+            return fmt.Errorf("%q should be file:line", text)
+        }
+        line, err := strconv.Atoi(text[i + 1:])
+        if err != nil {
+            return fmt.Errorf("%q should be file:line", text)
+        }
+        lines = append(lines, SourceLine{Addr: addr, File: text[:i], Line: line})
+        return nil
+    })
+    return lines, err
+}
+
+// Read "ADDR text" lines
+func readMap(r io.Reader, entry func(addr uint16, text string) error) error {
+    data, err := ioutil.ReadAll(r)
+    if err != nil {
+        return err
+    }
+    for k, line := range strings.Split(string(data), "\n") {
+        line = strings.TrimSpace(line)
+        if line == "" {
+            continue
+        }
+        fields := strings.SplitN(line, " ", 2)
+        addr, err := strconv.ParseUint(fields[0], 16, 16)
+        if err == nil && len(fields) == 2 {
+            err = entry(uint16(addr), fields[1])
+        } else if err == nil {
+            err = fmt.Errorf("missing name")
+        }
+        if err != nil {
+            return fmt.Errorf("line %d: %v", k + 1, err)
+        }
+    }
+    return nil
+}
+
+type Assembler struct {
+    Origin   uint16
+    ReadFile func(path string) ([]byte, error) // Reads included files, ioutil.ReadFile by default
+}
+
+func NewAssembler() *Assembler {
+    return &Assembler{Origin: DefaultOrigin, ReadFile: ioutil.ReadFile}
+}
+
+// Assemble the source file at path with the default settings
+func AssembleFile(path string) (*Program, error) {
+    return NewAssembler().AssembleFile(path)
+}
+
+func (a *Assembler) AssembleFile(path string) (*Program, error) {
+    source, err := a.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    return a.Assemble(path, source)
+}
+
+// Assemble source read from the file name, which is used in error messages and to find
+// included files. Returns an ErrorList if the source has problems.
+func (a *Assembler) Assemble(name string, source []byte) (*Program, error) {
+    s := &state{
+        assembler: a,
+        addr:      int(a.Origin),
+        symbols:   map[string]*symbol{},
+        including: map[string]bool{},
+    }
+    s.parse(name, source)
+    if len(s.errors) == 0 {
+        s.emit()
+    }
+    if len(s.errors) > 0 {
+        return nil, s.errors
+    }
+
+    p := &Program{Origin: a.Origin, Bytes: s.output, Labels: map[string]uint16{}, Lines: s.lines}
+    for _, sym := range s.symbols {
+        if sym.label {
+            p.Labels[sym.name] = uint16(sym.value)
+        }
+    }
+    return p, nil
+}
+
+// Label or constant
+type symbol struct {
+    name      string
+    label     bool
+    value     int
+    expr      string // Constant value, evaluated on first use
+    resolved  bool
+    resolving bool
+    pos       position
+}
+
+type position struct {
+    file string
+    line int
+}
+
+// Line that produces bytes
+type statement struct {
+    pos       position
+    directive string    // DB, DW or SPRITE, or empty for instructions
+    args      []string  // Directive arguments
+    form      form
+    operands  []operand
+}
+
+type state struct {
+    assembler  *Assembler
+    addr       int
+    symbols    map[string]*symbol
+    statements []*statement
+    including  map[string]bool
+    output     []byte
+    lines      []SourceLine
+    errors     ErrorList
+}
+
+func (s *state) errorf(pos position, format string, args ...interface{}) {
+    s.errors = append(s.errors, &Error{File: pos.file, Line: pos.line, Msg: fmt.Sprintf(format, args...)})
+}
+
+// First pass: define symbols and lay out statements
+func (s *state) parse(name string, source []byte) {
+    s.including[name] = true
+    defer delete(s.including, name)
+
+    for k, line := range strings.Split(string(source), "\n") {
+        pos := position{file: name, line: k + 1}
+        if i := strings.IndexByte(line, ';'); i >= 0 {
+            line = line[:i]
+        }
+        line = strings.TrimSpace(line)
+
+        // Labels end with a colon and may share a line with a statement
+        if i := strings.IndexByte(line, ':'); i >= 0 && isIdentifier(line[:i]) {
+            s.define(pos, line[:i], &symbol{label: true, value: s.addr, resolved: true})
+            line = strings.TrimSpace(line[i + 1:])
+        }
+        if i := strings.IndexByte(line, '='); i >= 0 {
+            constant := strings.TrimSpace(line[:i])
+            if !isIdentifier(constant) {
+                s.errorf(pos, "bad constant name %q", constant)
+                continue
+            }
+            s.define(pos, constant, &symbol{expr: strings.TrimSpace(line[i + 1:])})
+            continue
+        }
+        if line == "" {
+            continue
+        }
+
+        mnemonic, rest := strings.ToUpper(line), ""
+        if i := strings.IndexAny(line, " \t"); i >= 0 {
+            mnemonic, rest = strings.ToUpper(line[:i]), strings.TrimSpace(line[i + 1:])
+        }
+        var args []string
+        if rest != "" {
+            for _, arg := range strings.Split(rest, ",") {
+                args = append(args, strings.TrimSpace(arg))
+            }
+        }
+
+        st := &statement{pos: pos, directive: mnemonic, args: args}
+        size := 0
+        switch mnemonic {
+        case "INCLUDE":
+            s.include(pos, rest)
+            continue
+        case "DB":
+            size = len(args)
+        case "DW":
+            size = 2 * len(args)
+        case "SPRITE":
+            if len(rest) != 8 && len(rest) != 16 || strings.ContainsAny(rest, " \t") {
+                s.errorf(pos, "sprite rows must be 8 or 16 pixels wide")
+                continue
+            }
+            st.args = []string{rest}
+            size = len(rest) / 8
+        default:
+            st.directive = ""
+            for _, arg := range args {
+                st.operands = append(st.operands, parseOperand(arg))
+            }
+            f, err := lookup(mnemonic, st.operands)
+            if err != nil {
+                s.errorf(pos, "%v", err)
+                continue
+            }
+            st.form = f
+            size = f.size()
+        }
+        if size == 0 {
+            s.errorf(pos, "%s needs at least one value", mnemonic)
+            continue
+        }
+        s.statements = append(s.statements, st)
+        s.addr += size
+        if s.addr > 0x10000 {
+            s.errorf(pos, "program runs past the end of memory")
+            return
+        }
+    }
+}
+
+// Assemble another file in place. Paths are relative to the including file.
+func (s *state) include(pos position, arg string) {
+    path := strings.Trim(arg, `"`)
+    if path == "" {
+        s.errorf(pos, "INCLUDE needs a file name")
+        return
+    }
+    if !filepath.IsAbs(path) {
+        path = filepath.Join(filepath.Dir(pos.file), path)
+    }
+    if s.including[path] {
+        s.errorf(pos, "%s includes itself", path)
+        return
+    }
+    source, err := s.assembler.ReadFile(path)
+    if err != nil {
+        s.errorf(pos, "%v", err)
+        return
+    }
+    s.parse(path, source)
+}
+
+func (s *state) define(pos position, name string, sym *symbol) {
+    key := strings.ToLower(name)
+    if prev, ok := s.symbols[key]; ok {
+        s.errorf(pos, "%s already defined at %s:%d", name, prev.pos.file, prev.pos.line)
+        return
+    }
+    if _, ok := parseRegister(name); ok || fixedOperands[strings.ToUpper(name)] {
+        s.errorf(pos, "%s is a register name", name)
+        return
+    }
+    sym.name, sym.pos = name, pos
+    s.symbols[key] = sym
+}
+
+func isIdentifier(text string) bool {
+    if text == "" {
+        return false
+    }
+    for k, c := range text {
+        letter := c == '_' || c == '.' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+        if !letter && (k == 0 || c < '0' || c > '9') {
+            return false
+        }
+    }
+    return true
+}
+
+// Evaluate terms joined by + and -
+func (s *state) eval(expr string) (int, error) {
+    expr = strings.TrimSpace(expr)
+    if expr == "" {
+        return 0, fmt.Errorf("missing value")
+    }
+    total, sign, start := 0, 1, 0
+    for k := 0; k <= len(expr); k++ {
+        if k < len(expr) && (expr[k] != '+' && expr[k] != '-' || k == start) {
+            continue
+        }
+        term := strings.TrimSpace(expr[start:k])
+        if term == "" {
+            return 0, fmt.Errorf("bad expression %q", expr)
+        }
+        value, err := s.term(term)
+        if err != nil {
+            return 0, err
+        }
+        total += sign * value
+        if k < len(expr) && expr[k] == '-' {
+            sign = -1
+        } else {
+            sign = 1
+        }
+        start = k + 1
+    }
+    return total, nil
+}
+
+func (s *state) term(text string) (int, error) {
+    if text[0] >= '0' && text[0] <= '9' || text[0] == '-' {
+        value, err := strconv.ParseInt(text, 0, 32)
+        if err != nil {
+            return 0, fmt.Errorf("bad number %q", text)
+        }
+        return int(value), nil
+    }
+    sym, ok := s.symbols[strings.ToLower(text)]
+    if !ok {
+        return 0, fmt.Errorf("undefined symbol %s", text)
+    }
+    if !sym.resolved {
+        if sym.resolving {
+            return 0, fmt.Errorf("constant %s depends on itself", text)
+        }
+        sym.resolving = true
+        value, err := s.eval(sym.expr)
+        sym.resolving = false
+        if err != nil {
+            return 0, err
+        }
+        sym.value, sym.resolved = value, true
+    }
+    return sym.value, nil
+}
+
+// Second pass: encode statements now that every symbol is known
+func (s *state) emit() {
+    for _, st := range s.statements {
+        var out []byte
+        var err error
+        switch st.directive {
+        case "":
+            out, err = st.form.encode(st.operands, s.eval)
+        case "DB":
+            // Every bad argument is reported, not just the last
+            for _, arg := range st.args {
+                value, err := s.eval(arg)
+                if err == nil && (value < -128 || value > 0xFF) {
+                    err = fmt.Errorf("byte %d out of range", value)
+                }
+                if err != nil {
+                    s.errorf(st.pos, "%v", err)
+                }
+                out = append(out, byte(value))
+            }
+        case "DW":
+            for _, arg := range st.args {
+                value, err := s.eval(arg)
+                if err == nil && (value < -0x8000 || value > 0xFFFF) {
+                    err = fmt.Errorf("word %d out of range", value)
+                }
+                if err != nil {
+                    s.errorf(st.pos, "%v", err)
+                }
+                out = append(out, byte(value >> 8), byte(value))
+            }
+        case "SPRITE":
+            out = sprite(st.args[0])
+        }
+        if err != nil {
+            s.errorf(st.pos, "%v", err)
+        }
+        if st.directive == "" {
+            addr := uint16(int(s.assembler.Origin) + len(s.output))
+            s.lines = append(s.lines, SourceLine{Addr: addr, File: st.pos.file, Line: st.pos.line})
+        }
+        s.output = append(s.output, out...)
+    }
+}
+
+// Pixels are off for '.' and '0' and on for anything else
+func sprite(row string) []byte {
+    out := make([]byte, len(row) / 8)
+    for k, c := range row {
+        if c != '.' && c != '0' {
+            out[k / 8] |= 0x80 >> uint(k % 8)
+        }
+    }
+    return out
+}
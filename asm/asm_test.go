@@ -0,0 +1,162 @@
+package asm
+
+import (
+    "bytes"
+    "fmt"
+    "github.com/eskrm/chip8/disasm"
+    "github.com/stretchr/testify/assert"
+    "os"
+    "testing"
+)
+
+func assemble(source string) (*Program, error) {
+    return NewAssembler().Assemble("test.asm", []byte(source))
+}
+
+func TestAssembleDisassemblerMnemonics(t *testing.T) {
+    assert := assert.New(t)
+
+    opcodes := []uint16{
+        0x00E0, 0x00EE, 0x00C3, 0x00D4, 0x00FB, 0x00FC, 0x00FD, 0x00FE, 0x00FF,
+        0x1228, 0x2300, 0x3A12, 0x4B34, 0x5120, 0x5342, 0x5343, 0x6A01, 0x7BFF,
+        0x8120, 0x8121, 0x8122, 0x8123, 0x8124, 0x8125, 0x8126, 0x8127, 0x812E, 0x9120,
+        0xA123, 0xB200, 0xC3F0, 0xD125, 0xE49E, 0xE4A1, 0xF301, 0xF002,
+        0xF107, 0xF20A, 0xF315, 0xF418, 0xF51E, 0xF629, 0xF730, 0xF833, 0xF93A,
+        0xFA55, 0xFB65, 0xFC75, 0xFD85,
+    }
+    for _, opcode := range opcodes {
+        in := disasm.Decode([]byte{byte(opcode >> 8), byte(opcode)}, 0)
+        program, err := assemble(in.String())
+        if assert.NoError(err, in.String()) {
+            assert.Equal([]byte{byte(opcode >> 8), byte(opcode)}, program.Bytes, in.String())
+        }
+    }
+
+    program, err := assemble("LD I, long 0x1234")
+    assert.NoError(err)
+    assert.Equal([]byte{0xF0, 0x00, 0x12, 0x34}, program.Bytes)
+}
+
+func TestAssembleAliases(t *testing.T) {
+    assert := assert.New(t)
+
+    program, err := assemble("ld dt, v3\nLD V1, V2\nshr v4\nLD [I], VA\nLD B, V2")
+    assert.NoError(err)
+    assert.Equal([]byte{0xF3, 0x15, 0x81, 0x20, 0x84, 0x46, 0xFA, 0x55, 0xF2, 0x33}, program.Bytes)
+}
+
+func TestAssembleLabelsAndData(t *testing.T) {
+    assert := assert.New(t)
+
+    program, err := assemble(`
+        ROWS = HEIGHT - 1   ; constants may refer forward
+        HEIGHT = 3
+start:  LD I, ship
+        DRW V0, V1, ROWS
+        JP start
+ship:   SPRITE ..XXXX..
+        SPRITE .#....#.
+table:  DB 1, 0b10, -1
+        DW ship + 1
+wide:   SPRITE XXXXXXXX........
+`)
+    assert.NoError(err)
+    assert.Equal([]byte{
+        0xA2, 0x06, 0xD0, 0x12, 0x12, 0x00,
+        0x3C, 0x42,
+        0x01, 0x02, 0xFF,
+        0x02, 0x07,
+        0xFF, 0x00,
+    }, program.Bytes)
+    assert.Equal(map[string]uint16{"start": 0x200, "ship": 0x206, "table": 0x208, "wide": 0x20D},
+                 program.Labels)
+
+    var buf bytes.Buffer
+    assert.NoError(program.WriteSymbols(&buf))
+    assert.Equal("0200 start\n0206 ship\n0208 table\n020D wide\n", buf.String())
+}
+
+func TestAssembleErrors(t *testing.T) {
+    assert := assert.New(t)
+
+    _, err := assemble("CLS\nLD V0, 256\nFOO V1\nJP nowhere\nSE V1, V2, V3\nloop:\nloop:")
+    // Layout problems are reported before encoding problems
+    assert.Equal(ErrorList{
+        {File: "test.asm", Line: 3, Msg: "unknown instruction FOO"},
+        {File: "test.asm", Line: 5, Msg: "bad operands for SE"},
+        {File: "test.asm", Line: 7, Msg: "loop already defined at test.asm:6"},
+    }, err)
+
+    _, err = assemble("LD V0, 256\nJP nowhere\nX = X")
+    assert.EqualError(err, "test.asm:1: byte 256 out of range\ntest.asm:2: undefined symbol nowhere")
+
+    _, err = assemble("LD V0, X\nX = Y\nY = X")
+    assert.EqualError(err, "test.asm:1: constant X depends on itself")
+
+    _, err = assemble("JP V1, 0x200")
+    assert.EqualError(err, "test.asm:1: jump offset register must be V0, not V1")
+
+    // Each bad data argument is reported, wherever it is in the list
+    _, err = assemble("DB 300, 1\nDB nope, 1\nDW 0x1FFFF, 2\nDB 1, 256, -129")
+    assert.EqualError(err, "test.asm:1: byte 300 out of range\ntest.asm:2: undefined symbol nope\n" +
+                           "test.asm:3: word 131071 out of range\ntest.asm:4: byte 256 out of range\n" +
+                           "test.asm:4: byte -129 out of range")
+}
+
+func TestAssembleInclude(t *testing.T) {
+    assert := assert.New(t)
+
+    files := map[string]string{
+        "src/main.asm":     "CALL draw\nINCLUDE \"lib/draw.asm\"",
+        "src/lib/draw.asm": "draw: CLS\nRET\nBAD",
+        "src/loop.asm":     "INCLUDE loop.asm",
+    }
+    assembler := NewAssembler()
+    assembler.ReadFile = func(path string) ([]byte, error) {
+        if source, ok := files[path]; ok {
+            return []byte(source), nil
+        }
+        return nil, fmt.Errorf("open %s: %v", path, os.ErrNotExist)
+    }
+
+    _, err := assembler.AssembleFile("src/main.asm")
+    assert.EqualError(err, "src/lib/draw.asm:3: unknown instruction BAD")
+
+    files["src/lib/draw.asm"] = "draw: CLS\nRET"
+    program, err := assembler.AssembleFile("src/main.asm")
+    assert.NoError(err)
+    assert.Equal([]byte{0x22, 0x02, 0x00, 0xE0, 0x00, 0xEE}, program.Bytes)
+
+    _, err = assembler.AssembleFile("src/loop.asm")
+    assert.EqualError(err, "src/loop.asm:1: src/loop.asm includes itself")
+}
+
+func TestAssembleLines(t *testing.T) {
+    assert := assert.New(t)
+
+    program, err := assemble("start: CLS\n\nDB 1, 2\nLD I, long data\n  JP start\ndata: SPRITE ..XX..XX")
+    assert.NoError(err)
+    assert.Equal([]SourceLine{
+        {Addr: 0x200, File: "test.asm", Line: 1},
+        {Addr: 0x204, File: "test.asm", Line: 4},
+        {Addr: 0x208, File: "test.asm", Line: 5},
+    }, program.Lines)
+
+    var buf bytes.Buffer
+    assert.NoError(program.WriteLines(&buf))
+    assert.Equal("0200 test.asm:1\n0204 test.asm:4\n0208 test.asm:5\n", buf.String())
+    lines, err := ReadLines(&buf)
+    assert.NoError(err)
+    assert.Equal(program.Lines, lines)
+
+    buf.Reset()
+    assert.NoError(program.WriteSymbols(&buf))
+    labels, err := ReadSymbols(&buf)
+    assert.NoError(err)
+    assert.Equal(program.Labels, labels)
+
+    _, err = ReadLines(bytes.NewBufferString("0200 test.asm:1\n0202 test.asm\n"))
+    assert.EqualError(err, "line 2: \"test.asm\" should be file:line")
+    _, err = ReadSymbols(bytes.NewBufferString("start\n"))
+    assert.Error(err)
+}
@@ -0,0 +1,235 @@
+package asm
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+// Kinds of operand, used to pick an instruction form
+const (
+    kindReg   = "V"     // Vx
+    kindRange = "V-V"   // Vx - Vy
+    kindValue = "N"     // Expression
+    kindLong  = "LONG"  // long expression
+)
+
+// Operand names that stand for themselves rather than a value
+var fixedOperands = map[string]bool{
+    "I": true, "[I]": true, "K": true, "DT": true, "ST": true, "F": true, "HF": true, "B": true, "R": true,
+}
+
+type operand struct {
+    kind string
+    x, y uint16 // Registers
+    expr string
+}
+
+func parseRegister(text string) (uint16, bool) {
+    text = strings.ToUpper(strings.TrimSpace(text))
+    if len(text) != 2 || text[0] != 'V' {
+        return 0, false
+    }
+    r, err := strconv.ParseUint(text[1:], 16, 4)
+    return uint16(r), err == nil
+}
+
+func parseOperand(text string) operand {
+    upper := strings.ToUpper(text)
+    if fixedOperands[upper] {
+        return operand{kind: upper}
+    }
+    if r, ok := parseRegister(text); ok {
+        return operand{kind: kindReg, x: r}
+    }
+    if parts := strings.SplitN(text, "-", 2); len(parts) == 2 {
+        x, okx := parseRegister(parts[0])
+        y, oky := parseRegister(parts[1])
+        if okx && oky {
+            return operand{kind: kindRange, x: x, y: y}
+        }
+    }
+    if strings.HasPrefix(upper, "LONG ") {
+        return operand{kind: kindLong, expr: strings.TrimSpace(text[5:])}
+    }
+    return operand{kind: kindValue, expr: text}
+}
+
+// Where an operand goes in the opcode
+type field int
+
+const (
+    fieldNone    field = iota // Fixed operand such as I or DT
+    fieldX                    // Register in bits 8-11
+    fieldY                    // Register in bits 4-7
+    fieldV0                   // Register that must be V0
+    fieldRange                // Registers in bits 8-11 and 4-7
+    fieldXX                   // Register in both bits 8-11 and 4-7
+    fieldByte                 // Value in bits 0-7
+    fieldNibble               // Value in bits 0-3
+    fieldXNibble              // Value in bits 8-11
+    fieldAddr                 // Value in bits 0-11
+    fieldLong                 // Value in the word after the opcode
+)
+
+type form struct {
+    opcode uint16
+    fields []field
+}
+
+// Instruction forms keyed by mnemonic and operand kinds. Besides the mnemonics in the
+// interpreter's opcode comments, the common LD spellings of the transfer instructions are
+// accepted.
+var forms = map[string]form{
+    "CLS":   {0x00E0, nil},
+    "RET":   {0x00EE, nil},
+    "SCR":   {0x00FB, nil},
+    "SCL":   {0x00FC, nil},
+    "EXIT":  {0x00FD, nil},
+    "LOW":   {0x00FE, nil},
+    "HIGH":  {0x00FF, nil},
+    "AUDIO": {0xF002, nil},
+    "SCD N": {0x00C0, []field{fieldNibble}},
+    "SCU N": {0x00D0, []field{fieldNibble}},
+
+    "JP N":      {0x1000, []field{fieldAddr}},
+    "CALL N":    {0x2000, []field{fieldAddr}},
+    "JP V,N":    {0xB000, []field{fieldV0, fieldAddr}},
+    "SE V,N":    {0x3000, []field{fieldX, fieldByte}},
+    "SNE V,N":   {0x4000, []field{fieldX, fieldByte}},
+    "SE V,V":    {0x5000, []field{fieldX, fieldY}},
+    "SNE V,V":   {0x9000, []field{fieldX, fieldY}},
+    "SKP V":     {0xE09E, []field{fieldX}},
+    "SKNP V":    {0xE0A1, []field{fieldX}},
+    "LD V,N":    {0x6000, []field{fieldX, fieldByte}},
+    "ADD V,N":   {0x7000, []field{fieldX, fieldByte}},
+    "RND V,N":   {0xC000, []field{fieldX, fieldByte}},
+    "DRW V,V,N": {0xD000, []field{fieldX, fieldY, fieldNibble}},
+
+    "MV V,V":   {0x8000, []field{fieldX, fieldY}},
+    "LD V,V":   {0x8000, []field{fieldX, fieldY}},
+    "OR V,V":   {0x8001, []field{fieldX, fieldY}},
+    "AND V,V":  {0x8002, []field{fieldX, fieldY}},
+    "XOR V,V":  {0x8003, []field{fieldX, fieldY}},
+    "ADD V,V":  {0x8004, []field{fieldX, fieldY}},
+    "SUB V,V":  {0x8005, []field{fieldX, fieldY}},
+    "SHR V,V":  {0x8006, []field{fieldX, fieldY}},
+    "SUBN V,V": {0x8007, []field{fieldX, fieldY}},
+    "SHL V,V":  {0x800E, []field{fieldX, fieldY}},
+    // Shifting Vx into itself behaves the same with and without the ShiftUsesVy quirk
+    "SHR V": {0x8006, []field{fieldXX}},
+    "SHL V": {0x800E, []field{fieldXX}},
+
+    "LD I,N":      {0xA000, []field{fieldNone, fieldAddr}},
+    "LD I,LONG":   {0xF000, []field{fieldNone, fieldLong}},
+    "ADD I,V":     {0xF01E, []field{fieldNone, fieldX}},
+    "ST [I],V-V":  {0x5002, []field{fieldNone, fieldRange}},
+    "LD V-V,[I]":  {0x5003, []field{fieldRange, fieldNone}},
+    "ST [I],V":    {0xF055, []field{fieldNone, fieldX}},
+    "LD [I],V":    {0xF055, []field{fieldNone, fieldX}},
+    "LD V,[I]":    {0xF065, []field{fieldX, fieldNone}},
+    "PLANE N":     {0xF001, []field{fieldXNibble}},
+    "PITCH V":     {0xF03A, []field{fieldX}},
+    "ST V,DT":     {0xF007, []field{fieldX, fieldNone}},
+    "LD V,DT":     {0xF007, []field{fieldX, fieldNone}},
+    "LD V,K":      {0xF00A, []field{fieldX, fieldNone}},
+    "MV DT,V":     {0xF015, []field{fieldNone, fieldX}},
+    "LD DT,V":     {0xF015, []field{fieldNone, fieldX}},
+    "MV ST,V":     {0xF018, []field{fieldNone, fieldX}},
+    "LD ST,V":     {0xF018, []field{fieldNone, fieldX}},
+    "LD F,V":      {0xF029, []field{fieldNone, fieldX}},
+    "LD HF,V":     {0xF030, []field{fieldNone, fieldX}},
+    "ST B,V":      {0xF033, []field{fieldNone, fieldX}},
+    "LD B,V":      {0xF033, []field{fieldNone, fieldX}},
+    "LD R,V":      {0xF075, []field{fieldNone, fieldX}},
+    "LD V,R":      {0xF085, []field{fieldX, fieldNone}},
+}
+
+// Find the form for a mnemonic and its operands
+func lookup(mnemonic string, operands []operand) (form, error) {
+    kinds := make([]string, len(operands))
+    for k, op := range operands {
+        kinds[k] = op.kind
+    }
+    key := mnemonic
+    if len(kinds) > 0 {
+        key += " " + strings.Join(kinds, ",")
+    }
+    f, ok := forms[key]
+    if !ok {
+        for name := range forms {
+            if strings.SplitN(name, " ", 2)[0] == mnemonic {
+                return form{}, fmt.Errorf("bad operands for %s", mnemonic)
+            }
+        }
+        return form{}, fmt.Errorf("unknown instruction %s", mnemonic)
+    }
+    return f, nil
+}
+
+// Size of the encoded instruction in bytes
+func (f form) size() int {
+    if f.opcode == 0xF000 {
+        return 4
+    }
+    return 2
+}
+
+// Encode the instruction, evaluating operand expressions with eval
+func (f form) encode(operands []operand, eval func(expr string) (int, error)) ([]byte, error) {
+    opcode := f.opcode
+    var long uint16
+    for k, field := range f.fields {
+        op := operands[k]
+        var value int
+        if op.kind == kindValue || op.kind == kindLong {
+            var err error
+            if value, err = eval(op.expr); err != nil {
+                return nil, err
+            }
+        }
+        check := func(name string, min, max int) error {
+            if value < min || value > max {
+                return fmt.Errorf("%s %d out of range", name, value)
+            }
+            return nil
+        }
+        var err error
+        switch field {
+        case fieldX:
+            opcode |= op.x << 8
+        case fieldY:
+            opcode |= op.x << 4
+        case fieldV0:
+            if op.x != 0 {
+                err = fmt.Errorf("jump offset register must be V0, not V%X", op.x)
+            }
+        case fieldRange:
+            opcode |= op.x << 8 | op.y << 4
+        case fieldXX:
+            opcode |= op.x << 8 | op.x << 4
+        case fieldByte:
+            err = check("byte", -128, 0xFF)
+            opcode |= uint16(value) & 0xFF
+        case fieldNibble:
+            err = check("nibble", 0, 0xF)
+            opcode |= uint16(value)
+        case fieldXNibble:
+            err = check("nibble", 0, 0xF)
+            opcode |= uint16(value) << 8
+        case fieldAddr:
+            err = check("address", 0, 0xFFF)
+            opcode |= uint16(value)
+        case fieldLong:
+            err = check("address", 0, 0xFFFF)
+            long = uint16(value)
+        }
+        if err != nil {
+            return nil, err
+        }
+    }
+    if f.size() == 4 {
+        return []byte{byte(opcode >> 8), byte(opcode), byte(long >> 8), byte(long)}, nil
+    }
+    return []byte{byte(opcode >> 8), byte(opcode)}, nil
+}
@@ -0,0 +1,86 @@
+package chip8
+
+import "math"
+
+// Sample rate of generated audio in Hz
+const SampleRate = 44100
+
+// Frequency of the buzzer when no XO-CHIP pattern is loaded
+const buzzerFrequency = 440
+
+// Peak amplitude of generated samples
+const amplitude = 8000
+
+// Audio plays the buzzer while the sound timer is non-zero
+type Audio interface {
+    StartTone(tone *Tone)
+    StopTone()
+    Release()
+}
+
+// Tone is the sound the buzzer makes: a square wave, or an XO-CHIP 1-bit audio pattern
+// played at its pitch. Fill can be called repeatedly to pull a continuous stream of samples.
+type Tone struct {
+    Pattern    [16]byte // Played most significant bit first
+    Pitch      byte
+    HasPattern bool     // Square wave if false
+    phase      float64  // Position within the current cycle, from 0 to 1
+}
+
+// Whether two tones sound the same, ignoring where they are in their cycle
+func (t *Tone) sameSound(other *Tone) bool {
+    if t.HasPattern != other.HasPattern {
+        return false
+    }
+    return !t.HasPattern || t.Pattern == other.Pattern && t.Pitch == other.Pitch
+}
+
+// Playback rate of pattern bits per second
+func (t *Tone) bitRate() float64 {
+    return 4000 * math.Pow(2, (float64(t.Pitch) - 64) / 48)
+}
+
+// Number of samples in one full cycle of the tone
+func (t *Tone) Period(sampleRate int) int {
+    if !t.HasPattern {
+        return sampleRate / buzzerFrequency
+    }
+    return int(math.Ceil(128 * float64(sampleRate) / t.bitRate()))
+}
+
+// Fill samples with the tone, continuing from where the previous call left off
+func (t *Tone) Fill(samples []int16, sampleRate int) {
+    step := float64(buzzerFrequency) / float64(sampleRate)
+    if t.HasPattern {
+        step = t.bitRate() / 128 / float64(sampleRate)
+    }
+    for k := range samples {
+        high := t.phase < 0.5
+        if t.HasPattern {
+            bit := int(t.phase * 128)
+            high = t.Pattern[bit / 8] >> uint(7 - bit % 8) & 0x1 == 1
+        }
+        if high {
+            samples[k] = amplitude
+        } else {
+            samples[k] = -amplitude
+        }
+        t.phase += step
+        t.phase -= math.Floor(t.phase)
+    }
+}
+
+// Audio that discards everything, for headless use
+type NullAudio struct{}
+
+func (NullAudio) StartTone(tone *Tone) {
+    // Noop
+}
+
+func (NullAudio) StopTone() {
+    // Noop
+}
+
+func (NullAudio) Release() {
+    // Noop
+}
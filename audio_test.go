@@ -0,0 +1,96 @@
+package chip8
+
+import (
+    "github.com/stretchr/testify/assert"
+    "testing"
+)
+
+type TestAudio struct {
+    events []string
+    tone   *Tone
+}
+
+func (a *TestAudio) StartTone(tone *Tone) {
+    a.events = append(a.events, "start")
+    a.tone = tone
+}
+
+func (a *TestAudio) StopTone() {
+    a.events = append(a.events, "stop")
+}
+
+func (a *TestAudio) Release() {
+    // Noop
+}
+
+func TestSquareWave(t *testing.T) {
+    assert := assert.New(t)
+
+    tone := &Tone{}
+    samples := make([]int16, tone.Period(SampleRate))
+    tone.Fill(samples, SampleRate)
+
+    assert.Equal(int16(amplitude), samples[0])
+    assert.Equal(int16(-amplitude), samples[len(samples) - 1])
+}
+
+func TestPatternTone(t *testing.T) {
+    assert := assert.New(t)
+
+    // At pitch 64 bits play at 4000 Hz, so each bit lasts just over 11 samples at 44.1 kHz
+    tone := &Tone{Pitch: 64, HasPattern: true}
+    tone.Pattern[0] = 0x80
+    samples := make([]int16, 12)
+    tone.Fill(samples, SampleRate)
+
+    assert.Equal(int16(amplitude), samples[0])
+    assert.Equal(int16(amplitude), samples[11])
+    tone.Fill(samples, SampleRate)
+    assert.Equal(int16(-amplitude), samples[0])
+}
+
+func TestSoundTimerDrivesAudio(t *testing.T) {
+    assert := assert.New(t)
+
+    // LD V0, 2; LD ST, V0; JP 0x204
+    machine, _ := NewMachine([]byte{0x60, 0x02, 0xF0, 0x18, 0x12, 0x04})
+    audio := new(TestAudio)
+    machine.SetAudio(audio)
+
+    assert.NoError(machine.RunFrames(1))
+    assert.Equal([]string{"start"}, audio.events)
+    assert.False(audio.tone.HasPattern)
+
+    assert.NoError(machine.RunFrames(1))
+    assert.Equal([]string{"start"}, audio.events)
+
+    // Sound timer reached zero at the end of the second frame
+    assert.NoError(machine.RunFrames(1))
+    assert.Equal([]string{"start", "stop"}, audio.events)
+}
+
+func TestPitchChangeRestartsTone(t *testing.T) {
+    assert := assert.New(t)
+
+    // LD I, 0x218; AUDIO; LD V0, 30; LD ST, V0; LD V0, 2; LD DT, V0
+    // wait: LD V0, DT; SE V0, 0; JP wait; LD V1, 0x70; PITCH V1; JP 0x216
+    rom := []byte{0xA2, 0x18, 0xF0, 0x02, 0x60, 0x1E, 0xF0, 0x18, 0x60, 0x02, 0xF0, 0x15,
+                  0xF0, 0x07, 0x30, 0x00, 0x12, 0x0C, 0x61, 0x70, 0xF1, 0x3A, 0x12, 0x16}
+    for k := 0; k < 16; k++ {
+        rom = append(rom, 0xAA)
+    }
+    machine, _ := NewXOChipMachine(rom)
+    audio := new(TestAudio)
+    machine.SetAudio(audio)
+
+    assert.NoError(machine.RunFrames(1))
+    assert.Equal([]string{"start"}, audio.events)
+    assert.Equal(byte(64), audio.tone.Pitch)
+
+    // The new pitch is heard while the sound timer is still running
+    assert.NoError(machine.RunFrames(4))
+    assert.Equal([]string{"start", "stop", "start"}, audio.events)
+    assert.True(audio.tone.HasPattern)
+    assert.Equal(byte(0x70), audio.tone.Pitch)
+    assert.True(machine.ST() > 0)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+    "errors"
+    "flag"
+    "github.com/eskrm/chip8/asm"
+    "io"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// chip8 asm [flags] SOURCE
+func assemble(args []string) error {
+    flags := flag.NewFlagSet("asm", flag.ExitOnError)
+    outPath := flags.String("o", "", "the ROM file to write, default SOURCE with a .ch8 extension")
+    symPath := flags.String("sym", "", "also write label addresses to this symbol file")
+    linesPath := flags.String("lines", "", "also write the source line of each instruction to this file, for chip8 dap")
+    origin := flags.String("origin", "200", "the hex address the ROM is loaded at")
+    flags.Parse(args)
+    if flags.NArg() != 1 {
+        return errors.New("usage: chip8 asm [flags] SOURCE")
+    }
+    source := flags.Arg(0)
+
+    assembler := asm.NewAssembler()
+    var err error
+    if assembler.Origin, err = parseAddr(*origin); err != nil {
+        return err
+    }
+    program, err := assembler.AssembleFile(source)
+    if err != nil {
+        return err
+    }
+
+    if *outPath == "" {
+        *outPath = strings.TrimSuffix(source, filepath.Ext(source)) + ".ch8"
+    }
+    if err := ioutil.WriteFile(*outPath, program.Bytes, 0644); err != nil {
+        return err
+    }
+    if *symPath != "" {
+        if err := writeFile(*symPath, program.WriteSymbols); err != nil {
+            return err
+        }
+    }
+    if *linesPath != "" {
+        return writeFile(*linesPath, program.WriteLines)
+    }
+    return nil
+}
+
+func writeFile(path string, write func(w io.Writer) error) error {
+    file, err := os.Create(path)
+    if err != nil {
+        return err
+    }
+    if err := write(file); err != nil {
+        file.Close()
+        return err
+    }
+    return file.Close()
+}
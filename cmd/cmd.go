@@ -1,9 +1,15 @@
 package main
 
 import (
+    "errors"
     "flag"
+    "fmt"
     "github.com/eskrm/chip8"
+    "net"
+    "os"
+    "path/filepath"
     "runtime"
+    "strings"
 )
 
 func init() {
@@ -11,15 +17,211 @@ func init() {
     runtime.LockOSThread()
 }
 
+// Subcommands by name, given as the first argument
+var commands = map[string]func(args []string) error {
+    "asm":    assemble,
+    "dap":    dap,
+    "debug":  debug,
+    "disasm": disassemble,
+    "replay": replay,
+    "run":    runROM,
+    "trace":  renderTrace,
+}
+
 // Command line binary
 func main() {
-    width := flag.Uint("width", 640, "the width of the window in pixels")
-    height := flag.Uint("height", 320, "the height of the window in pixels")
-    romPath := flag.String("rom", "", "the path to a chip8 ROM file")
+    if len(os.Args) > 1 {
+        if command, ok := commands[os.Args[1]]; ok {
+            if err := command(os.Args[2:]); err != nil {
+                fmt.Fprintln(os.Stderr, "chip8:", err)
+                os.Exit(1)
+            }
+            return
+        }
+    }
+
+    options := addRunFlags(flag.CommandLine)
     flag.Parse()
+    if err := options.play(); err != nil {
+        fmt.Fprintln(os.Stderr, "chip8:", err)
+        os.Exit(1)
+    }
+}
+
+// Flags shared by the default command and chip8 run
+type runOptions struct {
+    width, height *uint
+    romPath       *string
+    machine       *machineOptions
+    wavPath       *string
+    moviePath     *string
+    tracePath     *string
+    traceFormat   *string
+    traceFilter   *traceFilterOptions
+    gdbAddr       *string
+    statePath     *string
+    rewindFrames  *int
+    rewindMB      *int
+    terminal      *bool
+    frames        *int
+}
+
+func addRunFlags(flags *flag.FlagSet) *runOptions {
+    return &runOptions{
+        width:        flags.Uint("width", 640, "the width of the window in pixels"),
+        height:       flags.Uint("height", 320, "the height of the window in pixels"),
+        romPath:      flags.String("rom", "", "the path to a chip8 ROM file, or Octo (.8o) or assembly (.asm) source"),
+        machine:      addMachineFlags(flags),
+        wavPath:      flags.String("wav", "", "record the session's audio to a WAV file"),
+        moviePath:    flags.String("movie", "", "record the session's input to a movie file for chip8 replay"),
+        tracePath:    flags.String("trace", "", "write every instruction executed to a trace file"),
+        traceFormat:  flags.String("trace-format", "text", "the trace file format: text, or binary for chip8 trace"),
+        traceFilter:  addTraceFilterFlags(flags),
+        gdbAddr:      flags.String("gdb", "", "wait for GDB to attach over TCP at this address, e.g. localhost:1234"),
+        statePath:    flags.String("state", "", "resume from a save state, restoring its speed, quirks and RND state"),
+        rewindFrames: flags.Int("rewind-frames", chip8.DefaultRewindFrames, "the number of frames that holding backspace can rewind, 0 to disable"),
+        rewindMB:     flags.Int("rewind-mb", chip8.DefaultRewindBytes >> 20, "the memory in MB kept for rewinding"),
+        terminal:     flags.Bool("terminal", false, "draw to the terminal instead of opening a window"),
+        frames:       flags.Int("frames", 0, "run headless for this many frames as fast as possible, then print the screen"),
+    }
+}
+
+// chip8 run [flags] ROM
+func runROM(args []string) error {
+    flags := flag.NewFlagSet("run", flag.ExitOnError)
+    options := addRunFlags(flags)
+    flags.Parse(args)
+    if flags.NArg() != 1 {
+        return errors.New("usage: chip8 run [flags] ROM")
+    }
+    *options.romPath = flags.Arg(0)
+    return options.play()
+}
+
+// Open the window and run the ROM until it ends
+func (o *runOptions) play() error {
+    var window chip8.Window
+    var audio chip8.Audio
+    var err error
+    if *o.frames > 0 {
+        window = chip8.NewHeadlessWindow(nil, *o.frames)
+        audio = chip8.NullAudio{}
+    } else if *o.terminal {
+        window, err = chip8.NewTerminalWindow()
+        audio = chip8.NullAudio{}
+    } else {
+        window, audio, err = newSFML(*o.width, *o.height)
+    }
+    if err != nil {
+        return err
+    }
+
+    err = o.run(window, audio)
+    audio.Release()
+    window.Release()
+    if err != nil {
+        return err
+    }
+    if headless, ok := window.(*chip8.HeadlessWindow); ok {
+        screen := headless.Screen()
+        fmt.Print(screen.String())
+    }
+    return nil
+}
+
+func (o *runOptions) run(window chip8.Window, audio chip8.Audio) error {
+    machine, rom, err := o.machine.load(*o.romPath)
+    if err != nil {
+        return err
+    }
+    if keymapped, ok := window.(chip8.Keymapped); ok {
+        keymap, err := chip8.LoadKeymap(*o.romPath)
+        if err != nil {
+            return err
+        }
+        keymapped.SetKeymap(keymap)
+    }
+    // The driver sees the recorder, which keeps quick saves and rewinding out of movies
+    input := window
+    var movie *chip8.MovieRecorder
+    if *o.moviePath != "" {
+        if *o.statePath != "" {
+            return errors.New("movies start from power on and can't be combined with -state")
+        }
+        movie = chip8.NewMovieRecorder(machine, rom, window)
+        input = movie
+    }
+    driver := chip8.NewMachineDriver(input, machine)
+    machine.SetAudio(audio)
+    // Quick save slots sit next to the ROM
+    driver.SetStateSlots(strings.TrimSuffix(*o.romPath, filepath.Ext(*o.romPath)))
+    driver.SetKeymapFile(chip8.ROMKeymapPath(*o.romPath))
+    if *o.rewindFrames > 0 {
+        driver.SetRewinder(chip8.NewRewinder(machine, *o.rewindFrames, *o.rewindMB << 20))
+    }
+    if *o.statePath != "" {
+        if err := machine.LoadStateFile(*o.statePath); err != nil {
+            return fmt.Errorf("could not load state %s: %v", *o.statePath, err)
+        }
+    }
+
+    if *o.gdbAddr != "" {
+        listener, err := net.Listen("tcp", *o.gdbAddr)
+        if err != nil {
+            return err
+        }
+        defer listener.Close()
+        stub := chip8.NewGDBStub(chip8.NewDebugger(machine))
+        stub.Halt()
+        driver.SetGDBStub(stub)
+        go stub.ServeListener(listener)
+    }
+
+    finishTrace := func() error { return nil }
+    if *o.tracePath != "" {
+        if finishTrace, err = startTrace(machine, *o.tracePath, *o.traceFormat, o.traceFilter); err != nil {
+            return err
+        }
+    }
+
+    err = o.runWAV(driver, window)
+    if traceErr := finishTrace(); traceErr != nil && err == nil {
+        err = fmt.Errorf("could not write trace: %v", traceErr)
+    }
+    // Movies of runs that fault are saved too, they reproduce the fault
+    if movie != nil {
+        if saveErr := movie.Movie().SaveFile(*o.moviePath); saveErr != nil && err == nil {
+            err = saveErr
+        }
+    }
+    return err
+}
+
+func (o *runOptions) runWAV(driver *chip8.Driver, window chip8.Window) error {
+    if *o.wavPath != "" {
+        file, err := os.Create(*o.wavPath)
+        if err != nil {
+            return err
+        }
+        defer file.Close()
+        recorder, err := chip8.NewWAVRecorder(file)
+        if err != nil {
+            return err
+        }
+        driver.Machine().SetRecorder(recorder)
+        if err := runDriver(driver, window); err != nil {
+            recorder.Close()
+            return err
+        }
+        return recorder.Close()
+    }
+    return runDriver(driver, window)
+}
 
-    window := chip8.NewSFMLWindow(*width, *height)
-    defer window.Release()
-    driver := chip8.NewDriver(window, *romPath)
-    driver.Run()
+// Headless runs don't wait for real time
+func runDriver(driver *chip8.Driver, window chip8.Window) error {
+    if _, ok := window.(*chip8.HeadlessWindow); ok {
+        return driver.RunFast()
+    }
+    return driver.Run()
 }
@@ -0,0 +1,757 @@
+package main
+
+import (
+    "bufio"
+    "encoding/json"
+    "errors"
+    "flag"
+    "fmt"
+    "github.com/eskrm/chip8"
+    "github.com/eskrm/chip8/asm"
+    "github.com/eskrm/chip8/octo"
+    "io"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// The only thread reported to clients
+const dapThread = 1
+
+// Variables reference of the registers scope
+const dapRegisters = 1
+
+// chip8 dap [flags]
+//
+// Serves the Debug Adapter Protocol over stdin and stdout. The launch request's program
+// is a ROM, or Octo or assembly source. Assembly sources can be debugged by line, and so
+// can ROMs assembled with -sym and -lines when NAME.sym and NAME.lines sit next to them.
+func dap(args []string) error {
+    flags := flag.NewFlagSet("dap", flag.ExitOnError)
+    options := addMachineFlags(flags)
+    flags.Parse(args)
+    if flags.NArg() != 0 {
+        return errors.New("usage: chip8 dap [flags]")
+    }
+    return newDAPServer(options, os.Stdout).serve(os.Stdin)
+}
+
+// Request, response or event. Only the fields of requests are read.
+type dapMessage struct {
+    Seq       int             `json:"seq"`
+    Type      string          `json:"type"`
+    Command   string          `json:"command"`
+    Arguments json.RawMessage `json:"arguments"`
+}
+
+type dapResponse struct {
+    Seq        int         `json:"seq"`
+    Type       string      `json:"type"`
+    RequestSeq int         `json:"request_seq"`
+    Success    bool        `json:"success"`
+    Command    string      `json:"command"`
+    Message    string      `json:"message,omitempty"`
+    Body       interface{} `json:"body,omitempty"`
+}
+
+type dapEvent struct {
+    Seq   int         `json:"seq"`
+    Type  string      `json:"type"`
+    Event string      `json:"event"`
+    Body  interface{} `json:"body,omitempty"`
+}
+
+type dapSource struct {
+    Name string `json:"name,omitempty"`
+    Path string `json:"path,omitempty"`
+}
+
+type dapBreakpoint struct {
+    Verified             bool       `json:"verified"`
+    Message              string     `json:"message,omitempty"`
+    Source               *dapSource `json:"source,omitempty"`
+    Line                 int        `json:"line,omitempty"`
+    InstructionReference string     `json:"instructionReference,omitempty"`
+}
+
+type dapStackFrame struct {
+    ID                          int        `json:"id"`
+    Name                        string     `json:"name"`
+    Source                      *dapSource `json:"source,omitempty"`
+    Line                        int        `json:"line"`
+    Column                      int        `json:"column"`
+    InstructionPointerReference string     `json:"instructionPointerReference"`
+}
+
+type dapVariable struct {
+    Name               string `json:"name"`
+    Value              string `json:"value"`
+    VariablesReference int    `json:"variablesReference"`
+}
+
+// Read a message framed by a Content-Length header
+func readDAP(r *bufio.Reader) (*dapMessage, error) {
+    length := -1
+    for {
+        line, err := r.ReadString('\n')
+        if err != nil {
+            return nil, err
+        }
+        line = strings.TrimSpace(line)
+        if line == "" {
+            break
+        }
+        if i := strings.IndexByte(line, ':'); i >= 0 && strings.EqualFold(line[:i], "Content-Length") {
+            if length, err = strconv.Atoi(strings.TrimSpace(line[i + 1:])); err != nil {
+                return nil, fmt.Errorf("bad header %q", line)
+            }
+        }
+    }
+    if length < 0 {
+        return nil, errors.New("message has no Content-Length")
+    }
+    body := make([]byte, length)
+    if _, err := io.ReadFull(r, body); err != nil {
+        return nil, err
+    }
+    message := new(dapMessage)
+    if err := json.Unmarshal(body, message); err != nil {
+        return nil, fmt.Errorf("bad message: %v", err)
+    }
+    return message, nil
+}
+
+// Message or read error from the client
+type dapInput struct {
+    message *dapMessage
+    err     error
+}
+
+// Read messages from the client until reading fails or quit is closed
+func readDAPMessages(r io.Reader, input chan<- dapInput, quit <-chan struct{}) {
+    br := bufio.NewReader(r)
+    for {
+        message, err := readDAP(br)
+        select {
+        case input <- dapInput{message: message, err: err}:
+        case <-quit:
+            return
+        }
+        if err != nil {
+            return
+        }
+    }
+}
+
+// Source lines and labels of the program being debugged
+type debugInfo struct {
+    labels map[string]uint16
+    lines  []asm.SourceLine // Ordered by address, with absolute paths
+}
+
+// Read a ROM image and whatever debug information can be found for it
+func loadDebugROM(path string) ([]byte, *debugInfo, error) {
+    path, err := filepath.Abs(path)
+    if err != nil {
+        return nil, nil, err
+    }
+    switch strings.ToLower(filepath.Ext(path)) {
+    case ".8o":
+        program, err := octo.CompileFile(path)
+        if err != nil {
+            return nil, nil, err
+        }
+        return program.Bytes, &debugInfo{labels: program.Labels}, nil
+    case ".asm":
+        // Included files are found relative to the including file, so every path is
+        // absolute
+        program, err := asm.AssembleFile(path)
+        if err != nil {
+            return nil, nil, err
+        }
+        return program.Bytes, &debugInfo{labels: program.Labels, lines: program.Lines}, nil
+    }
+
+    rom, err := ioutil.ReadFile(path)
+    if err != nil {
+        return nil, nil, err
+    }
+    info := &debugInfo{labels: map[string]uint16{}}
+    base := strings.TrimSuffix(path, filepath.Ext(path))
+    if file, err := os.Open(base + ".sym"); err == nil {
+        info.labels, err = asm.ReadSymbols(file)
+        file.Close()
+        if err != nil {
+            return nil, nil, fmt.Errorf("could not read %s.sym: %v", base, err)
+        }
+    }
+    if file, err := os.Open(base + ".lines"); err == nil {
+        info.lines, err = asm.ReadLines(file)
+        file.Close()
+        if err != nil {
+            return nil, nil, fmt.Errorf("could not read %s.lines: %v", base, err)
+        }
+        // Relative paths are taken to be relative to where the ROM was assembled, next
+        // to the line map
+        for k, line := range info.lines {
+            if !filepath.IsAbs(line.File) {
+                info.lines[k].File = filepath.Join(filepath.Dir(path), line.File)
+            }
+        }
+    }
+    return rom, info, nil
+}
+
+// Source line of the instruction at addr, if there is one
+func (info *debugInfo) lineAt(addr uint16) (asm.SourceLine, bool) {
+    k := sort.Search(len(info.lines), func(k int) bool {
+        return info.lines[k].Addr >= addr
+    })
+    if k < len(info.lines) && info.lines[k].Addr == addr {
+        return info.lines[k], true
+    }
+    return asm.SourceLine{}, false
+}
+
+// First instruction on or after a line of a file. Breakpoints on blank lines, comments and
+// labels move down to the next instruction, as in other debuggers.
+func (info *debugInfo) addrOf(path string, line int) (asm.SourceLine, bool) {
+    var best asm.SourceLine
+    found := false
+    for _, l := range info.lines {
+        if l.File == path && l.Line >= line && (!found || l.Line < best.Line) {
+            best, found = l, true
+        }
+    }
+    return best, found
+}
+
+// Name of the code at addr, relative to the nearest label before it
+func (info *debugInfo) name(addr uint16) string {
+    name, start := "", uint16(0)
+    for label, labelAddr := range info.labels {
+        if labelAddr <= addr && (name == "" || labelAddr > start || labelAddr == start && label < name) {
+            name, start = label, labelAddr
+        }
+    }
+    if name == "" {
+        return fmt.Sprintf("%03X", addr)
+    }
+    if addr > start {
+        return fmt.Sprintf("%s+%d", name, addr - start)
+    }
+    return name
+}
+
+func (info *debugInfo) source(line asm.SourceLine) *dapSource {
+    return &dapSource{Name: filepath.Base(line.File), Path: line.File}
+}
+
+// Breakpoint as set by the client
+type dapBreakpointSpec struct {
+    addr      uint16
+    condition *chip8.Condition
+}
+
+// Debug adapter for one session. Only the goroutine running serve writes to the client.
+type dapServer struct {
+    options  *machineOptions
+    w        io.Writer
+    seq      int
+    info     *debugInfo
+    debugger *chip8.Debugger
+
+    // Breakpoints by how they were set. Each request replaces one of these lists, then
+    // they're combined into the debugger's breakpoints.
+    sourceBreakpoints      map[string][]dapBreakpointSpec
+    functionBreakpoints    []dapBreakpointSpec
+    instructionBreakpoints []dapBreakpointSpec
+
+    stopOnEntry bool
+    running     bool
+    resume      bool        // Whether the next frame leaves a stop
+    step        func() bool // Ends the step being run, or nil when continuing
+    followUp    func()      // Events to send once the response to a request is out
+    exited      bool
+    done        bool
+}
+
+func newDAPServer(options *machineOptions, w io.Writer) *dapServer {
+    return &dapServer{options: options, w: w, sourceBreakpoints: map[string][]dapBreakpointSpec{}}
+}
+
+// Answer requests until the client disconnects. While the program runs, requests are
+// checked between frames so that pausing stays responsive.
+func (s *dapServer) serve(r io.Reader) error {
+    input := make(chan dapInput)
+    quit := make(chan struct{})
+    defer close(quit)
+    go readDAPMessages(r, input, quit)
+
+    for !s.done {
+        var in dapInput
+        if s.running {
+            select {
+            case in = <-input:
+            default:
+                s.runFrame()
+                continue
+            }
+        } else {
+            in = <-input
+        }
+        if in.err == io.EOF {
+            return nil
+        } else if in.err != nil {
+            return in.err
+        }
+        if in.message.Type == "request" {
+            s.handle(in.message)
+        }
+    }
+    return nil
+}
+
+func (s *dapServer) send(message interface{}) {
+    body, _ := json.Marshal(message)
+    fmt.Fprintf(s.w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func (s *dapServer) respond(request *dapMessage, body interface{}, err error) {
+    s.seq++
+    response := &dapResponse{Seq: s.seq, Type: "response", RequestSeq: request.Seq, Success: err == nil, Command: request.Command, Body: body}
+    if err != nil {
+        response.Message = err.Error()
+    }
+    s.send(response)
+}
+
+func (s *dapServer) event(event string, body interface{}) {
+    s.seq++
+    s.send(&dapEvent{Seq: s.seq, Type: "event", Event: event, Body: body})
+}
+
+func (s *dapServer) stopped(reason, text string) {
+    s.running, s.step = false, nil
+    s.event("stopped", map[string]interface{}{
+        "reason": reason, "threadId": dapThread, "allThreadsStopped": true, "text": text,
+    })
+}
+
+func (s *dapServer) exit() {
+    s.running, s.exited = false, true
+    s.event("exited", map[string]int{"exitCode": 0})
+    s.event("terminated", nil)
+}
+
+func (s *dapServer) handle(request *dapMessage) {
+    handlers := map[string]func(args json.RawMessage) (interface{}, error) {
+        "initialize":                s.initialize,
+        "launch":                    s.launch,
+        "setBreakpoints":            s.setBreakpoints,
+        "setFunctionBreakpoints":    s.setFunctionBreakpoints,
+        "setInstructionBreakpoints": s.setInstructionBreakpoints,
+        "setExceptionBreakpoints":   s.noBreakpoints,
+        "configurationDone":         s.configurationDone,
+        "threads":                   s.threads,
+        "stackTrace":                s.stackTrace,
+        "scopes":                    s.scopes,
+        "variables":                 s.variables,
+        "continue":                  s.continueRequest,
+        "next":                      s.next,
+        "stepIn":                    s.stepIn,
+        "stepOut":                   s.stepOut,
+        "pause":                     s.pause,
+        "terminate":                 s.terminate,
+        "disconnect":                s.disconnect,
+    }
+    handler, ok := handlers[request.Command]
+    if !ok {
+        s.respond(request, nil, fmt.Errorf("unsupported request %q", request.Command))
+        return
+    }
+    // Requests other than these need a launched program
+    switch request.Command {
+    case "initialize", "launch", "disconnect", "setExceptionBreakpoints", "threads":
+    default:
+        if s.debugger == nil {
+            s.respond(request, nil, errors.New("no program launched"))
+            return
+        }
+    }
+    s.followUp = nil
+    body, err := handler(request.Arguments)
+    s.respond(request, body, err)
+    if err == nil && s.followUp != nil {
+        s.followUp()
+    }
+}
+
+func (s *dapServer) initialize(args json.RawMessage) (interface{}, error) {
+    s.followUp = func() { s.event("initialized", nil) }
+    return map[string]bool{
+        "supportsConfigurationDoneRequest": true,
+        "supportsFunctionBreakpoints":      true,
+        "supportsConditionalBreakpoints":   true,
+        "supportsInstructionBreakpoints":   true,
+        "supportsTerminateRequest":         true,
+    }, nil
+}
+
+func (s *dapServer) launch(args json.RawMessage) (interface{}, error) {
+    var launch struct {
+        Program     string `json:"program"`
+        StopOnEntry bool   `json:"stopOnEntry"`
+    }
+    if err := json.Unmarshal(args, &launch); err != nil {
+        return nil, err
+    }
+    if s.debugger != nil {
+        return nil, errors.New("a program is already launched")
+    }
+    if launch.Program == "" {
+        return nil, errors.New("launch needs a program")
+    }
+    rom, info, err := loadDebugROM(launch.Program)
+    if err != nil {
+        return nil, &chip8.ROMError{Path: launch.Program, Err: err}
+    }
+    machine, err := s.options.newMachine(launch.Program, rom)
+    if err != nil {
+        return nil, err
+    }
+    s.info, s.debugger, s.stopOnEntry = info, chip8.NewDebugger(machine), launch.StopOnEntry
+    return nil, nil
+}
+
+// Breakpoint condition in the debugger's syntax, such as "V3 == 0x10"
+func parseDAPCondition(text string) (*chip8.Condition, error) {
+    if text == "" {
+        return nil, nil
+    }
+    return chip8.ParseCondition(text)
+}
+
+func (s *dapServer) setBreakpoints(args json.RawMessage) (interface{}, error) {
+    var request struct {
+        Source      dapSource `json:"source"`
+        Breakpoints []struct {
+            Line      int    `json:"line"`
+            Condition string `json:"condition"`
+        } `json:"breakpoints"`
+    }
+    if err := json.Unmarshal(args, &request); err != nil {
+        return nil, err
+    }
+    path, err := filepath.Abs(request.Source.Path)
+    if err != nil {
+        return nil, err
+    }
+    var specs []dapBreakpointSpec
+    breakpoints := []dapBreakpoint{}
+    for _, b := range request.Breakpoints {
+        result := dapBreakpoint{Line: b.Line}
+        line, ok := s.info.addrOf(path, b.Line)
+        condition, err := parseDAPCondition(b.Condition)
+        switch {
+        case err != nil:
+            result.Message = err.Error()
+        case !ok:
+            result.Message = "no instructions at or after this line"
+        default:
+            specs = append(specs, dapBreakpointSpec{addr: line.Addr, condition: condition})
+            result = dapBreakpoint{
+                Verified: true, Source: s.info.source(line), Line: line.Line,
+                InstructionReference: fmt.Sprintf("0x%03X", line.Addr),
+            }
+        }
+        breakpoints = append(breakpoints, result)
+    }
+    s.sourceBreakpoints[path] = specs
+    s.syncBreakpoints()
+    return map[string]interface{}{"breakpoints": breakpoints}, nil
+}
+
+// Function breakpoints name a label or a hex address
+func (s *dapServer) setFunctionBreakpoints(args json.RawMessage) (interface{}, error) {
+    var request struct {
+        Breakpoints []struct {
+            Name      string `json:"name"`
+            Condition string `json:"condition"`
+        } `json:"breakpoints"`
+    }
+    if err := json.Unmarshal(args, &request); err != nil {
+        return nil, err
+    }
+    var specs []dapBreakpointSpec
+    breakpoints := []dapBreakpoint{}
+    for _, b := range request.Breakpoints {
+        addr, ok := s.info.labels[b.Name]
+        var err error
+        if !ok {
+            addr, err = parseAddr(b.Name)
+        }
+        var condition *chip8.Condition
+        if err == nil {
+            condition, err = parseDAPCondition(b.Condition)
+        }
+        if err != nil {
+            breakpoints = append(breakpoints, dapBreakpoint{Message: err.Error()})
+            continue
+        }
+        specs = append(specs, dapBreakpointSpec{addr: addr, condition: condition})
+        breakpoints = append(breakpoints, s.verified(addr))
+    }
+    s.functionBreakpoints = specs
+    s.syncBreakpoints()
+    return map[string]interface{}{"breakpoints": breakpoints}, nil
+}
+
+func (s *dapServer) setInstructionBreakpoints(args json.RawMessage) (interface{}, error) {
+    var request struct {
+        Breakpoints []struct {
+            InstructionReference string `json:"instructionReference"`
+            Offset               int    `json:"offset"`
+            Condition            string `json:"condition"`
+        } `json:"breakpoints"`
+    }
+    if err := json.Unmarshal(args, &request); err != nil {
+        return nil, err
+    }
+    var specs []dapBreakpointSpec
+    breakpoints := []dapBreakpoint{}
+    for _, b := range request.Breakpoints {
+        ref, err := strconv.ParseUint(b.InstructionReference, 0, 16)
+        addr := int(ref) + b.Offset
+        if err != nil || addr < 0 || addr > 0xFFFF {
+            err = fmt.Errorf("bad instruction reference %q", b.InstructionReference)
+        }
+        var condition *chip8.Condition
+        if err == nil {
+            condition, err = parseDAPCondition(b.Condition)
+        }
+        if err != nil {
+            breakpoints = append(breakpoints, dapBreakpoint{Message: err.Error()})
+            continue
+        }
+        specs = append(specs, dapBreakpointSpec{addr: uint16(addr), condition: condition})
+        breakpoints = append(breakpoints, s.verified(uint16(addr)))
+    }
+    s.instructionBreakpoints = specs
+    s.syncBreakpoints()
+    return map[string]interface{}{"breakpoints": breakpoints}, nil
+}
+
+// Exceptions always stop execution, so there are no filters to set
+func (s *dapServer) noBreakpoints(args json.RawMessage) (interface{}, error) {
+    return nil, nil
+}
+
+func (s *dapServer) verified(addr uint16) dapBreakpoint {
+    b := dapBreakpoint{Verified: true, InstructionReference: fmt.Sprintf("0x%03X", addr)}
+    if line, ok := s.info.lineAt(addr); ok {
+        b.Source, b.Line = s.info.source(line), line.Line
+    }
+    return b
+}
+
+// Replace the debugger's breakpoints with those from every request
+func (s *dapServer) syncBreakpoints() {
+    for _, b := range s.debugger.Breakpoints() {
+        s.debugger.ClearBreakpoint(b.Addr)
+    }
+    lists := [][]dapBreakpointSpec{s.functionBreakpoints, s.instructionBreakpoints}
+    for _, specs := range s.sourceBreakpoints {
+        lists = append(lists, specs)
+    }
+    for _, specs := range lists {
+        for _, spec := range specs {
+            s.debugger.SetBreakpoint(spec.addr, spec.condition)
+        }
+    }
+}
+
+func (s *dapServer) configurationDone(args json.RawMessage) (interface{}, error) {
+    if s.stopOnEntry {
+        s.followUp = func() { s.stopped("entry", "") }
+    } else {
+        s.running, s.resume = true, false
+    }
+    return nil, nil
+}
+
+func (s *dapServer) threads(args json.RawMessage) (interface{}, error) {
+    return map[string]interface{}{
+        "threads": []map[string]interface{}{{"id": dapThread, "name": "CHIP-8"}},
+    }, nil
+}
+
+// The current instruction, then the CALL of each subroutine on the stack, innermost first.
+// The stack holds return addresses, each just after its CALL.
+func (s *dapServer) stackTrace(args json.RawMessage) (interface{}, error) {
+    machine := s.debugger.Machine()
+    stack := machine.Stack()
+    addrs := []uint16{machine.PC()}
+    for k := int(machine.SP()) - 1; k >= 0; k-- {
+        // A wrapped stack keeps its deeper entries in memory, where they may be overwritten
+        if k < len(stack) {
+            addrs = append(addrs, stack[k] - 2)
+        }
+    }
+    frames := make([]dapStackFrame, len(addrs))
+    for k, addr := range addrs {
+        frames[k] = dapStackFrame{
+            ID: k, Name: s.info.name(addr), Column: 1,
+            InstructionPointerReference: fmt.Sprintf("0x%03X", addr),
+        }
+        if line, ok := s.info.lineAt(addr); ok {
+            frames[k].Source, frames[k].Line = s.info.source(line), line.Line
+        }
+    }
+    return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}, nil
+}
+
+// Registers are shared by every frame
+func (s *dapServer) scopes(args json.RawMessage) (interface{}, error) {
+    return map[string]interface{}{
+        "scopes": []map[string]interface{}{
+            {"name": "Registers", "presentationHint": "registers", "variablesReference": dapRegisters, "expensive": false},
+        },
+    }, nil
+}
+
+func (s *dapServer) variables(args json.RawMessage) (interface{}, error) {
+    var request struct {
+        VariablesReference int `json:"variablesReference"`
+    }
+    if err := json.Unmarshal(args, &request); err != nil {
+        return nil, err
+    }
+    variables := []dapVariable{}
+    if request.VariablesReference == dapRegisters {
+        machine := s.debugger.Machine()
+        for k, v := range machine.V() {
+            variables = append(variables, dapVariable{Name: fmt.Sprintf("V%X", k), Value: fmt.Sprintf("0x%02X", v)})
+        }
+        variables = append(variables,
+            dapVariable{Name: "I", Value: fmt.Sprintf("0x%04X", machine.I())},
+            dapVariable{Name: "PC", Value: fmt.Sprintf("0x%03X", machine.PC())},
+            dapVariable{Name: "SP", Value: fmt.Sprintf("%d", machine.SP())},
+            dapVariable{Name: "DT", Value: fmt.Sprintf("0x%02X", machine.DT())},
+            dapVariable{Name: "ST", Value: fmt.Sprintf("0x%02X", machine.ST())},
+        )
+    }
+    return map[string]interface{}{"variables": variables}, nil
+}
+
+func (s *dapServer) continueRequest(args json.RawMessage) (interface{}, error) {
+    if err := s.resumable(); err != nil {
+        return nil, err
+    }
+    s.running, s.resume, s.step = true, true, nil
+    return map[string]bool{"allThreadsContinued": true}, nil
+}
+
+// Step over a subroutine call by running until the stack is back to its depth
+func (s *dapServer) next(args json.RawMessage) (interface{}, error) {
+    if err := s.resumable(); err != nil {
+        return nil, err
+    }
+    if s.debugger.Current().Opcode & 0xF000 != 0x2000 {
+        return s.stepIn(args)
+    }
+    machine := s.debugger.Machine()
+    depth := machine.SP()
+    s.startStep(func() bool { return machine.SP() <= depth })
+    return nil, nil
+}
+
+// Any instruction ends the step
+func (s *dapServer) stepIn(args json.RawMessage) (interface{}, error) {
+    if err := s.resumable(); err != nil {
+        return nil, err
+    }
+    s.startStep(func() bool { return true })
+    return nil, nil
+}
+
+func (s *dapServer) stepOut(args json.RawMessage) (interface{}, error) {
+    if err := s.resumable(); err != nil {
+        return nil, err
+    }
+    machine := s.debugger.Machine()
+    depth := machine.SP()
+    if depth == 0 {
+        return nil, errors.New("not in a subroutine")
+    }
+    s.startStep(func() bool { return machine.SP() < depth })
+    return nil, nil
+}
+
+// Run frames from the current instruction until done returns true before an instruction
+func (s *dapServer) startStep(done func() bool) {
+    s.running, s.resume, s.step = true, true, done
+}
+
+func (s *dapServer) pause(args json.RawMessage) (interface{}, error) {
+    if s.running {
+        s.running = false
+        s.followUp = func() { s.stopped("pause", "") }
+    }
+    return nil, nil
+}
+
+func (s *dapServer) terminate(args json.RawMessage) (interface{}, error) {
+    if !s.exited {
+        s.followUp = s.exit
+    }
+    return nil, nil
+}
+
+func (s *dapServer) disconnect(args json.RawMessage) (interface{}, error) {
+    s.done = true
+    return nil, nil
+}
+
+func (s *dapServer) resumable() error {
+    if s.exited {
+        return errors.New("the program has exited")
+    }
+    return nil
+}
+
+// Run a frame of a continue or step
+func (s *dapServer) runFrame() {
+    step := s.step
+    stopped, err := s.debugger.ContinueFrame(s.resume, step)
+    s.resume = false
+    if err != nil {
+        s.fault(err)
+        return
+    }
+    if !stopped {
+        return
+    }
+    // A step that lands on a breakpoint has still finished
+    switch {
+    case s.debugger.WatchHit() != nil:
+        s.stopped("data breakpoint", "")
+    case step != nil && step():
+        s.stopped("step", "")
+    default:
+        s.stopped("breakpoint", "")
+    }
+}
+
+// Stop on a fault, which the client shows as an exception. Continuing retries the
+// instruction.
+func (s *dapServer) fault(err error) {
+    if err == chip8.ErrExit {
+        s.exit()
+        return
+    }
+    s.stopped("exception", err.Error())
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+    "bufio"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "github.com/stretchr/testify/assert"
+    "io"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "testing"
+)
+
+// Client end of a DAP session
+type dapClient struct {
+    w   io.Writer
+    r   *bufio.Reader
+    seq int
+}
+
+// Response or event as the client sees it
+type dapReply struct {
+    Type    string          `json:"type"`
+    Command string          `json:"command"`
+    Event   string          `json:"event"`
+    Success bool            `json:"success"`
+    Message string          `json:"message"`
+    Body    json.RawMessage `json:"body"`
+}
+
+func (c *dapClient) send(command string, args interface{}) {
+    c.seq++
+    body, _ := json.Marshal(map[string]interface{}{
+        "seq": c.seq, "type": "request", "command": command, "arguments": args,
+    })
+    fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+// Next message from the server
+func (c *dapClient) read() (*dapReply, error) {
+    length := -1
+    for {
+        line, err := c.r.ReadString('\n')
+        if err != nil {
+            return nil, err
+        }
+        line = strings.TrimSpace(line)
+        if line == "" {
+            break
+        }
+        if strings.HasPrefix(line, "Content-Length:") {
+            length, _ = strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "Content-Length:")))
+        }
+    }
+    body := make([]byte, length)
+    if _, err := io.ReadFull(c.r, body); err != nil {
+        return nil, err
+    }
+    reply := new(dapReply)
+    return reply, json.Unmarshal(body, reply)
+}
+
+// Read until the response to command, skipping events. The body is decoded into v.
+func (c *dapClient) request(assert *assert.Assertions, command string, args interface{}, v interface{}) {
+    c.send(command, args)
+    for {
+        reply, err := c.read()
+        if !assert.NoError(err, command) {
+            return
+        }
+        if reply.Type == "response" && reply.Command == command {
+            assert.True(reply.Success, "%s: %s", command, reply.Message)
+            if v != nil {
+                assert.NoError(json.Unmarshal(reply.Body, v), command)
+            }
+            return
+        }
+    }
+}
+
+// Read until the stopped event and return its reason
+func (c *dapClient) stopped(assert *assert.Assertions) string {
+    for {
+        reply, err := c.read()
+        if !assert.NoError(err) {
+            return ""
+        }
+        if reply.Type == "event" && reply.Event == "stopped" {
+            var body struct {
+                Reason string `json:"reason"`
+            }
+            json.Unmarshal(reply.Body, &body)
+            return body.Reason
+        }
+    }
+}
+
+// Source lines of the stack frames, innermost first
+func (c *dapClient) stackLines(assert *assert.Assertions) []int {
+    var body struct {
+        StackFrames []dapStackFrame `json:"stackFrames"`
+    }
+    c.request(assert, "stackTrace", map[string]int{"threadId": dapThread}, &body)
+    lines := []int{}
+    for _, frame := range body.StackFrames {
+        lines = append(lines, frame.Line)
+    }
+    return lines
+}
+
+const dapTestSource = `start:  LD V0, 1
+        CALL sub
+        ADD V0, 2
+done:   JP done
+
+sub:    ADD V1, 1
+        ADD V1, 1
+        RET
+`
+
+func TestDAPSession(t *testing.T) {
+    assert := assert.New(t)
+
+    dir, err := ioutil.TempDir("", "chip8")
+    assert.NoError(err)
+    defer os.RemoveAll(dir)
+    path := filepath.Join(dir, "test.asm")
+    assert.NoError(ioutil.WriteFile(path, []byte(dapTestSource), 0644))
+
+    serverIn, clientOut := io.Pipe()
+    clientIn, serverOut := io.Pipe()
+    options := addMachineFlags(flag.NewFlagSet("dap", flag.ContinueOnError))
+    served := make(chan error, 1)
+    go func() {
+        served <- newDAPServer(options, serverOut).serve(serverIn)
+        serverOut.Close()
+    }()
+    client := &dapClient{w: clientOut, r: bufio.NewReader(clientIn)}
+
+    var capabilities map[string]bool
+    client.request(assert, "initialize", map[string]string{"adapterID": "chip8"}, &capabilities)
+    assert.True(capabilities["supportsConfigurationDoneRequest"])
+    client.request(assert, "launch", map[string]string{"program": path}, nil)
+
+    // The blank line before sub moves down to its first instruction
+    var breakpoints struct {
+        Breakpoints []dapBreakpoint `json:"breakpoints"`
+    }
+    client.request(assert, "setBreakpoints", map[string]interface{}{
+        "source": map[string]string{"path": path}, "breakpoints": []map[string]int{{"line": 5}},
+    }, &breakpoints)
+    if assert.Len(breakpoints.Breakpoints, 1) {
+        assert.True(breakpoints.Breakpoints[0].Verified)
+        assert.Equal(6, breakpoints.Breakpoints[0].Line)
+        assert.Equal("0x208", breakpoints.Breakpoints[0].InstructionReference)
+    }
+
+    // Continue to the breakpoint inside the CALL, whose frame is the CALL's line
+    client.request(assert, "configurationDone", nil, nil)
+    assert.Equal("breakpoint", client.stopped(assert))
+    assert.Equal([]int{6, 2}, client.stackLines(assert))
+
+    client.request(assert, "next", map[string]int{"threadId": dapThread}, nil)
+    assert.Equal("step", client.stopped(assert))
+    assert.Equal([]int{7, 2}, client.stackLines(assert))
+
+    // Stepping out stops just past the CALL
+    client.request(assert, "stepOut", map[string]int{"threadId": dapThread}, nil)
+    assert.Equal("step", client.stopped(assert))
+    assert.Equal([]int{3}, client.stackLines(assert))
+
+    var variables struct {
+        Variables []dapVariable `json:"variables"`
+    }
+    client.request(assert, "variables", map[string]int{"variablesReference": dapRegisters}, &variables)
+    if assert.True(len(variables.Variables) > 1) {
+        assert.Equal(dapVariable{Name: "V1", Value: "0x02"}, variables.Variables[1])
+    }
+
+    // A step that lands on a breakpoint is still a step
+    client.request(assert, "setBreakpoints", map[string]interface{}{
+        "source": map[string]string{"path": path}, "breakpoints": []map[string]int{{"line": 4}},
+    }, nil)
+    client.request(assert, "stepIn", map[string]int{"threadId": dapThread}, nil)
+    assert.Equal("step", client.stopped(assert))
+    assert.Equal([]int{4}, client.stackLines(assert))
+    client.request(assert, "next", map[string]int{"threadId": dapThread}, nil)
+    assert.Equal("step", client.stopped(assert))
+
+    // Pausing stops the program where it is
+    client.request(assert, "setBreakpoints", map[string]interface{}{
+        "source": map[string]string{"path": path}, "breakpoints": []map[string]int{},
+    }, nil)
+    client.request(assert, "continue", map[string]int{"threadId": dapThread}, nil)
+    client.request(assert, "pause", map[string]int{"threadId": dapThread}, nil)
+    assert.Equal("pause", client.stopped(assert))
+    assert.Equal([]int{4}, client.stackLines(assert))
+
+    client.request(assert, "disconnect", nil, nil)
+    clientOut.Close()
+    assert.NoError(<-served)
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+    "bufio"
+    "errors"
+    "flag"
+    "fmt"
+    "github.com/eskrm/chip8"
+    "io"
+    "os"
+    "strconv"
+    "strings"
+)
+
+const debugHelp = `Commands:
+  s, step [n]              execute n instructions (default 1)
+  n, next                  step over subroutine calls
+  o, out                   run until the current subroutine returns
+  c, continue              run until a breakpoint
+  b, break ADDR [if COND]  set a breakpoint, e.g. "b 0x2A4 if V3 == 0x10"
+  d, delete ADDR           remove a breakpoint
+  w, watch ADDR [END] [rwx] stop on accesses to ADDR through END (default w)
+  u, unwatch ADDR          remove a watchpoint
+  l, list                  list breakpoints and watchpoints
+  log ADDR [END] [rwx]     start logging accesses to ADDR through END (default rw)
+  log                      print and clear the access log
+  r, regs                  show registers and the current instruction
+  m, mem ADDR [LEN]        dump memory
+  q, quit                  exit the debugger
+`
+
+// chip8 debug [flags] ROM
+func debug(args []string) error {
+    flags := flag.NewFlagSet("debug", flag.ExitOnError)
+    options := addMachineFlags(flags)
+    flags.Parse(args)
+    if flags.NArg() != 1 {
+        return errors.New("usage: chip8 debug [flags] ROM")
+    }
+
+    machine, _, err := options.load(flags.Arg(0))
+    if err != nil {
+        return err
+    }
+    debugger := chip8.NewDebugger(machine)
+    printState(os.Stdout, debugger)
+    return repl(&session{debugger: debugger}, os.Stdin, os.Stdout)
+}
+
+// REPL state kept between commands
+type session struct {
+    debugger *chip8.Debugger
+    log      *chip8.AccessLog
+    logHook  int
+}
+
+func repl(s *session, in io.Reader, out io.Writer) error {
+    scanner := bufio.NewScanner(in)
+    for {
+        fmt.Fprint(out, "(chip8) ")
+        if !scanner.Scan() {
+            return scanner.Err()
+        }
+        fields := strings.Fields(scanner.Text())
+        if len(fields) == 0 {
+            continue
+        }
+        if fields[0] == "q" || fields[0] == "quit" {
+            return nil
+        }
+        if err := runCommand(s, fields, out); err != nil {
+            fmt.Fprintln(out, "error:", err)
+        }
+    }
+}
+
+func runCommand(s *session, fields []string, out io.Writer) error {
+    debugger := s.debugger
+    var err error
+    switch fields[0] {
+    case "s", "step":
+        n := uint64(1)
+        if len(fields) > 1 {
+            if n, err = strconv.ParseUint(fields[1], 0, 32); err != nil {
+                return err
+            }
+        }
+        for k := uint64(0); k < n && err == nil; k++ {
+            err = debugger.Step()
+        }
+    case "n", "next":
+        err = debugger.StepOver()
+    case "o", "out":
+        err = debugger.StepOut()
+    case "c", "continue":
+        err = debugger.Continue()
+    case "b", "break":
+        return setBreakpoint(debugger, fields[1:])
+    case "d", "delete":
+        if len(fields) != 2 {
+            return errors.New("usage: delete ADDR")
+        }
+        addr, err := parseAddr(fields[1])
+        if err != nil {
+            return err
+        }
+        if !debugger.ClearBreakpoint(addr) {
+            return fmt.Errorf("no breakpoint at %03X", addr)
+        }
+        return nil
+    case "w", "watch":
+        return setWatchpoint(debugger, fields[1:])
+    case "u", "unwatch":
+        if len(fields) != 2 {
+            return errors.New("usage: unwatch ADDR")
+        }
+        addr, err := parseAddr(fields[1])
+        if err != nil {
+            return err
+        }
+        if !debugger.ClearWatchpoint(addr) {
+            return fmt.Errorf("no watchpoint at %04X", addr)
+        }
+        return nil
+    case "l", "list":
+        for _, b := range debugger.Breakpoints() {
+            fmt.Fprintln(out, "break", b)
+        }
+        for _, w := range debugger.Watchpoints() {
+            fmt.Fprintln(out, "watch", w)
+        }
+        return nil
+    case "log":
+        return s.accessLog(fields[1:], out)
+    case "r", "regs":
+    case "m", "mem":
+        return dumpMemory(debugger.Machine(), fields[1:], out)
+    case "h", "help":
+        fmt.Fprint(out, debugHelp)
+        return nil
+    default:
+        return fmt.Errorf("unknown command %q, try help", fields[0])
+    }
+    if hit := debugger.WatchHit(); hit != nil {
+        fmt.Fprintln(out, "watchpoint:", hit)
+    }
+    printState(out, debugger)
+    return err
+}
+
+// Parse ADDR [END] [rwx], with END defaulting to ADDR
+func parseRange(args []string, kinds chip8.Access) (uint16, uint16, chip8.Access, error) {
+    if len(args) == 0 || len(args) > 3 {
+        return 0, 0, 0, errors.New("expected ADDR [END] [rwx]")
+    }
+    start, err := parseAddr(args[0])
+    if err != nil {
+        return 0, 0, 0, err
+    }
+    end := start
+    args = args[1:]
+    if len(args) > 0 {
+        if addr, err := parseAddr(args[0]); err == nil {
+            end = addr
+            args = args[1:]
+        }
+    }
+    if len(args) > 0 {
+        if kinds, err = chip8.ParseAccess(args[0]); err != nil {
+            return 0, 0, 0, err
+        }
+    }
+    if end < start {
+        return 0, 0, 0, fmt.Errorf("range end %04X is before start %04X", end, start)
+    }
+    return start, end, kinds, nil
+}
+
+func setWatchpoint(debugger *chip8.Debugger, args []string) error {
+    start, end, kinds, err := parseRange(args, chip8.Write)
+    if err != nil {
+        return fmt.Errorf("usage: watch ADDR [END] [rwx]: %v", err)
+    }
+    debugger.SetWatchpoint(start, end, kinds)
+    return nil
+}
+
+// Start a new access log, or print and clear the current one
+func (s *session) accessLog(args []string, out io.Writer) error {
+    machine := s.debugger.Machine()
+    if len(args) == 0 {
+        if s.log == nil {
+            return errors.New("no access log, start one with log ADDR [END] [rwx]")
+        }
+        for _, access := range s.log.Entries {
+            fmt.Fprintln(out, access)
+        }
+        s.log.Entries = nil
+        return nil
+    }
+    start, end, kinds, err := parseRange(args, chip8.Read | chip8.Write)
+    if err != nil {
+        return fmt.Errorf("usage: log ADDR [END] [rwx]: %v", err)
+    }
+    if s.log != nil {
+        machine.RemoveMemoryHook(s.logHook)
+    }
+    s.log = chip8.NewAccessLog(start, end, kinds)
+    s.logHook = machine.AddMemoryHook(s.log.Hook())
+    return nil
+}
+
+func setBreakpoint(debugger *chip8.Debugger, args []string) error {
+    if len(args) == 0 {
+        return errors.New("usage: break ADDR [if COND]")
+    }
+    addr, err := parseAddr(args[0])
+    if err != nil {
+        return err
+    }
+    var condition *chip8.Condition
+    if len(args) > 1 {
+        if args[1] != "if" {
+            return errors.New("usage: break ADDR [if COND]")
+        }
+        if condition, err = chip8.ParseCondition(strings.Join(args[2:], " ")); err != nil {
+            return err
+        }
+    }
+    debugger.SetBreakpoint(addr, condition)
+    return nil
+}
+
+// Addresses are hex, with or without a 0x prefix
+func parseAddr(text string) (uint16, error) {
+    addr, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(text), "0x"), 16, 16)
+    if err != nil {
+        return 0, fmt.Errorf("bad address %q", text)
+    }
+    return uint16(addr), nil
+}
+
+func dumpMemory(machine *chip8.Machine, args []string, out io.Writer) error {
+    if len(args) == 0 {
+        return errors.New("usage: mem ADDR [LEN]")
+    }
+    addr, err := parseAddr(args[0])
+    if err != nil {
+        return err
+    }
+    length := uint64(16)
+    if len(args) > 1 {
+        if length, err = strconv.ParseUint(args[1], 0, 16); err != nil {
+            return err
+        }
+    }
+    memory := machine.Memory()
+    end := int(addr) + int(length)
+    if end > len(memory) {
+        end = len(memory)
+    }
+    for row := int(addr); row < end; row += 16 {
+        fmt.Fprintf(out, "%04X:", row)
+        for k := row; k < row + 16 && k < end; k++ {
+            fmt.Fprintf(out, " %02X", memory[k])
+        }
+        fmt.Fprintln(out)
+    }
+    return nil
+}
+
+func printState(out io.Writer, debugger *chip8.Debugger) {
+    machine := debugger.Machine()
+    v := machine.V()
+    for k, value := range v {
+        fmt.Fprintf(out, "V%X=%02X ", k, value)
+    }
+    fmt.Fprintf(out, "\nI=%04X PC=%04X SP=%02X DT=%02X ST=%02X\n",
+                machine.I(), machine.PC(), machine.SP(), machine.DT(), machine.ST())
+    in := debugger.Current()
+    fmt.Fprintf(out, "%04X: %04X  %v\n", in.Addr, in.Opcode, in)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+    "errors"
+    "flag"
+    "fmt"
+    "github.com/eskrm/chip8/disasm"
+    "io/ioutil"
+)
+
+// chip8 disasm [flags] ROM
+func disassemble(args []string) error {
+    flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+    origin := flags.String("origin", "200", "the hex address the ROM is loaded at")
+    start := flags.String("start", "", "the hex address to start disassembling at, default the origin")
+    end := flags.String("end", "", "the hex address to stop disassembling before, default the end of the ROM")
+    flags.Parse(args)
+    if flags.NArg() != 1 {
+        return errors.New("usage: chip8 disasm [flags] ROM")
+    }
+
+    rom, err := ioutil.ReadFile(flags.Arg(0))
+    if err != nil {
+        return err
+    }
+    base, err := parseAddr(*origin)
+    if err != nil {
+        return err
+    }
+
+    // Restrict to the requested range of addresses
+    from, to := int(base), int(base) + len(rom)
+    if *start != "" {
+        addr, err := parseAddr(*start)
+        if err != nil {
+            return err
+        }
+        from = int(addr)
+    }
+    if *end != "" {
+        addr, err := parseAddr(*end)
+        if err != nil {
+            return err
+        }
+        to = int(addr)
+    }
+    if from < int(base) || to > int(base) + len(rom) || from > to {
+        return fmt.Errorf("range %04X-%04X is outside the ROM at %04X-%04X", from, to, base, int(base) + len(rom))
+    }
+
+    program := disasm.Disassemble(rom[from - int(base):to - int(base)], uint16(from))
+    fmt.Print(program)
+    return nil
+}
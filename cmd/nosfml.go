@@ -0,0 +1,12 @@
+// +build nosfml
+
+package main
+
+import (
+    "errors"
+    "github.com/eskrm/chip8"
+)
+
+func newSFML(width, height uint) (chip8.Window, chip8.Audio, error) {
+    return nil, nil, errors.New("built without SFML support, use -terminal")
+}
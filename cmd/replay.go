@@ -0,0 +1,37 @@
+package main
+
+import (
+    "errors"
+    "flag"
+    "fmt"
+    "github.com/eskrm/chip8"
+)
+
+// chip8 replay MOVIE ROM
+func replay(args []string) error {
+    flags := flag.NewFlagSet("replay", flag.ExitOnError)
+    quiet := flags.Bool("quiet", false, "don't print the final screen")
+    flags.Parse(args)
+    if flags.NArg() != 2 {
+        return errors.New("usage: chip8 replay [flags] MOVIE ROM")
+    }
+
+    movie, err := chip8.LoadMovieFile(flags.Arg(0))
+    if err != nil {
+        return fmt.Errorf("could not load movie %s: %v", flags.Arg(0), err)
+    }
+    rom, err := loadROM(flags.Arg(1))
+    if err != nil {
+        return &chip8.ROMError{Path: flags.Arg(1), Err: err}
+    }
+    machine, err := movie.Replay(rom)
+    if machine != nil && !*quiet {
+        screen := machine.Screen()
+        fmt.Print(screen.String())
+    }
+    if err != nil {
+        return err
+    }
+    fmt.Printf("replayed %d frames, screen matches the recording\n", len(movie.Frames))
+    return nil
+}
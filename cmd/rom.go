@@ -0,0 +1,102 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "github.com/eskrm/chip8"
+    "github.com/eskrm/chip8/asm"
+    "github.com/eskrm/chip8/octo"
+    "io/ioutil"
+    "path/filepath"
+    "strings"
+)
+
+// Read a ROM image, compiling Octo and assembly sources by their extension
+func loadROM(path string) ([]byte, error) {
+    switch strings.ToLower(filepath.Ext(path)) {
+    case ".8o":
+        program, err := octo.CompileFile(path)
+        if err != nil {
+            return nil, err
+        }
+        return program.Bytes, nil
+    case ".asm":
+        program, err := asm.AssembleFile(path)
+        if err != nil {
+            return nil, err
+        }
+        return program.Bytes, nil
+    }
+    return ioutil.ReadFile(path)
+}
+
+// Flags that configure the emulated machine, shared by every command that runs a ROM
+type machineOptions struct {
+    speed  *int
+    quirks *string
+    stack  *string
+    xochip *bool
+    seed   *int64
+    random *string
+}
+
+func addMachineFlags(flags *flag.FlagSet) *machineOptions {
+    return &machineOptions{
+        speed:  flags.Int("speed", chip8.DefaultSpeed, "the number of instructions executed per second"),
+        quirks: flags.String("quirks", "", "the quirks preset to emulate: vip, chip48 or schip"),
+        stack:  flags.String("stack", "halt", "on stack overflow or underflow: halt, trap to stop in an attached GDB client, or wrap into memory like the COSMAC VIP"),
+        xochip: flags.Bool("xochip", false, "enable the XO-CHIP extensions and 64K of memory"),
+        seed:   flags.Int64("seed", -1, "the seed for RND, making runs repeatable, or -1 to seed from the clock"),
+        random: flags.String("rng", "splitmix", "the RND algorithm: splitmix or vip"),
+    }
+}
+
+// Create a headless machine for a ROM file. Also returns the ROM image.
+func (o *machineOptions) load(romPath string) (*chip8.Machine, []byte, error) {
+    rom, err := loadROM(romPath)
+    if err != nil {
+        return nil, nil, &chip8.ROMError{Path: romPath, Err: err}
+    }
+    machine, err := o.newMachine(romPath, rom)
+    if err != nil {
+        return nil, nil, err
+    }
+    return machine, rom, nil
+}
+
+// Create a headless machine for a ROM image read from romPath
+func (o *machineOptions) newMachine(romPath string, rom []byte) (*chip8.Machine, error) {
+    newMachine := chip8.NewMachine
+    if *o.xochip {
+        newMachine = chip8.NewXOChipMachine
+    }
+    machine, err := newMachine(rom)
+    if err != nil {
+        return nil, &chip8.ROMError{Path: romPath, Err: err}
+    }
+    machine.SetSpeed(*o.speed)
+    if *o.quirks != "" {
+        preset, ok := chip8.QuirkPresets[*o.quirks]
+        if !ok {
+            return nil, fmt.Errorf("unknown quirks preset %q", *o.quirks)
+        }
+        machine.SetQuirks(preset)
+    }
+    policy, ok := chip8.StackPolicies[*o.stack]
+    if !ok {
+        return nil, fmt.Errorf("unknown stack policy %q", *o.stack)
+    }
+    machine.SetStackPolicy(policy)
+    algorithm, ok := chip8.RandomAlgorithms[*o.random]
+    if !ok {
+        return nil, fmt.Errorf("unknown RND algorithm %q", *o.random)
+    }
+    if *o.seed >= 0 {
+        machine.SetRandom(algorithm, uint64(*o.seed))
+    } else if algorithm != chip8.RandomSplitMix {
+        // Keep the clock seed the machine started with
+        _, seed := machine.Random()
+        machine.SetRandom(algorithm, seed)
+    }
+    return machine, nil
+}
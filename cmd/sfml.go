@@ -0,0 +1,11 @@
+// +build !nosfml
+
+package main
+
+import (
+    "github.com/eskrm/chip8"
+)
+
+func newSFML(width, height uint) (chip8.Window, chip8.Audio, error) {
+    return chip8.NewSFMLWindow(width, height), chip8.NewSFMLAudio(), nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+    "bufio"
+    "errors"
+    "flag"
+    "fmt"
+    "github.com/eskrm/chip8"
+    "io"
+    "os"
+    "strings"
+)
+
+// Flags that limit a trace, shared by chip8 run and chip8 trace
+type traceFilterOptions struct {
+    pcs *string
+    ops *string
+}
+
+func addTraceFilterFlags(flags *flag.FlagSet) *traceFilterOptions {
+    return &traceFilterOptions{
+        pcs: flags.String("trace-pc", "", "only trace instructions at these hex addresses, e.g. 200-2FF,310"),
+        ops: flags.String("trace-ops", "", "only trace these opcode classes, e.g. flow,alu"),
+    }
+}
+
+func (o *traceFilterOptions) filter() (chip8.TraceFilter, error) {
+    filter := chip8.TraceAll
+    if *o.pcs != "" {
+        for _, text := range strings.Split(*o.pcs, ",") {
+            bounds := strings.SplitN(text, "-", 2)
+            start, err := parseAddr(bounds[0])
+            if err != nil {
+                return filter, err
+            }
+            end := start
+            if len(bounds) == 2 {
+                if end, err = parseAddr(bounds[1]); err != nil {
+                    return filter, err
+                }
+            }
+            if end < start {
+                return filter, fmt.Errorf("range end %04X is before start %04X", end, start)
+            }
+            filter.Ranges = append(filter.Ranges, chip8.AddrRange{Start: start, End: end})
+        }
+    }
+    if *o.ops != "" {
+        classes, err := chip8.ParseOpcodeClasses(*o.ops)
+        if err != nil {
+            return filter, err
+        }
+        filter.Classes = classes
+    }
+    return filter, nil
+}
+
+// Start tracing a machine to a file. Returns a function that finishes the trace.
+func startTrace(machine *chip8.Machine, path, format string, options *traceFilterOptions) (func() error, error) {
+    filter, err := options.filter()
+    if err != nil {
+        return nil, err
+    }
+    file, err := os.Create(path)
+    if err != nil {
+        return nil, err
+    }
+    var tracer *chip8.Tracer
+    switch format {
+    case "text":
+        tracer = chip8.NewTextTracer(file)
+    case "binary":
+        if tracer, err = chip8.NewBinaryTracer(file); err != nil {
+            file.Close()
+            return nil, err
+        }
+    default:
+        file.Close()
+        return nil, fmt.Errorf("unknown trace format %q, use text or binary", format)
+    }
+    tracer.SetFilter(filter)
+    machine.SetTracer(tracer)
+    return func() error {
+        machine.SetTracer(nil)
+        err := tracer.Flush()
+        if closeErr := file.Close(); err == nil {
+            err = closeErr
+        }
+        return err
+    }, nil
+}
+
+// chip8 trace [flags] TRACE
+func renderTrace(args []string) error {
+    flags := flag.NewFlagSet("trace", flag.ExitOnError)
+    options := addTraceFilterFlags(flags)
+    flags.Parse(args)
+    if flags.NArg() != 1 {
+        return errors.New("usage: chip8 trace [flags] TRACE")
+    }
+    filter, err := options.filter()
+    if err != nil {
+        return err
+    }
+
+    file, err := os.Open(flags.Arg(0))
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+    reader, err := chip8.NewTraceReader(file)
+    if err != nil {
+        return err
+    }
+    out := bufio.NewWriter(os.Stdout)
+    defer out.Flush()
+    for {
+        entry, err := reader.Next()
+        if err == io.EOF {
+            return nil
+        } else if err != nil {
+            return fmt.Errorf("could not read trace %s: %v", flags.Arg(0), err)
+        }
+        if filter.Match(entry.PC, entry.Opcode) {
+            fmt.Fprintln(out, entry)
+        }
+    }
+}
@@ -0,0 +1,115 @@
+package chip8
+
+import (
+    "flag"
+    "github.com/eskrm/chip8/asm"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+// The community test ROMs aren't distributed with the emulator. Copy them from Timendus'
+// chip8-test-suite into this directory, or point -roms at them.
+var conformanceROMs = flag.String("roms", filepath.Join("testdata", "conformance", "roms"), "directory of the conformance test ROMs")
+
+var updateGolden = flag.Bool("update", false, "rewrite the conformance golden images from the current screens")
+
+// Test ROM run headlessly for a number of frames, whose final screen must match the golden
+// image testdata/conformance/NAME.txt
+type conformanceTest struct {
+    name   string
+    rom    string
+    quirks Quirks
+    menu   byte // Stored at 0x1FF to choose a menu entry without a key press, if not 0
+    frames int
+    keys   []KeyEvent
+}
+
+// Their golden images aren't committed yet: they have to come from the real ROMs. Write them
+// with -roms DIR -update and check each logged screen before committing it. corax+ and flags
+// must show every test as passing, and the quirks screens must show each preset's quirks
+// as detected for that platform.
+var conformanceTests = []conformanceTest{
+    {name: "corax+", rom: "3-corax+.ch8", frames: 120},
+    {name: "flags", rom: "4-flags.ch8", frames: 400},
+    {name: "quirks-vip", rom: "5-quirks.ch8", quirks: VIPQuirks, menu: 1, frames: 1200},
+    {name: "quirks-schip", rom: "5-quirks.ch8", quirks: SuperChipQuirks, menu: 2, frames: 1200},
+    // EX9E with key 5 held from the second second on
+    {name: "keypad", rom: "6-keypad.ch8", menu: 1, frames: 180, keys: []KeyEvent{{Frame: 60, Key: 5, Pressed: true}}},
+}
+
+func TestConformance(t *testing.T) {
+    for _, test := range conformanceTests {
+        test := test
+        t.Run(test.name, func(t *testing.T) {
+            rom, err := ioutil.ReadFile(filepath.Join(*conformanceROMs, test.rom))
+            if os.IsNotExist(err) {
+                t.Skipf("%s not found in %s", test.rom, *conformanceROMs)
+            } else if err != nil {
+                t.Fatal(err)
+            }
+            screen, err := runConformance(test, rom)
+            if err != nil {
+                t.Fatal(err)
+            }
+            checkGolden(t, test.name, screen)
+        })
+    }
+}
+
+// The 8xy_ flags check in testdata/conformance/flags.asm always runs, ROMs or not
+func TestConformanceFlagsCheck(t *testing.T) {
+    program, err := asm.AssembleFile(filepath.Join("testdata", "conformance", "flags.asm"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, quirks := range []Quirks{{}, VIPQuirks, SuperChipQuirks} {
+        screen, err := runConformance(conformanceTest{quirks: quirks, frames: 60}, program.Bytes)
+        if err != nil {
+            t.Fatal(err)
+        }
+        checkGolden(t, "flags-check", screen)
+    }
+}
+
+// Compares the screen against the golden image testdata/conformance/NAME.txt, or rewrites
+// it with -update
+func checkGolden(t *testing.T, name string, screen Screen) {
+    t.Helper()
+    golden := filepath.Join("testdata", "conformance", name + ".txt")
+    if *updateGolden {
+        if err := os.MkdirAll(filepath.Dir(golden), 0755); err != nil {
+            t.Fatal(err)
+        }
+        if err := ioutil.WriteFile(golden, []byte(screen.String()), 0644); err != nil {
+            t.Fatal(err)
+        }
+        t.Logf("wrote %s, check it before committing:\n%s", golden, screen.String())
+        return
+    }
+    want, err := ioutil.ReadFile(golden)
+    if err != nil {
+        t.Fatalf("%v: check the screen below and run go test -run TestConformance -update\n%s", err, screen.String())
+    }
+    if screen.String() != string(want) {
+        t.Errorf("screen differs from %s:\n%s", golden, screen.String())
+    }
+}
+
+func runConformance(test conformanceTest, rom []byte) (Screen, error) {
+    machine, err := NewMachine(rom)
+    if err != nil {
+        return Screen{}, err
+    }
+    machine.SetQuirks(test.quirks)
+    machine.SetRandom(RandomSplitMix, 1)
+    if test.menu != 0 {
+        machine.context.memory[0x1FF] = test.menu
+    }
+    driver := NewMachineDriver(NewHeadlessWindow(test.keys, test.frames), machine)
+    if err := driver.RunFast(); err != nil {
+        return Screen{}, err
+    }
+    return machine.Screen(), nil
+}
@@ -1,14 +1,35 @@
 package chip8
 
 type Context struct {
-    opcode uint16 // Current opcode
-    stack  [16]uint16
-    memory [4096]byte
-    cpu    *CPU
-    window Window // Interface for audio, graphics, and input
-    screen [64][32]byte // Internal representation of screen independent of window
+    opcode      uint16 // Current opcode
+    stack       [16]uint16
+    memory      [65536]byte
+    cpu         *CPU
+    window      Window // Interface for graphics and input
+    screen      Screen // Internal representation of screen independent of window
+    quirks      Quirks
+    stackPolicy StackPolicy
+    xochip      bool     // Whether the XO-CHIP instructions and 64K of memory are available
+    vblank      bool     // Set by DRW to end the frame early when waiting for the display
+    flags       [16]byte // SUPER-CHIP RPL user flags
+    planes      byte     // XO-CHIP bit planes selected for drawing
+    pitch       byte     // XO-CHIP audio playback pitch
+    audio       [16]byte // XO-CHIP 1-bit audio pattern
+    hasAudio    bool     // Set once F002 loads a pattern
+    rng         rng      // Source for RND
+    hooks       []memoryHook
+    hookID      int // Last id handed out by AddMemoryHook
 }
 
-func newContext(cpu *CPU, window Window, memory [4096]byte) *Context {
-    return &Context{opcode: 0, cpu: cpu, window: window, memory: memory}
+func newContext(cpu *CPU, window Window, memory [65536]byte) *Context {
+    return &Context{opcode: 0, cpu: cpu, window: window, memory: memory, screen: newScreen(),
+                    planes: 1, pitch: 64}
+}
+
+// Size of the addressable memory, 4K unless XO-CHIP extends it to 64K
+func (c *Context) memorySize() int {
+    if c.xochip {
+        return len(c.memory)
+    }
+    return 0x1000
 }
@@ -6,7 +6,7 @@ type CPU struct {
     sp     byte     // Stack pointer
     i      uint16   // Address register
     v      [16]byte // General purpose registers
-    delay  int64    // Delay in ms between instruction cycles
+    delay  int64    // Time owed to the next frame, in ms times ticksPerSecond
 }
 
 func newCPU() *CPU {
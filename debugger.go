@@ -0,0 +1,279 @@
+package chip8
+
+import (
+    "errors"
+    "fmt"
+    "github.com/eskrm/chip8/disasm"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// Returned when execution stops because the window closed
+var ErrWindowClosed = errors.New("window closed")
+
+// Register comparison that must hold for a conditional breakpoint to stop
+type Condition struct {
+    Register int // V0-VF
+    Op       string
+    Value    byte
+}
+
+// Parse a condition such as "V3 == 0x10". Supports ==, !=, <, <=, > and >=.
+func ParseCondition(text string) (*Condition, error) {
+    fields := strings.Fields(text)
+    if len(fields) != 3 {
+        return nil, fmt.Errorf("condition %q should look like V3 == 0x10", text)
+    }
+    reg := strings.ToUpper(fields[0])
+    if len(reg) != 2 || reg[0] != 'V' {
+        return nil, fmt.Errorf("unknown register %q", fields[0])
+    }
+    r, err := strconv.ParseUint(reg[1:], 16, 4)
+    if err != nil {
+        return nil, fmt.Errorf("unknown register %q", fields[0])
+    }
+    switch fields[1] {
+    case "==", "!=", "<", "<=", ">", ">=":
+    default:
+        return nil, fmt.Errorf("unknown comparison %q", fields[1])
+    }
+    value, err := strconv.ParseUint(fields[2], 0, 8)
+    if err != nil {
+        return nil, fmt.Errorf("bad value %q: %v", fields[2], err)
+    }
+    return &Condition{Register: int(r), Op: fields[1], Value: byte(value)}, nil
+}
+
+func (c *Condition) holds(v [16]byte) bool {
+    reg := v[c.Register]
+    switch c.Op {
+    case "==":
+        return reg == c.Value
+    case "!=":
+        return reg != c.Value
+    case "<":
+        return reg < c.Value
+    case "<=":
+        return reg <= c.Value
+    case ">":
+        return reg > c.Value
+    case ">=":
+        return reg >= c.Value
+    }
+    return false
+}
+
+func (c *Condition) String() string {
+    return fmt.Sprintf("V%X %s 0x%02X", c.Register, c.Op, c.Value)
+}
+
+type Breakpoint struct {
+    Addr      uint16
+    Condition *Condition // Nil to always stop
+}
+
+func (b *Breakpoint) String() string {
+    if b.Condition == nil {
+        return fmt.Sprintf("%03X", b.Addr)
+    }
+    return fmt.Sprintf("%03X if %v", b.Addr, b.Condition)
+}
+
+// Stops execution when the address range is accessed
+type Watchpoint struct {
+    Start, End uint16 // Inclusive range
+    Kinds      Access
+}
+
+func (w *Watchpoint) String() string {
+    return fmt.Sprintf("%04X-%04X %s", w.Start, w.End, w.Kinds)
+}
+
+func (w *Watchpoint) matches(kind Access, addr uint16) bool {
+    return w.Kinds & kind != 0 && addr >= w.Start && addr <= w.End
+}
+
+// Debugger pauses a Machine at breakpoints and watchpoints and steps it an instruction at a
+// time. Execution keeps frame timing, so the timers advance as they would in a normal run,
+// but frames are not paced to real time.
+type Debugger struct {
+    machine     *Machine
+    breakpoints map[uint16]*Breakpoint
+    watchpoints []*Watchpoint
+    hit         *MemoryAccess // Access that triggered a watchpoint during the last run
+}
+
+func NewDebugger(machine *Machine) *Debugger {
+    d := &Debugger{machine: machine, breakpoints: map[uint16]*Breakpoint{}}
+    machine.AddMemoryHook(d.watch)
+    return d
+}
+
+// Record read and write watchpoint hits. Execute watchpoints are checked before the
+// instruction runs instead.
+func (d *Debugger) watch(access MemoryAccess) {
+    if d.hit != nil || access.Kind == Execute {
+        return
+    }
+    for _, w := range d.watchpoints {
+        if w.matches(access.Kind, access.Addr) {
+            d.hit = &access
+            return
+        }
+    }
+}
+
+// Stop on accesses of the given kinds to addresses start through end. Read and write
+// watchpoints stop after the accessing instruction, execute watchpoints before.
+func (d *Debugger) SetWatchpoint(start, end uint16, kinds Access) {
+    d.ClearWatchpoint(start)
+    d.watchpoints = append(d.watchpoints, &Watchpoint{Start: start, End: end, Kinds: kinds})
+}
+
+// Remove the watchpoint starting at start. Returns false if there was none.
+func (d *Debugger) ClearWatchpoint(start uint16) bool {
+    for k, w := range d.watchpoints {
+        if w.Start == start {
+            d.watchpoints = append(d.watchpoints[:k], d.watchpoints[k + 1:]...)
+            return true
+        }
+    }
+    return false
+}
+
+func (d *Debugger) Watchpoints() []*Watchpoint {
+    return append([]*Watchpoint{}, d.watchpoints...)
+}
+
+// Access that stopped the last run, or nil if it wasn't stopped by a watchpoint
+func (d *Debugger) WatchHit() *MemoryAccess {
+    return d.hit
+}
+
+// Check execute watchpoints against the instruction about to run
+func (d *Debugger) atWatchedInstruction() bool {
+    pc := d.machine.context.cpu.pc
+    for _, w := range d.watchpoints {
+        if w.matches(Execute, pc) {
+            d.hit = &MemoryAccess{Kind: Execute, Addr: pc, Value: d.machine.context.memory[pc], PC: pc}
+            return true
+        }
+    }
+    return false
+}
+
+func (d *Debugger) Machine() *Machine {
+    return d.machine
+}
+
+// Set a breakpoint at addr, replacing any already there
+func (d *Debugger) SetBreakpoint(addr uint16, condition *Condition) {
+    d.breakpoints[addr] = &Breakpoint{Addr: addr, Condition: condition}
+}
+
+// Remove the breakpoint at addr. Returns false if there was none.
+func (d *Debugger) ClearBreakpoint(addr uint16) bool {
+    _, ok := d.breakpoints[addr]
+    delete(d.breakpoints, addr)
+    return ok
+}
+
+// Breakpoints ordered by address
+func (d *Debugger) Breakpoints() []*Breakpoint {
+    breakpoints := []*Breakpoint{}
+    for _, b := range d.breakpoints {
+        breakpoints = append(breakpoints, b)
+    }
+    sort.Slice(breakpoints, func(i, j int) bool {
+        return breakpoints[i].Addr < breakpoints[j].Addr
+    })
+    return breakpoints
+}
+
+// Instruction at the program counter
+func (d *Debugger) Current() disasm.Instruction {
+    return disasm.Decode(d.machine.context.memory[:], int(d.machine.context.cpu.pc))
+}
+
+func (d *Debugger) atBreakpoint() bool {
+    b, ok := d.breakpoints[d.machine.context.cpu.pc]
+    return ok && (b.Condition == nil || b.Condition.holds(d.machine.context.cpu.v))
+}
+
+// Run frames until stop returns true or a watchpoint triggers before an instruction. The
+// first instruction always runs so that execution can resume from a breakpoint.
+func (d *Debugger) runUntil(stop func() bool) error {
+    window := d.machine.context.window
+    first := true
+    d.hit = nil
+    check := func() bool {
+        if first {
+            first = false
+            return false
+        }
+        return d.hit != nil || d.atWatchedInstruction() || stop()
+    }
+    for {
+        stopped, err := d.machine.runFrameUntil(check)
+        if stopped || err != nil {
+            return err
+        }
+        if window.ShouldClose() {
+            return ErrWindowClosed
+        }
+        window.Update()
+    }
+}
+
+// Run the rest of the current frame, stopping at breakpoints and watchpoints like Continue,
+// or when stop, if not nil, returns true before an instruction. When resuming, the first
+// instruction runs unchecked so that execution can leave a breakpoint. Returns whether it
+// stopped. Running a frame at a time lets a front end poll for input between frames.
+func (d *Debugger) ContinueFrame(resume bool, stop func() bool) (bool, error) {
+    if resume {
+        d.hit = nil
+    }
+    return d.machine.runFrameUntil(func() bool {
+        if resume {
+            resume = false
+            return false
+        }
+        return d.hit != nil || d.atWatchedInstruction() || d.atBreakpoint() || stop != nil && stop()
+    })
+}
+
+// Execute one instruction
+func (d *Debugger) Step() error {
+    return d.runUntil(func() bool {
+        return true
+    })
+}
+
+// Execute one instruction, running a called subroutine to completion. Stops early at
+// breakpoints.
+func (d *Debugger) StepOver() error {
+    if d.Current().Opcode & 0xF000 != 0x2000 {
+        return d.Step()
+    }
+    depth := d.machine.context.cpu.sp
+    return d.runUntil(func() bool {
+        return d.machine.context.cpu.sp <= depth || d.atBreakpoint()
+    })
+}
+
+// Run until the current subroutine returns. Stops early at breakpoints.
+func (d *Debugger) StepOut() error {
+    depth := d.machine.context.cpu.sp
+    if depth == 0 {
+        return errors.New("not in a subroutine")
+    }
+    return d.runUntil(func() bool {
+        return d.machine.context.cpu.sp < depth || d.atBreakpoint()
+    })
+}
+
+// Run until a breakpoint, a fault or the window closing
+func (d *Debugger) Continue() error {
+    return d.runUntil(d.atBreakpoint)
+}
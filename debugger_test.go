@@ -0,0 +1,147 @@
+package chip8
+
+import (
+    "github.com/stretchr/testify/assert"
+    "testing"
+)
+
+// ADD V0, 1; CALL 0x208; JP 0x200; ADD V1, 1; RET
+var debugROM = []byte{0x70, 0x01, 0x22, 0x06, 0x12, 0x00, 0x71, 0x01, 0x00, 0xEE}
+
+func TestParseCondition(t *testing.T) {
+    assert := assert.New(t)
+
+    condition, err := ParseCondition("vA >= 0x10")
+    assert.NoError(err)
+    assert.Equal(&Condition{Register: 0xA, Op: ">=", Value: 0x10}, condition)
+    assert.True(condition.holds([16]byte{0xA: 0x10}))
+    assert.False(condition.holds([16]byte{0xA: 0x0F}))
+
+    _, err = ParseCondition("V3 = 1")
+    assert.Error(err)
+    _, err = ParseCondition("VG == 1")
+    assert.Error(err)
+    _, err = ParseCondition("V3 == 256")
+    assert.Error(err)
+}
+
+func TestDebuggerBreakpoint(t *testing.T) {
+    assert := assert.New(t)
+
+    // ADD V0, 1; ADD V1, 1; JP 0x200
+    machine, _ := NewMachine([]byte{0x70, 0x01, 0x71, 0x01, 0x12, 0x00})
+    debugger := NewDebugger(machine)
+
+    debugger.SetBreakpoint(0x202, nil)
+    assert.NoError(debugger.Continue())
+    assert.Equal(uint16(0x202), machine.PC())
+    assert.Equal(byte(0), machine.V()[1])
+
+    // Resuming from a breakpoint runs past it
+    assert.True(debugger.ClearBreakpoint(0x202))
+    debugger.SetBreakpoint(0x200, &Condition{Register: 0, Op: "==", Value: 3})
+    assert.NoError(debugger.Continue())
+    assert.Equal(uint16(0x200), machine.PC())
+    assert.Equal(byte(3), machine.V()[0])
+    assert.Equal("ADD V0, 0x01", debugger.Current().String())
+}
+
+func TestDebuggerStepOver(t *testing.T) {
+    assert := assert.New(t)
+    machine, _ := NewMachine(debugROM)
+    debugger := NewDebugger(machine)
+
+    assert.NoError(debugger.Step())
+    assert.Equal(uint16(0x202), machine.PC())
+
+    // The subroutine runs to completion
+    assert.NoError(debugger.StepOver())
+    assert.Equal(uint16(0x204), machine.PC())
+    assert.Equal(byte(0), machine.SP())
+    assert.Equal(byte(1), machine.V()[1])
+}
+
+func TestDebuggerStepOut(t *testing.T) {
+    assert := assert.New(t)
+    machine, _ := NewMachine(debugROM)
+    debugger := NewDebugger(machine)
+
+    assert.Error(debugger.StepOut())
+
+    debugger.Step()
+    debugger.Step()
+    assert.Equal(uint16(0x206), machine.PC())
+    assert.NoError(debugger.StepOut())
+    assert.Equal(uint16(0x204), machine.PC())
+    assert.Equal(byte(0), machine.SP())
+    assert.Equal(byte(1), machine.V()[1])
+}
+
+func TestDebuggerKeepsFrameTiming(t *testing.T) {
+    assert := assert.New(t)
+    machine, _ := NewMachine(debugROM)
+    machine.SetSpeed(600)
+    machine.context.cpu.dt = 10
+    debugger := NewDebugger(machine)
+
+    // 600 instructions per second is 9.6 instructions per frame
+    for k := 0; k < 10; k++ {
+        debugger.Step()
+    }
+    assert.Equal(byte(9), machine.DT())
+}
+
+func TestDebuggerContinueFrame(t *testing.T) {
+    assert := assert.New(t)
+
+    // ADD V0, 1; ADD V1, 1; JP 0x200
+    machine, _ := NewMachine([]byte{0x70, 0x01, 0x71, 0x01, 0x12, 0x00})
+    debugger := NewDebugger(machine)
+
+    debugger.SetBreakpoint(0x202, nil)
+    stopped, err := debugger.ContinueFrame(false, nil)
+    assert.NoError(err)
+    assert.True(stopped)
+    assert.Equal(uint16(0x202), machine.PC())
+
+    stopped, err = debugger.ContinueFrame(true, func() bool { return machine.PC() == 0x204 })
+    assert.NoError(err)
+    assert.True(stopped)
+    assert.Equal(byte(1), machine.V()[1])
+
+    // Without a stop the frame runs to its end
+    debugger.ClearBreakpoint(0x202)
+    stopped, err = debugger.ContinueFrame(true, nil)
+    assert.NoError(err)
+    assert.False(stopped)
+}
+
+func TestDebuggerWatchpoint(t *testing.T) {
+    assert := assert.New(t)
+
+    // LD I, 0x300; ADD V0, 1; ST [I], V0; JP 0x202
+    machine, _ := NewMachine([]byte{0xA3, 0x00, 0x70, 0x01, 0xF0, 0x55, 0x12, 0x02})
+    debugger := NewDebugger(machine)
+
+    // Write watchpoints stop after the writing instruction
+    debugger.SetWatchpoint(0x300, 0x30F, Write)
+    assert.NoError(debugger.Continue())
+    assert.Equal(uint16(0x206), machine.PC())
+    assert.Equal(&MemoryAccess{Kind: Write, Addr: 0x300, Value: 1, PC: 0x204}, debugger.WatchHit())
+
+    assert.NoError(debugger.Continue())
+    assert.Equal(byte(2), machine.Memory()[0x300])
+
+    // Execute watchpoints stop before the instruction
+    assert.True(debugger.ClearWatchpoint(0x300))
+    debugger.SetWatchpoint(0x204, 0x205, Execute)
+    assert.NoError(debugger.Continue())
+    assert.Equal(uint16(0x204), machine.PC())
+    assert.Equal(Execute, debugger.WatchHit().Kind)
+
+    // Other stops clear the hit
+    assert.True(debugger.ClearWatchpoint(0x204))
+    assert.NoError(debugger.Step())
+    assert.Nil(debugger.WatchHit())
+    assert.Empty(debugger.Watchpoints())
+}
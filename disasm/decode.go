@@ -0,0 +1,171 @@
+// Package disasm decodes CHIP-8, SUPER-CHIP and XO-CHIP instructions into the mnemonics
+// used in the interpreter's opcode comments.
+package disasm
+
+import "fmt"
+
+type Instruction struct {
+    Addr   uint16 // Address of the first byte
+    Opcode uint16
+    Long   uint16 // Operand of F000 nnnn
+    Size   int    // 2 bytes, or 4 for F000 nnnn
+}
+
+// Decode the instruction at addr. Bytes past the end of memory read as zero.
+func Decode(memory []byte, addr int) Instruction {
+    word := func(a int) uint16 {
+        var hi, lo byte
+        if a < len(memory) {
+            hi = memory[a]
+        }
+        if a + 1 < len(memory) {
+            lo = memory[a + 1]
+        }
+        return uint16(hi) << 8 | uint16(lo)
+    }
+    in := Instruction{Addr: uint16(addr), Opcode: word(addr), Size: 2}
+    if in.Opcode == 0xF000 {
+        in.Long = word(addr + 2)
+        in.Size = 4
+    }
+    return in
+}
+
+func (in Instruction) x() uint16 {
+    return in.Opcode & 0x0F00 >> 8
+}
+
+func (in Instruction) y() uint16 {
+    return in.Opcode & 0x00F0 >> 4
+}
+
+func (in Instruction) n() uint16 {
+    return in.Opcode & 0x000F
+}
+
+func (in Instruction) kk() uint16 {
+    return in.Opcode & 0x00FF
+}
+
+func (in Instruction) nnn() uint16 {
+    return in.Opcode & 0x0FFF
+}
+
+// Whether the opcode decodes to a known instruction
+func (in Instruction) Valid() bool {
+    return in.mnemonic() != ""
+}
+
+// Mnemonic text, or a DW data directive for unknown opcodes
+func (in Instruction) String() string {
+    if text := in.mnemonic(); text != "" {
+        return text
+    }
+    return fmt.Sprintf("DW 0x%04X", in.Opcode)
+}
+
+// Mnemonic text, or empty for unknown opcodes
+func (in Instruction) mnemonic() string {
+    x, y, n, kk, nnn := in.x(), in.y(), in.n(), in.kk(), in.nnn()
+    switch in.Opcode & 0xF000 {
+    case 0x0000:
+        switch {
+        case in.Opcode & 0xFFF0 == 0x00C0:
+            return fmt.Sprintf("SCD %d", n)
+        case in.Opcode & 0xFFF0 == 0x00D0:
+            return fmt.Sprintf("SCU %d", n)
+        }
+        switch in.Opcode {
+        case 0x00E0:
+            return "CLS"
+        case 0x00EE:
+            return "RET"
+        case 0x00FB:
+            return "SCR"
+        case 0x00FC:
+            return "SCL"
+        case 0x00FD:
+            return "EXIT"
+        case 0x00FE:
+            return "LOW"
+        case 0x00FF:
+            return "HIGH"
+        }
+    case 0x1000:
+        return fmt.Sprintf("JP 0x%03X", nnn)
+    case 0x2000:
+        return fmt.Sprintf("CALL 0x%03X", nnn)
+    case 0x3000:
+        return fmt.Sprintf("SE V%X, 0x%02X", x, kk)
+    case 0x4000:
+        return fmt.Sprintf("SNE V%X, 0x%02X", x, kk)
+    case 0x5000:
+        switch n {
+        case 0x0:
+            return fmt.Sprintf("SE V%X, V%X", x, y)
+        case 0x2:
+            return fmt.Sprintf("ST [I], V%X - V%X", x, y)
+        case 0x3:
+            return fmt.Sprintf("LD V%X - V%X, [I]", x, y)
+        }
+    case 0x6000:
+        return fmt.Sprintf("LD V%X, 0x%02X", x, kk)
+    case 0x7000:
+        return fmt.Sprintf("ADD V%X, 0x%02X", x, kk)
+    case 0x8000:
+        names := map[uint16]string {
+            0x0: "MV", 0x1: "OR", 0x2: "AND", 0x3: "XOR", 0x4: "ADD",
+            0x5: "SUB", 0x6: "SHR", 0x7: "SUBN", 0xE: "SHL",
+        }
+        if name, ok := names[n]; ok {
+            return fmt.Sprintf("%s V%X, V%X", name, x, y)
+        }
+    case 0x9000:
+        if n == 0 {
+            return fmt.Sprintf("SNE V%X, V%X", x, y)
+        }
+    case 0xA000:
+        return fmt.Sprintf("LD I, 0x%03X", nnn)
+    case 0xB000:
+        return fmt.Sprintf("JP V0, 0x%03X", nnn)
+    case 0xC000:
+        return fmt.Sprintf("RND V%X, 0x%02X", x, kk)
+    case 0xD000:
+        return fmt.Sprintf("DRW V%X, V%X, %d", x, y, n)
+    case 0xE000:
+        switch kk {
+        case 0x9E:
+            return fmt.Sprintf("SKP V%X", x)
+        case 0xA1:
+            return fmt.Sprintf("SKNP V%X", x)
+        }
+    case 0xF000:
+        switch {
+        case in.Opcode == 0xF000:
+            return fmt.Sprintf("LD I, long 0x%04X", in.Long)
+        case kk == 0x01 && x <= 3:
+            return fmt.Sprintf("PLANE %d", x)
+        case in.Opcode == 0xF002:
+            return "AUDIO"
+        }
+        formats := map[uint16]string {
+            0x07: "ST V%X, DT",
+            0x0A: "LD V%X, K",
+            0x15: "MV DT, V%X",
+            0x18: "MV ST, V%X",
+            0x1E: "ADD I, V%X",
+            0x29: "LD F, V%X",
+            0x30: "LD HF, V%X",
+            0x33: "ST B, V%X",
+            0x3A: "PITCH V%X",
+            0x55: "ST [I], V%X",
+            0x65: "LD V%X, [I]",
+            0x75: "LD R, V%X",
+            0x85: "LD V%X, R",
+        }
+        if format, ok := formats[kk]; ok {
+            return fmt.Sprintf(format, x)
+        }
+    }
+    return ""
+}
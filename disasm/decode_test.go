@@ -0,0 +1,48 @@
+package disasm
+
+import (
+    "github.com/stretchr/testify/assert"
+    "testing"
+)
+
+func TestDecodeMnemonics(t *testing.T) {
+    assert := assert.New(t)
+
+    cases := map[uint16]string {
+        0x00E0: "CLS",
+        0x00C3: "SCD 3",
+        0x1228: "JP 0x228",
+        0x2300: "CALL 0x300",
+        0x3A12: "SE VA, 0x12",
+        0x5120: "SE V1, V2",
+        0x5342: "ST [I], V3 - V4",
+        0x8126: "SHR V1, V2",
+        0xA123: "LD I, 0x123",
+        0xB200: "JP V0, 0x200",
+        0xD125: "DRW V1, V2, 5",
+        0xE49E: "SKP V4",
+        0xF301: "PLANE 3",
+        0xF50A: "LD V5, K",
+        0xF265: "LD V2, [I]",
+        0x5121: "DW 0x5121",
+        0x8008: "DW 0x8008",
+    }
+    for opcode, text := range cases {
+        in := Decode([]byte{byte(opcode >> 8), byte(opcode)}, 0)
+        assert.Equal(text, in.String())
+        assert.Equal(text[:2] != "DW", in.Valid())
+    }
+}
+
+func TestDecodeLongLoad(t *testing.T) {
+    assert := assert.New(t)
+
+    in := Decode([]byte{0x00, 0x00, 0xF0, 0x00, 0x12, 0x34}, 2)
+    assert.Equal(4, in.Size)
+    assert.Equal(uint16(2), in.Addr)
+    assert.Equal("LD I, long 0x1234", in.String())
+
+    // Truncated operand reads as zero
+    in = Decode([]byte{0xF0, 0x00}, 0)
+    assert.Equal(uint16(0), in.Long)
+}
@@ -0,0 +1,228 @@
+package disasm
+
+import (
+    "bytes"
+    "fmt"
+    "sort"
+    "strings"
+)
+
+// Bytes per DB line in a listing
+const dataPerLine = 8
+
+// A ROM separated into code and data by following control flow from its entry points
+type Program struct {
+    Origin uint16 // Address of the first byte
+    Bytes  []byte
+    code   map[uint16]Instruction // Instructions reached from an entry point
+    labels map[uint16]string
+}
+
+// Disassemble bytes loaded at origin. Code is found by recursive descent from the entry
+// points, following jumps, calls and both outcomes of skips. Bytes never reached are data.
+// With no entry points given, execution starts at origin.
+func Disassemble(rom []byte, origin uint16, entries ...uint16) *Program {
+    p := &Program{Origin: origin, Bytes: rom, code: map[uint16]Instruction{}, labels: map[uint16]string{}}
+    if len(entries) == 0 {
+        entries = []uint16{origin}
+    }
+    pending := append([]uint16{}, entries...)
+    for len(pending) > 0 {
+        addr := pending[len(pending) - 1]
+        pending = pending[:len(pending) - 1]
+        pending = append(pending, p.trace(addr)...)
+    }
+    p.pruneLabels()
+    return p
+}
+
+// Whether addr lies within the program
+func (p *Program) contains(addr uint16) bool {
+    return addr >= p.Origin && int(addr) - int(p.Origin) < len(p.Bytes)
+}
+
+func (p *Program) decode(addr uint16) Instruction {
+    in := Decode(p.Bytes, int(addr - p.Origin))
+    in.Addr = addr
+    return in
+}
+
+// Follow straight-line code from addr, returning branch targets still to visit
+func (p *Program) trace(addr uint16) []uint16 {
+    var targets []uint16
+    for p.contains(addr) {
+        if _, seen := p.code[addr]; seen {
+            break
+        }
+        in := p.decode(addr)
+        if !in.Valid() || !p.contains(addr + uint16(in.Size) - 1) {
+            break
+        }
+        p.code[addr] = in
+        next := addr + uint16(in.Size)
+
+        switch {
+        case in.Opcode & 0xF000 == 0x1000:
+            p.label(in.nnn(), "L")
+            return append(targets, in.nnn())
+        case in.Opcode & 0xF000 == 0x2000:
+            p.label(in.nnn(), "sub_")
+            targets = append(targets, in.nnn())
+        case in.Opcode & 0xF000 == 0xA000:
+            p.label(in.nnn(), "data_")
+        case in.Opcode == 0xF000:
+            p.label(in.Long, "data_")
+        case in.Opcode & 0xF000 == 0xB000:
+            // The target depends on a register, so only the table base is known
+            p.label(in.nnn(), "table_")
+            return targets
+        case in.Opcode == 0x00EE, in.Opcode == 0x00FD:
+            return targets
+        case in.skips():
+            // The skipped instruction may itself be a four byte long load
+            targets = append(targets, next + uint16(p.decode(next).Size))
+        }
+        addr = next
+    }
+    return targets
+}
+
+// Whether the instruction conditionally skips the next one
+func (in Instruction) skips() bool {
+    switch in.Opcode & 0xF000 {
+    case 0x3000, 0x4000:
+        return true
+    case 0x5000, 0x9000:
+        return in.n() == 0
+    case 0xE000:
+        return in.kk() == 0x9E || in.kk() == 0xA1
+    }
+    return false
+}
+
+// Name addr unless it already has a name. Call targets win over other kinds of label.
+func (p *Program) label(addr uint16, prefix string) {
+    if name, ok := p.labels[addr]; ok && (strings.HasPrefix(name, "sub_") || prefix != "sub_") {
+        return
+    }
+    p.labels[addr] = fmt.Sprintf("%s%03X", prefix, addr)
+}
+
+// Drop labels that can't be placed in a listing, because they lie outside the program or
+// inside an instruction
+func (p *Program) pruneLabels() {
+    boundaries := map[uint16]bool{}
+    for addr := p.Origin; p.contains(addr); {
+        boundaries[addr] = true
+        if in, ok := p.code[addr]; ok {
+            addr += uint16(in.Size)
+        } else {
+            addr++
+        }
+        if addr == 0 {
+            break
+        }
+    }
+    for addr := range p.labels {
+        if !boundaries[addr] {
+            delete(p.labels, addr)
+        }
+    }
+}
+
+// Whether an instruction starts at addr
+func (p *Program) IsCode(addr uint16) bool {
+    _, ok := p.code[addr]
+    return ok
+}
+
+// Instruction starting at addr, if addr was reached as code
+func (p *Program) Instruction(addr uint16) (Instruction, bool) {
+    in, ok := p.code[addr]
+    return in, ok
+}
+
+// Label generated for addr, if any
+func (p *Program) Label(addr uint16) (string, bool) {
+    name, ok := p.labels[addr]
+    return name, ok
+}
+
+// Labelled addresses in ascending order
+func (p *Program) Labels() []uint16 {
+    addrs := []uint16{}
+    for addr := range p.labels {
+        addrs = append(addrs, addr)
+    }
+    sort.Slice(addrs, func(i, j int) bool {
+        return addrs[i] < addrs[j]
+    })
+    return addrs
+}
+
+// Mnemonic text with branch and load targets replaced by their labels
+func (p *Program) text(in Instruction) string {
+    if in.Opcode == 0xF000 {
+        if name, ok := p.labels[in.Long]; ok {
+            return "LD I, long " + name
+        }
+        return in.String()
+    }
+    name, ok := p.labels[in.nnn()]
+    if !ok {
+        return in.String()
+    }
+    switch in.Opcode & 0xF000 {
+    case 0x1000:
+        return "JP " + name
+    case 0x2000:
+        return "CALL " + name
+    case 0xA000:
+        return "LD I, " + name
+    case 0xB000:
+        return "JP V0, " + name
+    }
+    return in.String()
+}
+
+// Assembly listing with labels, code and DB data directives. Each line is commented with
+// its address and the bytes it covers.
+func (p *Program) String() string {
+    var buf bytes.Buffer
+    line := func(text string, addr uint16, raw []byte) {
+        fmt.Fprintf(&buf, "    %-24s ; %03X: % X\n", text, addr, raw)
+    }
+    for addr := p.Origin; p.contains(addr); {
+        if name, ok := p.labels[addr]; ok {
+            fmt.Fprintf(&buf, "%s:\n", name)
+        }
+        offset := int(addr - p.Origin)
+        if in, ok := p.code[addr]; ok {
+            line(p.text(in), addr, p.Bytes[offset:offset + in.Size])
+            addr += uint16(in.Size)
+        } else {
+            // Data runs until the next instruction or label
+            n := 1
+            for n < dataPerLine && offset + n < len(p.Bytes) {
+                next := addr + uint16(n)
+                if _, isLabel := p.labels[next]; isLabel || p.IsCode(next) {
+                    break
+                }
+                n++
+            }
+            text := "DB"
+            for k, b := range p.Bytes[offset:offset + n] {
+                if k > 0 {
+                    text += ","
+                }
+                text += fmt.Sprintf(" 0x%02X", b)
+            }
+            line(text, addr, p.Bytes[offset:offset + n])
+            addr += uint16(n)
+        }
+        if addr == 0 {
+            break
+        }
+    }
+    return buf.String()
+}
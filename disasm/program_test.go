@@ -0,0 +1,68 @@
+package disasm
+
+import (
+    "github.com/stretchr/testify/assert"
+    "testing"
+)
+
+func TestDisassembleFollowsControlFlow(t *testing.T) {
+    assert := assert.New(t)
+
+    rom := []byte{
+        0xA2, 0x0C, // 200: LD I, data_20C
+        0x22, 0x08, // 202: CALL sub_208
+        0x12, 0x02, // 204: JP L202
+        0xFF, 0xFF, // 206: unreachable
+        0x30, 0x01, // 208: SE V0, 0x01
+        0x00, 0xEE, // 20A: RET
+        0x3C, 0x42, // 20C: skip target, decodes as SE VC, 0x42
+    }
+    p := Disassemble(rom, 0x200)
+
+    for _, addr := range []uint16{0x200, 0x202, 0x204, 0x208, 0x20A} {
+        assert.True(p.IsCode(addr), "%03X", addr)
+    }
+    assert.False(p.IsCode(0x206))
+    // Both outcomes of the skip are followed
+    assert.True(p.IsCode(0x20C))
+    assert.Equal([]uint16{0x202, 0x208, 0x20C}, p.Labels())
+
+    name, _ := p.Label(0x208)
+    assert.Equal("sub_208", name)
+    in, _ := p.Instruction(0x204)
+    assert.Equal("JP L202", p.text(in))
+}
+
+func TestDisassembleListing(t *testing.T) {
+    assert := assert.New(t)
+
+    rom := []byte{
+        0xA2, 0x04, // 200: LD I, data_204
+        0x00, 0xFD, // 202: EXIT
+        0x3C, 0x42, 0x81, // 204: sprite data
+    }
+    assert.Equal(
+        "    LD I, data_204           ; 200: A2 04\n" +
+        "    EXIT                     ; 202: 00 FD\n" +
+        "data_204:\n" +
+        "    DB 0x3C, 0x42, 0x81      ; 204: 3C 42 81\n",
+        Disassemble(rom, 0x200).String())
+}
+
+func TestDisassembleSkipsLongLoad(t *testing.T) {
+    assert := assert.New(t)
+
+    rom := []byte{
+        0x30, 0x00, // 200: SE V0, 0x00
+        0xF0, 0x00, 0x02, 0x0A, // 202: LD I, long 0x020A
+        0x00, 0xE0, // 206: CLS
+        0x12, 0x06, // 208: JP 0x206
+        0x01, // 20A
+    }
+    p := Disassemble(rom, 0x200)
+    assert.True(p.IsCode(0x202))
+    assert.True(p.IsCode(0x206))
+    assert.False(p.IsCode(0x204))
+    in, _ := p.Instruction(0x202)
+    assert.Equal("LD I, long data_20A", p.text(in))
+}
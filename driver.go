@@ -1,86 +1,184 @@
 package chip8
 
 import (
+    "fmt"
     "io/ioutil"
+    "log"
     "time"
 )
 
-// Update approximately 60 times a second
-const msPerTick = 16
+// Frames, and the timer updates that end them, happen this many times a second
+const ticksPerSecond = 60
 
+// Instructions executed per second unless changed with SetSpeed
+const DefaultSpeed = 500
+
+// Driver runs a Machine in real time against a Window
 type Driver struct {
-    context *Context
-}
-
-func NewDriver(window Window, romPath string) *Driver {
-    // Initialize memory with font sprites
-    memory := [4096]byte {
-        0xF0, 0x90, 0x90, 0x90, 0xF0, // 0
-        0x20, 0x60, 0x20, 0x20, 0x70, // 1
-        0xF0, 0x10, 0xF0, 0x80, 0xF0, // 2
-        0xF0, 0x10, 0xF0, 0x10, 0xF0, // 3
-        0x90, 0x90, 0xF0, 0x10, 0x10, // 4
-        0xF0, 0x80, 0xF0, 0x10, 0xF0, // 5
-        0xF0, 0x80, 0xF0, 0x90, 0xF0, // 6
-        0xF0, 0x10, 0x20, 0x40, 0x40, // 7
-        0xF0, 0x90, 0xF0, 0x90, 0xF0, // 8
-        0xF0, 0x90, 0xF0, 0x10, 0xF0, // 9
-        0xF0, 0x90, 0xF0, 0x90, 0x90, // A
-        0xE0, 0x90, 0xE0, 0x90, 0xE0, // B
-        0xF0, 0x80, 0x80, 0x80, 0xF0, // C
-        0xE0, 0x90, 0x90, 0x90, 0xE0, // D
-        0xF0, 0x80, 0xF0, 0x80, 0xF0, // E
-        0xF0, 0x80, 0xF0, 0x80, 0x80, // F
-    }
+    machine    *Machine
+    window     Window
+    stateSlots string // Base path for quick save slots, empty to disable them
+    rewinder   *Rewinder
+    keymapFile string // Where keys remapped in the window are saved, empty to not save them
+    gdb        *GDBStub
+}
 
+func NewDriver(window Window, romPath string) (*Driver, error) {
     rom, err := ioutil.ReadFile(romPath)
     if err != nil {
-        panic("Could not read ROM: " + err.Error())
+        return nil, &ROMError{Path: romPath, Err: err}
     }
 
-    // Max acceptable size of ROM is 4096 - 512 bytes
-    if len(rom) > 3584 {
-        panic("ROM image exceeds maximum size of 3584 bytes")
+    machine, err := NewMachine(rom)
+    if err != nil {
+        return nil, &ROMError{Path: romPath, Err: err}
     }
-    copy(memory[0x200:], rom)
+    return NewMachineDriver(window, machine), nil
+}
+
+// Driver for a machine that is already set up, such as one running compiled source
+func NewMachineDriver(window Window, machine *Machine) *Driver {
+    machine.SetWindow(window)
+    return &Driver{machine: machine, window: window}
+}
+
+func (d *Driver) Machine() *Machine {
+    return d.machine
+}
 
-    context := newContext(newCPU(), window, memory)
-    return &Driver{context: context}
+// Enable quick save slots for windows with StateHotkeys. Slot n is stored in the file
+// base + ".state" + n.
+func (d *Driver) SetStateSlots(base string) {
+    d.stateSlots = base
+}
+
+// Record every frame so that holding the window's RewindKey runs the game backwards. Nil
+// disables rewinding.
+func (d *Driver) SetRewinder(rewinder *Rewinder) {
+    d.rewinder = rewinder
+}
+
+func (d *Driver) rewinding() bool {
+    key, ok := d.window.(RewindKey)
+    return ok && d.rewinder != nil && key.RewindHeld()
+}
+
+// Let GDB clients attach to the machine while the driver runs it. The stub's debugger
+// must be for the driver's machine.
+func (d *Driver) SetGDBStub(stub *GDBStub) {
+    d.gdb = stub
+}
+
+// Run a frame, or hand it to the GDB stub which decides whether the machine runs.
+// Returns whether the machine ran.
+func (d *Driver) runFrame() (bool, error) {
+    if d.gdb != nil {
+        return d.gdb.runFrame()
+    }
+    return true, d.machine.runFrame()
 }
 
-func (d *Driver) Run() {
-    window := d.context.window
+// Save the keymap when the player remaps keys in windows with KeyRemapping
+func (d *Driver) SetKeymapFile(path string) {
+    d.keymapFile = path
+}
+
+func (d *Driver) handleRemap() {
+    remapping, ok := d.window.(KeyRemapping)
+    if !ok {
+        return
+    }
+    if keymap := remapping.RemappedKeys(); keymap != nil && d.keymapFile != "" {
+        if err := keymap.SaveFile(d.keymapFile); err != nil {
+            log.Printf("chip8: could not save keymap: %v", err)
+        }
+    }
+}
+
+// Save and load the slots the player asked for. Failures are logged rather than ending
+// the game.
+func (d *Driver) handleStateRequests() {
+    hotkeys, ok := d.window.(StateHotkeys)
+    if !ok {
+        return
+    }
+    for _, request := range hotkeys.StateRequests() {
+        if d.stateSlots == "" {
+            continue
+        }
+        path := fmt.Sprintf("%s.state%d", d.stateSlots, request.Slot)
+        if request.Save {
+            if err := d.machine.SaveStateFile(path); err != nil {
+                log.Printf("chip8: could not save state: %v", err)
+            }
+        } else if err := d.machine.LoadStateFile(path); err != nil {
+            log.Printf("chip8: could not load state %s: %v", path, err)
+        }
+    }
+}
+
+// Set the number of instructions executed per second. Timers always run at 60 Hz.
+func (d *Driver) SetSpeed(speed int) {
+    d.machine.SetSpeed(speed)
+}
+
+// Run until the window closes, the program exits or the program faults
+func (d *Driver) Run() error {
+    if d.gdb != nil {
+        defer d.gdb.finish()
+    }
+    cpu := d.machine.context.cpu
     prev := time.Now().UnixNano() / 1000000
-    d.context.cpu.delay = 0
+    cpu.delay = 0
 
-    for !window.ShouldClose() {
+    for !d.window.ShouldClose() {
         now := time.Now().UnixNano() / 1000000
-        d.context.cpu.delay += now - prev
+        cpu.delay += (now - prev) * ticksPerSecond
         prev = now
 
-        window.Update()
+        d.window.Update()
+        d.handleStateRequests()
+        d.handleRemap()
 
-        // Processing opcodes and updating timers happen each tick
-        for d.context.cpu.delay >= msPerTick {
-            d.updateTimers()
-            d.runNextOpcode()
-            d.context.cpu.delay -= msPerTick
+        for cpu.delay >= 1000 {
+            cpu.delay -= 1000
+            if d.rewinding() {
+                d.rewinder.Rewind()
+                continue
+            }
+            ran, err := d.runFrame()
+            if err == ErrExit {
+                return nil
+            } else if err != nil {
+                return err
+            }
+            // A machine held by a GDB client has nothing new to record
+            if ran && d.rewinder != nil {
+                d.rewinder.Record()
+            }
         }
     }
+    return nil
 }
 
-func (d *Driver) updateTimers() {
-    if d.context.cpu.dt > 0 {
-        d.context.cpu.dt--
+// Run frames back to back without waiting for real time, until the window closes, the
+// program exits or the program faults
+func (d *Driver) RunFast() error {
+    if d.gdb != nil {
+        defer d.gdb.finish()
     }
-    if d.context.cpu.st > 0 {
-        d.context.cpu.st--
+    for !d.window.ShouldClose() {
+        d.window.Update()
+        if _, err := d.runFrame(); err == ErrExit {
+            return nil
+        } else if err != nil {
+            return err
+        }
     }
+    return nil
 }
 
-func (d *Driver) runNextOpcode() {
-    memory := d.context.memory
-    cpu := d.context.cpu
-    d.context.opcode = uint16(memory[cpu.pc]) << 8 | uint16(memory[cpu.pc + 1])
-    runOpcode(d.context)
+// Execute a single instruction without touching the timers
+func (d *Driver) Step() error {
+    return d.machine.Step()
 }
@@ -0,0 +1,30 @@
+package chip8
+
+import (
+    "github.com/stretchr/testify/assert"
+    "io/ioutil"
+    "os"
+    "testing"
+)
+
+func TestNewDriverMissingROM(t *testing.T) {
+    assert := assert.New(t)
+
+    _, err := NewDriver(new(HeadlessWindow), "does-not-exist.ch8")
+    romErr, ok := err.(*ROMError)
+    assert.True(ok)
+    assert.Equal("does-not-exist.ch8", romErr.Path)
+}
+
+func TestNewDriverROMTooLarge(t *testing.T) {
+    assert := assert.New(t)
+
+    file, err := ioutil.TempFile("", "chip8")
+    assert.NoError(err)
+    defer os.Remove(file.Name())
+    file.Write(make([]byte, maxROMSize + 1))
+    file.Close()
+
+    _, err = NewDriver(new(HeadlessWindow), file.Name())
+    assert.Equal(&ROMError{Path: file.Name(), Err: ErrROMTooLarge}, err)
+}
@@ -0,0 +1,83 @@
+package chip8
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+)
+
+var ErrROMTooLarge = errors.New("ROM image exceeds maximum size of 3584 bytes")
+
+var ErrXOChipROMTooLarge = errors.New("XO-CHIP ROM image exceeds maximum size of 65024 bytes")
+
+// Data given to LoadState is not a save state
+var ErrNotSaveState = errors.New("not a chip8 save state")
+
+// Data given to ReadMovie is not a movie
+var ErrNotMovie = errors.New("not a chip8 movie")
+
+// Movie was recorded with a different ROM than the one given to Replay
+var ErrMovieROM = errors.New("movie was recorded with a different ROM")
+
+// Replaying a movie did not end on the screen it was recorded with
+var ErrReplayMismatch = errors.New("replay did not reproduce the recorded screen")
+
+// Data given to NewTraceReader is not a binary trace
+var ErrNotTrace = errors.New("not a chip8 trace")
+
+// Returned when the program executes the SUPER-CHIP EXIT instruction
+var ErrExit = errors.New("program exited")
+
+// ROM image could not be read or does not fit in memory
+type ROMError struct {
+    Path string
+    Err  error
+}
+
+func (e *ROMError) Error() string {
+    return fmt.Sprintf("could not load ROM %s: %v", e.Path, e.Err)
+}
+
+func (e *ROMError) Unwrap() error {
+    return e.Err
+}
+
+// Opcode at PC is not a recognized instruction
+type IllegalInstructionError struct {
+    PC     uint16
+    Opcode uint16
+}
+
+func (e *IllegalInstructionError) Error() string {
+    return fmt.Sprintf("illegal instruction %04X at %03X", e.Opcode, e.PC)
+}
+
+// CALL with a full stack or RET with an empty one
+type StackError struct {
+    PC       uint16
+    Overflow bool // Overflow if true, underflow otherwise
+    SP       byte
+    Stack    [16]uint16 // Entries 0 through SP-1 are in use
+}
+
+func (e *StackError) Error() string {
+    kind := "underflow"
+    if e.Overflow {
+        kind = "overflow"
+    }
+    entries := make([]string, 0, len(e.Stack))
+    for k := 0; k < int(e.SP) && k < len(e.Stack); k++ {
+        entries = append(entries, fmt.Sprintf("%03X", e.Stack[k]))
+    }
+    return fmt.Sprintf("stack %s at %03X, stack [%s]", kind, e.PC, strings.Join(entries, " "))
+}
+
+// Instruction at PC accessed an address outside of memory
+type MemoryError struct {
+    PC      uint16
+    Address int
+}
+
+func (e *MemoryError) Error() string {
+    return fmt.Sprintf("memory access out of bounds at %03X: address %X", e.PC, e.Address)
+}
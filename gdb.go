@@ -0,0 +1,578 @@
+package chip8
+
+import (
+    "bufio"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "log"
+    "net"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Registers in the order of GDB register numbers, with their sizes in bytes: V0-VF, then
+// I, PC, SP, DT and ST
+const (
+    gdbI  = 16 + iota
+    gdbPC
+    gdbSP
+    gdbDT
+    gdbST
+    gdbRegisters
+)
+
+// Target description that tells GDB the register layout
+const gdbTargetXML = `<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+<feature name="org.chip8.core">
+%s</feature>
+</target>
+`
+
+func gdbRegisterSize(n int) int {
+    if n == gdbI || n == gdbPC {
+        return 2
+    }
+    return 1
+}
+
+func gdbRegisterName(n int) string {
+    if n < 16 {
+        return fmt.Sprintf("v%x", n)
+    }
+    return []string{"i", "pc", "sp", "dt", "st"}[n - 16]
+}
+
+// GDBStub serves the GDB remote serial protocol for a machine, so gdb compatible front
+// ends can inspect registers and memory, set breakpoints and watchpoints, step and
+// continue. The machine keeps running on its own goroutine, normally a Driver's: the
+// protocol is handled on the connection's goroutine and every access to the machine is
+// handed to the driver, which runs it between frames. The machine halts while a client is
+// attached, until the client continues it. Machines with the StackTrap policy also halt at
+// a stack fault and wait for a client.
+type GDBStub struct {
+    debugger *Debugger
+    calls    chan func()   // Run on the machine's goroutine
+    stops    chan string   // Stop replies for a continue, sent by the machine's goroutine
+    done     chan struct{} // Closed once the machine stops running for good
+    attached bool         // Whether a client controls the machine. Machine's goroutine only.
+    running  bool         // Whether the client continued the machine. Machine's goroutine only.
+    resume   bool         // Whether the next frame resumes from a stop
+    killed   bool
+    trap     error        // Stack fault that stopped the machine before a client attached
+    noAck    bool
+}
+
+func NewGDBStub(debugger *Debugger) *GDBStub {
+    return &GDBStub{debugger: debugger, calls: make(chan func()), stops: make(chan string, 1),
+                    done: make(chan struct{})}
+}
+
+// Keep the machine halted until a client attaches and continues it, as gdbserver does.
+// Call before the driver starts.
+func (s *GDBStub) Halt() {
+    s.attached, s.running = true, false
+}
+
+// Called by the driver when it stops running the machine, after which clients are
+// disconnected
+func (s *GDBStub) finish() {
+    close(s.done)
+}
+
+// Serve clients from a listener, one at a time, until accepting fails
+func (s *GDBStub) ServeListener(listener net.Listener) error {
+    for {
+        conn, err := listener.Accept()
+        if err != nil {
+            return err
+        }
+        if err := s.Serve(conn); err != nil {
+            log.Printf("chip8: gdb connection: %v", err)
+        }
+        conn.Close()
+    }
+}
+
+// Run f on the machine's goroutine and wait for it. Returns false without running f if
+// the machine is no longer running.
+func (s *GDBStub) do(f func()) bool {
+    done := make(chan struct{})
+    call := func() {
+        f()
+        close(done)
+    }
+    select {
+    case s.calls <- call:
+        <-done
+        return true
+    case <-s.done:
+        return false
+    }
+}
+
+// Run a frame for the driver, or let the client inspect the machine while it is halted.
+// Returns ErrExit once the client kills the program, and whether the machine ran.
+func (s *GDBStub) runFrame() (bool, error) {
+    for drained := false; !drained; {
+        select {
+        case call := <-s.calls:
+            call()
+        default:
+            drained = true
+        }
+    }
+    if s.killed {
+        return false, ErrExit
+    }
+    if !s.attached {
+        err := s.debugger.machine.runFrame()
+        if _, ok := err.(*StackError); ok && s.debugger.machine.StackPolicy() == StackTrap {
+            // Hold the machine at the fault until a client attaches to look at it
+            s.attached, s.running, s.trap = true, false, err
+            return false, nil
+        }
+        return true, err
+    }
+    if !s.running {
+        // Wait a frame for the client, then let the driver update the window
+        select {
+        case call := <-s.calls:
+            call()
+        case <-time.After(time.Second / ticksPerSecond):
+        }
+        return false, nil
+    }
+
+    stopped, err := s.debugger.ContinueFrame(s.resume, nil)
+    s.resume = false
+    if err == ErrExit {
+        s.running = false
+        s.stops <- "W00"
+        return true, err
+    }
+    if stopped || err != nil {
+        s.running = false
+        s.stops <- s.stopReply(err)
+    }
+    return true, nil
+}
+
+// Why the machine stopped, as a stop reply packet
+func (s *GDBStub) stopReply(err error) string {
+    switch err.(type) {
+    case nil:
+    case *IllegalInstructionError:
+        return "S04" // SIGILL
+    default:
+        if err == ErrExit {
+            return "W00"
+        }
+        return "S0b" // SIGSEGV
+    }
+    if hit := s.debugger.WatchHit(); hit != nil {
+        switch hit.Kind {
+        case Write:
+            return fmt.Sprintf("T05watch:%x;", hit.Addr)
+        case Read:
+            return fmt.Sprintf("T05rwatch:%x;", hit.Addr)
+        }
+    }
+    return "S05" // SIGTRAP
+}
+
+// Packet or interrupt read from the client
+type gdbInput struct {
+    packet    string
+    valid     bool // Whether the checksum matched
+    interrupt bool
+    err       error
+}
+
+// Read packets from the client until the connection fails or quit is closed
+func readGDB(r *bufio.Reader, input chan<- gdbInput, quit <-chan struct{}) {
+    deliver := func(in gdbInput) bool {
+        select {
+        case input <- in:
+            return in.err == nil
+        case <-quit:
+            return false
+        }
+    }
+    for {
+        b, err := r.ReadByte()
+        if err != nil {
+            deliver(gdbInput{err: err})
+            return
+        }
+        in := gdbInput{interrupt: b == 0x03}
+        if b == '$' {
+            data, err := r.ReadString('#')
+            var sum [2]byte
+            if err == nil {
+                _, err = io.ReadFull(r, sum[:])
+            }
+            if err != nil {
+                deliver(gdbInput{err: err})
+                return
+            }
+            in.packet = data[:len(data) - 1]
+            checksum, err := strconv.ParseUint(string(sum[:]), 16, 8)
+            in.valid = err == nil && byte(checksum) == gdbChecksum(in.packet)
+        } else if !in.interrupt {
+            // Acknowledgements are ignored, packets are never resent
+            continue
+        }
+        if !deliver(in) {
+            return
+        }
+    }
+}
+
+func gdbChecksum(data string) byte {
+    var sum byte
+    for k := 0; k < len(data); k++ {
+        sum += data[k]
+    }
+    return sum
+}
+
+// Serve one client until it detaches, kills the program or disconnects. The machine
+// resumes running on its own when the client leaves without killing it.
+func (s *GDBStub) Serve(conn io.ReadWriter) error {
+    input := make(chan gdbInput)
+    quit := make(chan struct{})
+    defer close(quit)
+    go readGDB(bufio.NewReader(conn), input, quit)
+    s.noAck = false
+    // Packets from here on are answered with W00 if the program has already ended
+    s.do(func() {
+        s.attached, s.running = true, false
+        // Drop the reply to a continue whose client left without waiting for it
+        select {
+        case <-s.stops:
+        default:
+        }
+    })
+    defer s.do(func() {
+        s.attached, s.running = false, false
+    })
+
+    send := func(packet string) error {
+        _, err := fmt.Fprintf(conn, "$%s#%02x", packet, gdbChecksum(packet))
+        return err
+    }
+    for {
+        in := <-input
+        if in.err != nil {
+            if in.err == io.EOF {
+                return nil
+            }
+            return in.err
+        }
+        if in.interrupt {
+            // Already halted unless continuing, which handles interrupts itself
+            continue
+        }
+        if !s.noAck {
+            ack := "+"
+            if !in.valid {
+                ack = "-"
+            }
+            if _, err := io.WriteString(conn, ack); err != nil {
+                return err
+            }
+        }
+        if !in.valid {
+            continue
+        }
+
+        switch {
+        case strings.HasPrefix(in.packet, "c"):
+            if !s.do(func() { s.running, s.resume, s.trap = true, true, nil }) {
+                return send("W00")
+            }
+            reply, err := s.waitForStop(input)
+            if err != nil {
+                return err
+            }
+            if err := send(reply); err != nil {
+                return err
+            }
+            continue
+        case in.packet == "D":
+            return send("OK")
+        case in.packet == "k":
+            s.do(func() {
+                s.killed = true
+            })
+            return nil
+        }
+        var reply string
+        if !s.do(func() { reply = s.command(in.packet) }) {
+            // The program ended while the client was attached
+            return send("W00")
+        }
+        if err := send(reply); err != nil {
+            return err
+        }
+        if in.packet == "QStartNoAckMode" {
+            s.noAck = true
+        }
+    }
+}
+
+// Wait for a continued machine to stop, halting it if the client interrupts
+func (s *GDBStub) waitForStop(input <-chan gdbInput) (string, error) {
+    for {
+        select {
+        case reply := <-s.stops:
+            return reply, nil
+        case <-s.done:
+            return "W00", nil
+        case in := <-input:
+            if in.err != nil {
+                return "", in.err
+            }
+            if !in.interrupt {
+                continue
+            }
+            var reply string
+            s.do(func() {
+                if s.running {
+                    s.running = false
+                    reply = "S02" // SIGINT
+                }
+            })
+            // The machine may have stopped by itself, or ended, as the interrupt arrived
+            if reply != "" {
+                return reply, nil
+            }
+        }
+    }
+}
+
+// Reply to a packet other than continuing. Runs on the machine's goroutine.
+func (s *GDBStub) command(packet string) string {
+    c := s.debugger.machine.context
+    cpu := c.cpu
+    switch {
+    case packet == "?":
+        if s.trap != nil {
+            return s.stopReply(s.trap)
+        }
+        return "S05"
+    case packet == "g":
+        var regs []byte
+        for n := 0; n < gdbRegisters; n++ {
+            regs = append(regs, s.register(n)...)
+        }
+        return hex.EncodeToString(regs)
+    case strings.HasPrefix(packet, "G"):
+        data, err := hex.DecodeString(packet[1:])
+        if err != nil {
+            return "E01"
+        }
+        for n := 0; n < gdbRegisters && len(data) >= gdbRegisterSize(n); n++ {
+            if !s.setRegister(n, data[:gdbRegisterSize(n)]) {
+                return "E01"
+            }
+            data = data[gdbRegisterSize(n):]
+        }
+        return "OK"
+    case strings.HasPrefix(packet, "p"):
+        n, err := strconv.ParseUint(packet[1:], 16, 8)
+        if err != nil || n >= gdbRegisters {
+            return "E01"
+        }
+        return hex.EncodeToString(s.register(int(n)))
+    case strings.HasPrefix(packet, "P"):
+        fields := strings.SplitN(packet[1:], "=", 2)
+        n, err := strconv.ParseUint(fields[0], 16, 8)
+        if err != nil || n >= gdbRegisters || len(fields) != 2 {
+            return "E01"
+        }
+        data, err := hex.DecodeString(fields[1])
+        if err != nil || len(data) != gdbRegisterSize(int(n)) || !s.setRegister(int(n), data) {
+            return "E01"
+        }
+        return "OK"
+    case strings.HasPrefix(packet, "m"):
+        addr, length, ok := parseGDBRange(packet[1:])
+        if !ok {
+            return "E01"
+        }
+        return hex.EncodeToString(c.memory[addr:addr + length])
+    case strings.HasPrefix(packet, "M"):
+        fields := strings.SplitN(packet[1:], ":", 2)
+        addr, length, ok := parseGDBRange(fields[0])
+        if !ok || len(fields) != 2 {
+            return "E01"
+        }
+        data, err := hex.DecodeString(fields[1])
+        if err != nil || len(data) != length {
+            return "E01"
+        }
+        copy(c.memory[addr:], data)
+        return "OK"
+    case strings.HasPrefix(packet, "s"):
+        if len(packet) > 1 {
+            addr, err := strconv.ParseUint(packet[1:], 16, 16)
+            if err != nil {
+                return "E01"
+            }
+            cpu.pc = uint16(addr)
+        }
+        s.trap = nil
+        return s.stopReply(s.debugger.Step())
+    case strings.HasPrefix(packet, "Z") || strings.HasPrefix(packet, "z"):
+        return s.breakpoint(packet)
+    case strings.HasPrefix(packet, "qSupported"):
+        return "PacketSize=4000;qXfer:features:read+;QStartNoAckMode+"
+    case strings.HasPrefix(packet, "qXfer:features:read:target.xml:"):
+        return s.targetXML(strings.TrimPrefix(packet, "qXfer:features:read:target.xml:"))
+    case packet == "QStartNoAckMode", strings.HasPrefix(packet, "H"), strings.HasPrefix(packet, "T"):
+        return "OK"
+    case packet == "qAttached":
+        return "1"
+    case packet == "qC":
+        return "QC1"
+    case packet == "qfThreadInfo":
+        return "m1"
+    case packet == "qsThreadInfo":
+        return "l"
+    }
+    // Empty replies tell the client the packet isn't supported
+    return ""
+}
+
+// Parse "addr,length" and check that it lies within memory
+func parseGDBRange(text string) (int, int, bool) {
+    fields := strings.SplitN(text, ",", 2)
+    if len(fields) != 2 {
+        return 0, 0, false
+    }
+    addr, err1 := strconv.ParseUint(fields[0], 16, 32)
+    length, err2 := strconv.ParseUint(fields[1], 16, 32)
+    if err1 != nil || err2 != nil || addr + length > 65536 {
+        return 0, 0, false
+    }
+    return int(addr), int(length), true
+}
+
+// Register value in target byte order, which is little endian
+func (s *GDBStub) register(n int) []byte {
+    cpu := s.debugger.machine.context.cpu
+    switch n {
+    case gdbI:
+        return []byte{byte(cpu.i), byte(cpu.i >> 8)}
+    case gdbPC:
+        return []byte{byte(cpu.pc), byte(cpu.pc >> 8)}
+    case gdbSP:
+        return []byte{cpu.sp}
+    case gdbDT:
+        return []byte{cpu.dt}
+    case gdbST:
+        return []byte{cpu.st}
+    }
+    return []byte{cpu.v[n]}
+}
+
+func (s *GDBStub) setRegister(n int, data []byte) bool {
+    cpu := s.debugger.machine.context.cpu
+    switch n {
+    case gdbI:
+        cpu.i = uint16(data[0]) | uint16(data[1]) << 8
+    case gdbPC:
+        cpu.pc = uint16(data[0]) | uint16(data[1]) << 8
+    case gdbSP:
+        if data[0] > 16 {
+            return false
+        }
+        cpu.sp = data[0]
+    case gdbDT:
+        cpu.dt = data[0]
+    case gdbST:
+        cpu.st = data[0]
+    default:
+        cpu.v[n] = data[0]
+    }
+    return true
+}
+
+// Z and z packets: type 0 and 1 set breakpoints, 2-4 write, read and access watchpoints
+func (s *GDBStub) breakpoint(packet string) string {
+    fields := strings.Split(packet[1:], ",")
+    if len(fields) < 2 {
+        return "E01"
+    }
+    addr, err := strconv.ParseUint(fields[1], 16, 16)
+    if err != nil {
+        return "E01"
+    }
+    length := uint64(1)
+    if len(fields) > 2 {
+        if length, err = strconv.ParseUint(fields[2], 16, 16); err != nil || length == 0 {
+            length = 1
+        }
+    }
+    set := packet[0] == 'Z'
+    kinds := map[string]Access{"2": Write, "3": Read, "4": Read | Write}
+    switch fields[0] {
+    case "0", "1":
+        if set {
+            s.debugger.SetBreakpoint(uint16(addr), nil)
+        } else {
+            s.debugger.ClearBreakpoint(uint16(addr))
+        }
+    case "2", "3", "4":
+        end := addr + length - 1
+        if end > 0xFFFF {
+            end = 0xFFFF
+        }
+        if set {
+            s.debugger.SetWatchpoint(uint16(addr), uint16(end), kinds[fields[0]])
+        } else {
+            s.debugger.ClearWatchpoint(uint16(addr))
+        }
+    default:
+        return ""
+    }
+    return "OK"
+}
+
+// Part of the target description given as "offset,length"
+func (s *GDBStub) targetXML(area string) string {
+    var regs strings.Builder
+    for n := 0; n < gdbRegisters; n++ {
+        kind := "uint8"
+        switch n {
+        case gdbI:
+            kind = "data_ptr"
+        case gdbPC:
+            kind = "code_ptr"
+        }
+        fmt.Fprintf(&regs, "<reg name=\"%s\" bitsize=\"%d\" type=\"%s\"/>\n", gdbRegisterName(n), 8 * gdbRegisterSize(n), kind)
+    }
+    xml := fmt.Sprintf(gdbTargetXML, regs.String())
+
+    fields := strings.SplitN(area, ",", 2)
+    if len(fields) != 2 {
+        return "E01"
+    }
+    offset, err1 := strconv.ParseUint(fields[0], 16, 32)
+    length, err2 := strconv.ParseUint(fields[1], 16, 32)
+    if err1 != nil || err2 != nil {
+        return "E01"
+    }
+    if offset >= uint64(len(xml)) {
+        return "l"
+    }
+    if offset + length >= uint64(len(xml)) {
+        return "l" + xml[offset:]
+    }
+    return "m" + xml[offset:offset + length]
+}
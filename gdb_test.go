@@ -0,0 +1,168 @@
+package chip8
+
+import (
+    "bufio"
+    "fmt"
+    "github.com/stretchr/testify/assert"
+    "net"
+    "testing"
+)
+
+// Client end of a GDB connection
+type gdbClient struct {
+    conn net.Conn
+    r    *bufio.Reader
+}
+
+func (c *gdbClient) send(packet string) {
+    fmt.Fprintf(c.conn, "$%s#%02x", packet, gdbChecksum(packet))
+}
+
+func (c *gdbClient) command(packet string) string {
+    c.send(packet)
+    return c.reply()
+}
+
+// Kill the program, which has no reply besides the acknowledgement
+func (c *gdbClient) kill() {
+    c.send("k")
+    c.r.ReadByte()
+}
+
+// Next packet from the stub, skipping acknowledgements
+func (c *gdbClient) reply() string {
+    for {
+        b, err := c.r.ReadByte()
+        if err != nil {
+            return "closed"
+        }
+        if b == '$' {
+            data, _ := c.r.ReadString('#')
+            c.r.Discard(2)
+            return data[:len(data) - 1]
+        }
+    }
+}
+
+// Run a driver with a stub and connect to it
+func startGDB(rom []byte) (*gdbClient, chan error) {
+    machine, _ := NewMachine(rom)
+    driver := NewMachineDriver(NewHeadlessWindow(nil, 0), machine)
+    stub := NewGDBStub(NewDebugger(machine))
+    stub.Halt()
+    driver.SetGDBStub(stub)
+    result := make(chan error)
+    go func() {
+        result <- driver.RunFast()
+    }()
+
+    server, client := net.Pipe()
+    go stub.Serve(server)
+    return &gdbClient{conn: client, r: bufio.NewReader(client)}, result
+}
+
+// LD V0, 1; ADD V0, 1; ST [I], V0; JP 0x202
+var gdbROM = []byte{0x60, 0x01, 0x70, 0x01, 0xF0, 0x55, 0x12, 0x02}
+
+func TestGDBRegistersAndMemory(t *testing.T) {
+    assert := assert.New(t)
+
+    client, result := startGDB(gdbROM)
+    assert.Equal("S05", client.command("?"))
+    // V0-VF, I, PC, SP, DT, ST in little endian
+    assert.Equal("00000000000000000000000000000000" + "0000" + "0002" + "000000", client.command("g"))
+    assert.Equal("OK", client.command("P3=7f"))
+    assert.Equal("OK", client.command("P11=0402"))
+    assert.Equal("7f", client.command("p3"))
+    assert.Equal("0402", client.command("p11"))
+    assert.Equal("E01", client.command("P12=11"))
+
+    assert.Equal("60017001", client.command("m200,4"))
+    assert.Equal("OK", client.command("M300,2:abcd"))
+    assert.Equal("abcd", client.command("m300,2"))
+    assert.Equal("E01", client.command("mffff,2"))
+    assert.Equal("", client.command("vMustReplyEmpty"))
+
+    xml := client.command("qXfer:features:read:target.xml:0,fff")
+    assert.Contains(xml, `<reg name="pc" bitsize="16" type="code_ptr"/>`)
+    assert.Equal(byte('l'), xml[0])
+
+    client.kill()
+    assert.NoError(<-result)
+}
+
+func TestGDBBreakpointsAndStepping(t *testing.T) {
+    assert := assert.New(t)
+
+    client, result := startGDB(gdbROM)
+    assert.Equal("S05", client.command("s"))
+    assert.Equal("0202", client.command("p11"))
+
+    assert.Equal("OK", client.command("Z0,206,2"))
+    assert.Equal("S05", client.command("c"))
+    assert.Equal("0602", client.command("p11"))
+    assert.Equal("02", client.command("p0"))
+    // Continuing leaves the breakpoint and comes back round to it
+    assert.Equal("S05", client.command("c"))
+    assert.Equal("03", client.command("p0"))
+    assert.Equal("OK", client.command("z0,206,2"))
+
+    // Watch the store to memory at I = 0
+    assert.Equal("OK", client.command("Z2,0,1"))
+    assert.Equal("T05watch:0;", client.command("c"))
+    assert.Equal("04", client.command("m0,1"))
+    assert.Equal("OK", client.command("z2,0,1"))
+
+    // Interrupting a free run
+    client.send("c")
+    client.conn.Write([]byte{0x03})
+    assert.Equal("S02", client.reply())
+
+    client.kill()
+    assert.NoError(<-result)
+}
+
+func TestGDBReportsExit(t *testing.T) {
+    assert := assert.New(t)
+
+    // EXIT
+    client, result := startGDB([]byte{0x00, 0xFD})
+    assert.Equal("W00", client.command("c"))
+    assert.NoError(<-result)
+}
+
+func TestGDBTrapsStackFaults(t *testing.T) {
+    assert := assert.New(t)
+
+    // RET with an empty stack
+    machine, _ := NewMachine([]byte{0x00, 0xEE})
+    stub := NewGDBStub(NewDebugger(machine))
+    ran, err := stub.runFrame()
+    assert.True(ran)
+    assert.IsType(&StackError{}, err)
+
+    // With StackTrap the machine waits at the fault for a client, and doesn't run while held
+    machine.SetStackPolicy(StackTrap)
+    ran, err = stub.runFrame()
+    assert.False(ran)
+    assert.NoError(err)
+    ran, err = stub.runFrame()
+    assert.False(ran)
+    assert.NoError(err)
+    assert.Equal(uint16(0x200), machine.PC())
+
+    driver := NewMachineDriver(NewHeadlessWindow(nil, 0), machine)
+    driver.SetGDBStub(stub)
+    result := make(chan error)
+    go func() {
+        result <- driver.RunFast()
+    }()
+    server, conn := net.Pipe()
+    go stub.Serve(server)
+    client := &gdbClient{conn: conn, r: bufio.NewReader(conn)}
+    assert.Equal("S0b", client.command("?"))
+    assert.Equal("00", client.command("p12"))
+
+    client.kill()
+    assert.NoError(<-result)
+}
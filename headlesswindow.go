@@ -0,0 +1,104 @@
+package chip8
+
+import "sort"
+
+// Key state change scripted for a HeadlessWindow
+type KeyEvent struct {
+    Frame   int // Applied on the Update call that starts this frame, counting from 1
+    Key     HexKey
+    Pressed bool
+}
+
+// Window without a display for automated runs. Each Update starts a new frame. Input
+// comes from a timeline of key events and the window can close itself after a set number
+// of frames.
+type HeadlessWindow struct {
+    screen    Screen
+    draws     int
+    clears    int
+    frame     int
+    maxFrames int        // Close after this many frames, or never if 0
+    events    []KeyEvent // Pending events ordered by frame
+    keys      [16]bool
+    closed    bool
+}
+
+func NewHeadlessWindow(events []KeyEvent, maxFrames int) *HeadlessWindow {
+    pending := append([]KeyEvent{}, events...)
+    sort.SliceStable(pending, func(i, j int) bool {
+        return pending[i].Frame < pending[j].Frame
+    })
+    return &HeadlessWindow{screen: newScreen(), maxFrames: maxFrames, events: pending}
+}
+
+// Apply the events due at or before the current frame
+func (w *HeadlessWindow) applyEvents() {
+    for len(w.events) > 0 && w.events[0].Frame <= w.frame {
+        w.keys[w.events[0].Key & 0xF] = w.events[0].Pressed
+        w.events = w.events[1:]
+    }
+}
+
+func (w *HeadlessWindow) Update() {
+    w.frame++
+    w.applyEvents()
+    if w.maxFrames > 0 && w.frame >= w.maxFrames {
+        w.closed = true
+    }
+}
+
+func (w *HeadlessWindow) IsKeyPressed(key HexKey) bool {
+    return w.keys[key & 0xF]
+}
+
+// Skip ahead to the next scripted key press. Closes the window if there are none left.
+func (w *HeadlessWindow) WaitForKeyPress() HexKey {
+    for _, event := range w.events {
+        if event.Pressed {
+            if event.Frame > w.frame {
+                w.frame = event.Frame
+            }
+            w.applyEvents()
+            return event.Key
+        }
+    }
+    w.closed = true
+    // Dummy return value. Program will exit.
+    return 0xFF
+}
+
+func (w *HeadlessWindow) Draw(screen *Screen) {
+    w.screen = *screen
+    w.draws++
+}
+
+func (w *HeadlessWindow) Clear() {
+    w.screen.clear(allPlanes)
+    w.clears++
+}
+
+func (w *HeadlessWindow) ShouldClose() bool {
+    return w.closed
+}
+
+func (w *HeadlessWindow) Release() {
+    // Noop
+}
+
+// Latest frame drawn
+func (w *HeadlessWindow) Screen() Screen {
+    return w.screen
+}
+
+func (w *HeadlessWindow) DrawCount() int {
+    return w.draws
+}
+
+func (w *HeadlessWindow) ClearCount() int {
+    return w.clears
+}
+
+// Number of frames started so far
+func (w *HeadlessWindow) Frame() int {
+    return w.frame
+}
@@ -0,0 +1,65 @@
+package chip8
+
+import (
+    "github.com/stretchr/testify/assert"
+    "testing"
+)
+
+func TestHeadlessWindowTimeline(t *testing.T) {
+    assert := assert.New(t)
+
+    window := NewHeadlessWindow([]KeyEvent {
+        {Frame: 3, Key: 0x5, Pressed: false},
+        {Frame: 2, Key: 0x5, Pressed: true},
+    }, 4)
+
+    window.Update()
+    assert.False(window.IsKeyPressed(0x5))
+    window.Update()
+    assert.True(window.IsKeyPressed(0x5))
+    window.Update()
+    assert.False(window.IsKeyPressed(0x5))
+    assert.False(window.ShouldClose())
+    window.Update()
+    assert.True(window.ShouldClose())
+    assert.Equal(4, window.Frame())
+}
+
+func TestHeadlessWindowWaitForKeyPress(t *testing.T) {
+    assert := assert.New(t)
+
+    window := NewHeadlessWindow([]KeyEvent {
+        {Frame: 10, Key: 0xC, Pressed: true},
+        {Frame: 12, Key: 0xC, Pressed: false},
+    }, 0)
+
+    window.Update()
+    assert.Equal(HexKey(0xC), window.WaitForKeyPress())
+    assert.Equal(10, window.Frame())
+    assert.True(window.IsKeyPressed(0xC))
+
+    // No presses left
+    assert.Equal(HexKey(0xFF), window.WaitForKeyPress())
+    assert.True(window.ShouldClose())
+}
+
+func TestHeadlessWindowRunFast(t *testing.T) {
+    assert := assert.New(t)
+
+    // CLS; LD F, V0; DRW V0, V0, 5; JP 0x206
+    window := NewHeadlessWindow(nil, 30)
+    machine, _ := NewMachine([]byte{0x00, 0xE0, 0xF0, 0x29, 0xD0, 0x05, 0x12, 0x06})
+    machine.SetWindow(window)
+    driver := &Driver{machine: machine, window: window}
+
+    assert.NoError(driver.RunFast())
+    assert.Equal(30, window.Frame())
+    assert.Equal(1, window.ClearCount())
+    assert.Equal(1, window.DrawCount())
+
+    screen := window.Screen()
+    rows := []string{"1111", "1..1", "1..1", "1..1", "1111"}
+    for j, row := range rows {
+        assert.Equal(row + "....", screen.String()[j * 65:j * 65 + 8])
+    }
+}
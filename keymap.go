@@ -0,0 +1,260 @@
+package chip8
+
+import (
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// Names of the physical keys a Keymap can bind: lowercase letters, digits, the
+// punctuation keys by their unshifted character, and these
+var namedKeys = []string{
+    "space", "enter", "tab", "up", "down", "left", "right",
+    "num0", "num1", "num2", "num3", "num4", "num5", "num6", "num7", "num8", "num9",
+}
+
+// Punctuation keys, named by their unshifted character
+const punctuationKeys = ",./;'[]-=`\\"
+
+// Whether name is a physical key that keymaps can bind
+func IsKeyName(name string) bool {
+    if len(name) == 1 {
+        c := name[0]
+        return c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.IndexByte(punctuationKeys, c) >= 0
+    }
+    for _, named := range namedKeys {
+        if name == named {
+            return true
+        }
+    }
+    return false
+}
+
+// Keymap binds physical keys, named as accepted by IsKeyName, to hex keys. A hex key
+// can have several physical keys and lookups go both ways.
+type Keymap struct {
+    keys     map[string]HexKey // Hex key for each physical key
+    physical [16][]string      // Physical keys for each hex key, in the order bound
+}
+
+func NewKeymap() *Keymap {
+    return &Keymap{keys: map[string]HexKey{}}
+}
+
+// The 1234/QWER/ASDF/ZXCV layout
+func DefaultKeymap() *Keymap {
+    keymap := NewKeymap()
+    for k, c := range keyLayout {
+        keymap.Bind(HexKey(k), string(c))
+    }
+    return keymap
+}
+
+// Bind a physical key to a hex key, moving it from any hex key it was bound to
+func (k *Keymap) Bind(key HexKey, name string) {
+    k.Unbind(name)
+    key &= 0xF
+    k.keys[name] = key
+    k.physical[key] = append(k.physical[key], name)
+}
+
+func (k *Keymap) Unbind(name string) {
+    key, ok := k.keys[name]
+    if !ok {
+        return
+    }
+    delete(k.keys, name)
+    names := k.physical[key][:0]
+    for _, bound := range k.physical[key] {
+        if bound != name {
+            names = append(names, bound)
+        }
+    }
+    k.physical[key] = names
+}
+
+// Remove every binding of a hex key
+func (k *Keymap) Clear(key HexKey) {
+    for _, name := range k.Keys(key) {
+        k.Unbind(name)
+    }
+}
+
+// Hex key a physical key is bound to
+func (k *Keymap) Lookup(name string) (HexKey, bool) {
+    key, ok := k.keys[name]
+    return key, ok
+}
+
+// Physical keys bound to a hex key
+func (k *Keymap) Keys(key HexKey) []string {
+    return append([]string(nil), k.physical[key & 0xF]...)
+}
+
+// Replace the bindings of each hex key that other binds
+func (k *Keymap) Merge(other *Keymap) {
+    for key := HexKey(0); key < 16; key++ {
+        if len(other.physical[key]) == 0 {
+            continue
+        }
+        k.Clear(key)
+        for _, name := range other.physical[key] {
+            k.Bind(key, name)
+        }
+    }
+}
+
+// Keymaps are stored as an object from hex digits to lists of key names, such as
+// {"5": ["w", "up"]}. Hex keys left out have no bindings.
+func (k *Keymap) MarshalJSON() ([]byte, error) {
+    object := map[string][]string{}
+    for key, names := range k.physical {
+        if len(names) > 0 {
+            object[fmt.Sprintf("%X", key)] = names
+        }
+    }
+    return json.Marshal(object)
+}
+
+func (k *Keymap) UnmarshalJSON(data []byte) error {
+    var object map[string][]string
+    if err := json.Unmarshal(data, &object); err != nil {
+        return err
+    }
+    // Sorted so that keys bound twice end up in the same place every time
+    digits := make([]string, 0, len(object))
+    for digit := range object {
+        digits = append(digits, digit)
+    }
+    sort.Strings(digits)
+
+    keymap := NewKeymap()
+    for _, digit := range digits {
+        key, err := strconv.ParseUint(digit, 16, 8)
+        if err != nil || key > 0xF {
+            return fmt.Errorf("%q is not a hex key", digit)
+        }
+        for _, name := range object[digit] {
+            name = strings.ToLower(name)
+            if !IsKeyName(name) {
+                return fmt.Errorf("unknown key %q", name)
+            }
+            keymap.Bind(HexKey(key), name)
+        }
+    }
+    *k = *keymap
+    return nil
+}
+
+func LoadKeymapFile(path string) (*Keymap, error) {
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    keymap := NewKeymap()
+    if err := json.Unmarshal(data, keymap); err != nil {
+        return nil, fmt.Errorf("could not read keymap %s: %v", path, err)
+    }
+    return keymap, nil
+}
+
+func (k *Keymap) SaveFile(path string) error {
+    data, err := json.MarshalIndent(k, "", "    ")
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+        return err
+    }
+    return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Global keymap file, in the user's configuration directory
+func GlobalKeymapPath() (string, error) {
+    dir, err := os.UserConfigDir()
+    if err != nil {
+        return "", err
+    }
+    return filepath.Join(dir, "chip8", "keys.json"), nil
+}
+
+// Keymap file for a ROM, which sits next to it like the quick save slots
+func ROMKeymapPath(romPath string) string {
+    return strings.TrimSuffix(romPath, filepath.Ext(romPath)) + ".keys.json"
+}
+
+// Keymap for a ROM: the default layout, overridden by the global keymap file, overridden
+// by the ROM's own keymap file. Missing files are skipped.
+func LoadKeymap(romPath string) (*Keymap, error) {
+    keymap := DefaultKeymap()
+    paths := []string{ROMKeymapPath(romPath)}
+    if global, err := GlobalKeymapPath(); err == nil {
+        paths = []string{global, paths[0]}
+    }
+    for _, path := range paths {
+        override, err := LoadKeymapFile(path)
+        if os.IsNotExist(err) {
+            continue
+        } else if err != nil {
+            return nil, err
+        }
+        keymap.Merge(override)
+    }
+    return keymap, nil
+}
+
+// Remapper walks through the hex keys in order, binding the next physical key pressed
+// to each. It starts from a copy of a keymap so that skipped hex keys keep their keys.
+type Remapper struct {
+    keymap *Keymap
+    next   HexKey
+}
+
+func NewRemapper(keymap *Keymap) *Remapper {
+    remapper := &Remapper{keymap: NewKeymap()}
+    remapper.keymap.Merge(keymap)
+    return remapper
+}
+
+// Hex key waiting for a physical key. Returns false once every key is mapped.
+func (r *Remapper) Next() (HexKey, bool) {
+    return r.next, r.next < 16
+}
+
+// Bind a physical key to the waiting hex key, replacing its keys, and move on
+func (r *Remapper) Press(name string) {
+    if r.next < 16 {
+        r.keymap.Clear(r.next)
+        r.keymap.Bind(r.next, name)
+        r.next++
+    }
+}
+
+// Keep the waiting hex key's keys and move on
+func (r *Remapper) Skip() {
+    if r.next < 16 {
+        r.next++
+    }
+}
+
+// Prompt for the waiting hex key
+func (r *Remapper) Prompt() string {
+    key, ok := r.Next()
+    if !ok {
+        return "all keys mapped"
+    }
+    current := strings.Join(r.keymap.Keys(key), " ")
+    if current == "" {
+        current = "nothing"
+    }
+    return fmt.Sprintf("press a key for %X (Esc keeps %s)", key, current)
+}
+
+func (r *Remapper) Keymap() *Keymap {
+    return r.keymap
+}
@@ -0,0 +1,99 @@
+package chip8
+
+import (
+    "encoding/json"
+    "github.com/stretchr/testify/assert"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+func TestKeymapBindings(t *testing.T) {
+    assert := assert.New(t)
+
+    keymap := DefaultKeymap()
+    key, ok := keymap.Lookup("w")
+    assert.True(ok)
+    assert.Equal(HexKey(0x5), key)
+    assert.Equal([]string{"w"}, keymap.Keys(0x5))
+
+    // A physical key moves when bound again, hex keys can have several
+    keymap.Bind(0x5, "up")
+    keymap.Bind(0x8, "w")
+    assert.Equal([]string{"up"}, keymap.Keys(0x5))
+    assert.Equal([]string{"s", "w"}, keymap.Keys(0x8))
+
+    keymap.Clear(0x8)
+    _, ok = keymap.Lookup("s")
+    assert.False(ok)
+    assert.Empty(keymap.Keys(0x8))
+}
+
+func TestKeymapJSON(t *testing.T) {
+    assert := assert.New(t)
+
+    keymap := NewKeymap()
+    keymap.Bind(0xA, "z")
+    keymap.Bind(0xA, "space")
+    keymap.Bind(0x2, "up")
+    data, err := json.Marshal(keymap)
+    assert.NoError(err)
+    assert.Equal(`{"2":["up"],"A":["z","space"]}`, string(data))
+
+    loaded := NewKeymap()
+    assert.NoError(json.Unmarshal([]byte(`{"a": ["Z", "space"], "2": ["up"]}`), loaded))
+    assert.Equal(keymap, loaded)
+
+    assert.EqualError(json.Unmarshal([]byte(`{"G": ["z"]}`), loaded), `"G" is not a hex key`)
+    assert.EqualError(json.Unmarshal([]byte(`{"1": ["f13"]}`), loaded), `unknown key "f13"`)
+}
+
+func TestLoadKeymapMergesFiles(t *testing.T) {
+    assert := assert.New(t)
+
+    dir, err := ioutil.TempDir("", "chip8")
+    assert.NoError(err)
+    defer os.RemoveAll(dir)
+    t.Setenv("XDG_CONFIG_HOME", dir)
+    t.Setenv("HOME", dir)
+    global, err := GlobalKeymapPath()
+    assert.NoError(err)
+
+    rom := filepath.Join(dir, "pong.ch8")
+    keymap, err := LoadKeymap(rom)
+    assert.NoError(err)
+    assert.Equal(DefaultKeymap(), keymap)
+
+    assert.NoError(os.MkdirAll(filepath.Dir(global), 0755))
+    assert.NoError(ioutil.WriteFile(global, []byte(`{"5": ["up"], "8": ["down"]}`), 0644))
+    assert.NoError(ioutil.WriteFile(ROMKeymapPath(rom), []byte(`{"8": ["k", "j"]}`), 0644))
+    keymap, err = LoadKeymap(rom)
+    assert.NoError(err)
+    assert.Equal([]string{"up"}, keymap.Keys(0x5))
+    assert.Equal([]string{"k", "j"}, keymap.Keys(0x8))
+    assert.Equal([]string{"x"}, keymap.Keys(0x0))
+
+    assert.NoError(ioutil.WriteFile(ROMKeymapPath(rom), []byte(`{`), 0644))
+    _, err = LoadKeymap(rom)
+    assert.Error(err)
+}
+
+func TestRemapper(t *testing.T) {
+    assert := assert.New(t)
+
+    remapper := NewRemapper(DefaultKeymap())
+    assert.Equal("press a key for 0 (Esc keeps x)", remapper.Prompt())
+    remapper.Press("m")
+    remapper.Skip()
+    key, waiting := remapper.Next()
+    assert.True(waiting)
+    assert.Equal(HexKey(2), key)
+    for k := 2; k < 16; k++ {
+        remapper.Skip()
+    }
+    _, waiting = remapper.Next()
+    assert.False(waiting)
+    assert.Equal([]string{"m"}, remapper.Keymap().Keys(0x0))
+    assert.Equal([]string{"1"}, remapper.Keymap().Keys(0x1))
+}
@@ -0,0 +1,362 @@
+package chip8
+
+import (
+    "github.com/eskrm/chip8/disasm"
+    "time"
+)
+
+// Font sprites for the hex digits 0-F, stored at the start of memory
+var font = [80]byte {
+    0xF0, 0x90, 0x90, 0x90, 0xF0, // 0
+    0x20, 0x60, 0x20, 0x20, 0x70, // 1
+    0xF0, 0x10, 0xF0, 0x80, 0xF0, // 2
+    0xF0, 0x10, 0xF0, 0x10, 0xF0, // 3
+    0x90, 0x90, 0xF0, 0x10, 0x10, // 4
+    0xF0, 0x80, 0xF0, 0x10, 0xF0, // 5
+    0xF0, 0x80, 0xF0, 0x90, 0xF0, // 6
+    0xF0, 0x10, 0x20, 0x40, 0x40, // 7
+    0xF0, 0x90, 0xF0, 0x90, 0xF0, // 8
+    0xF0, 0x90, 0xF0, 0x10, 0xF0, // 9
+    0xF0, 0x90, 0xF0, 0x90, 0x90, // A
+    0xE0, 0x90, 0xE0, 0x90, 0xE0, // B
+    0xF0, 0x80, 0x80, 0x80, 0xF0, // C
+    0xE0, 0x90, 0x90, 0x90, 0xE0, // D
+    0xF0, 0x80, 0xF0, 0x80, 0xF0, // E
+    0xF0, 0x80, 0xF0, 0x80, 0x80, // F
+}
+
+// SUPER-CHIP 8x10 sprites for the hex digits 0-F, stored after the small font
+var bigFont = [160]byte {
+    0x3C, 0x7E, 0xE7, 0xC3, 0xC3, 0xC3, 0xC3, 0xE7, 0x7E, 0x3C, // 0
+    0x18, 0x38, 0x58, 0x18, 0x18, 0x18, 0x18, 0x18, 0x18, 0x3C, // 1
+    0x3E, 0x7F, 0xC3, 0x06, 0x0C, 0x18, 0x30, 0x60, 0xFF, 0xFF, // 2
+    0x3C, 0x7E, 0xC3, 0x03, 0x0E, 0x0E, 0x03, 0xC3, 0x7E, 0x3C, // 3
+    0x06, 0x0E, 0x1E, 0x36, 0x66, 0xC6, 0xFF, 0xFF, 0x06, 0x06, // 4
+    0xFF, 0xFF, 0xC0, 0xC0, 0xFC, 0xFE, 0x03, 0xC3, 0x7E, 0x3C, // 5
+    0x3E, 0x7C, 0xC0, 0xC0, 0xFC, 0xFE, 0xC3, 0xC3, 0x7E, 0x3C, // 6
+    0xFF, 0xFF, 0x03, 0x06, 0x0C, 0x18, 0x30, 0x60, 0x60, 0x60, // 7
+    0x3C, 0x7E, 0xC3, 0xC3, 0x7E, 0x7E, 0xC3, 0xC3, 0x7E, 0x3C, // 8
+    0x3C, 0x7E, 0xC3, 0xC3, 0x7F, 0x3F, 0x03, 0x03, 0x3E, 0x7C, // 9
+    0x7E, 0xFF, 0xC3, 0xC3, 0xC3, 0xFF, 0xFF, 0xC3, 0xC3, 0xC3, // A
+    0xFC, 0xFC, 0xC3, 0xC3, 0xFC, 0xFC, 0xC3, 0xC3, 0xFC, 0xFC, // B
+    0x3C, 0xFF, 0xC3, 0xC0, 0xC0, 0xC0, 0xC0, 0xC3, 0xFF, 0x3C, // C
+    0xFC, 0xFE, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xFE, 0xFC, // D
+    0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, // E
+    0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC0, 0xC0, 0xC0, 0xC0, // F
+}
+
+const bigFontAddr = 0x50
+
+// Max acceptable size of ROM is 4096 - 512 bytes
+const maxROMSize = 3584
+
+// XO-CHIP ROMs can fill its address space of 65536 - 512 bytes
+const maxXOChipROMSize = 65024
+
+// Machine is a CHIP-8 interpreter that can be stepped and inspected without a real window.
+// A frame is one 60 Hz timer tick and the instructions that fall within it.
+type Machine struct {
+    context  *Context
+    audio    Audio
+    recorder *WAVRecorder
+    tracer   *Tracer
+    playing  bool  // Whether the audio is sounding the buzzer
+    started  Tone  // Tone the buzzer is sounding, to restart it when the program changes it
+    speed    int64 // Instructions executed per second
+    cycles   int64 // Instructions owed to the next frame, in 1/ticksPerSecond
+    inFrame  bool  // Whether the current frame has started
+}
+
+func NewMachine(rom []byte) (*Machine, error) {
+    if len(rom) > maxROMSize {
+        return nil, ErrROMTooLarge
+    }
+    return newMachine(rom), nil
+}
+
+// Create a machine with the XO-CHIP extensions: 64K of memory, bit planes, long I loads, the
+// register range loads and stores, and audio patterns
+func NewXOChipMachine(rom []byte) (*Machine, error) {
+    if len(rom) > maxXOChipROMSize {
+        return nil, ErrXOChipROMTooLarge
+    }
+    m := newMachine(rom)
+    m.context.xochip = true
+    return m, nil
+}
+
+func newMachine(rom []byte) *Machine {
+    memory := [65536]byte{}
+    copy(memory[:], font[:])
+    copy(memory[bigFontAddr:], bigFont[:])
+    copy(memory[0x200:], rom)
+
+    context := newContext(newCPU(), nullWindow{}, memory)
+    context.rng.reset(RandomSplitMix, uint64(time.Now().UnixNano()))
+    return &Machine{context: context, audio: NullAudio{}, speed: DefaultSpeed}
+}
+
+// Set the window used for drawing and input. Machines start with one that discards everything.
+func (m *Machine) SetWindow(window Window) {
+    m.context.window = window
+}
+
+// Set the audio that plays the buzzer. Machines start with one that discards everything.
+func (m *Machine) SetAudio(audio Audio) {
+    m.audio = audio
+}
+
+// Record the buzzer alongside the audio, in step with emulated time. Nil stops recording.
+func (m *Machine) SetRecorder(recorder *WAVRecorder) {
+    m.recorder = recorder
+    if recorder != nil && m.playing {
+        recorder.StartTone(m.tone())
+    }
+}
+
+// Set the number of instructions executed per second. Timers always run at 60 Hz.
+func (m *Machine) SetSpeed(speed int) {
+    if speed < 1 {
+        speed = 1
+    }
+    m.speed = int64(speed)
+}
+
+func (m *Machine) SetQuirks(quirks Quirks) {
+    m.context.quirks = quirks
+}
+
+func (m *Machine) Quirks() Quirks {
+    return m.context.quirks
+}
+
+// Whether the machine was created by NewXOChipMachine
+func (m *Machine) XOChip() bool {
+    return m.context.xochip
+}
+
+// Choose what happens when the stack overflows or underflows. Machines start with StackHalt.
+func (m *Machine) SetStackPolicy(policy StackPolicy) {
+    m.context.stackPolicy = policy
+}
+
+func (m *Machine) StackPolicy() StackPolicy {
+    return m.context.stackPolicy
+}
+
+// Restart RND's sequence from a seed. Machines start seeded from the clock, so runs only
+// repeat once a seed is set.
+func (m *Machine) SetRandom(algorithm RandomAlgorithm, seed uint64) {
+    m.context.rng.reset(algorithm, seed)
+}
+
+// The algorithm and seed last given to SetRandom
+func (m *Machine) Random() (RandomAlgorithm, uint64) {
+    return m.context.rng.algorithm, m.context.rng.seed
+}
+
+// Execute a single instruction without touching the timers
+func (m *Machine) Step() error {
+    cpu := m.context.cpu
+    if err := checkMemory(m.context, cpu.pc, 2); err != nil {
+        return err
+    }
+    if m.tracer != nil {
+        in := disasm.Decode(m.context.memory[:], int(cpu.pc))
+        before := traceRegisters(cpu)
+        defer func() { m.tracer.trace(in, before, cpu) }()
+    }
+    m.context.opcode = uint16(m.context.fetch(int(cpu.pc))) << 8 | uint16(m.context.fetch(int(cpu.pc) + 1))
+    return runOpcode(m.context)
+}
+
+// Trace every instruction executed. Nil stops tracing.
+func (m *Machine) SetTracer(tracer *Tracer) {
+    m.tracer = tracer
+}
+
+// Observe every memory access made by instructions. Returns an id for RemoveMemoryHook.
+func (m *Machine) AddMemoryHook(hook MemoryHook) int {
+    m.context.hookID++
+    m.context.hooks = append(m.context.hooks, memoryHook{id: m.context.hookID, hook: hook})
+    return m.context.hookID
+}
+
+func (m *Machine) RemoveMemoryHook(id int) {
+    hooks := m.context.hooks[:0]
+    for _, h := range m.context.hooks {
+        if h.id != id {
+            hooks = append(hooks, h)
+        }
+    }
+    m.context.hooks = hooks
+}
+
+// Run n frames, stopping early if the program faults
+func (m *Machine) RunFrames(n int) error {
+    for k := 0; k < n; k++ {
+        if err := m.runFrame(); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// Run the instructions that fall within one frame, then update the timers
+func (m *Machine) runFrame() error {
+    _, err := m.runFrameUntil(nil)
+    return err
+}
+
+// Run the rest of the current frame, unless stop returns true before one of its
+// instructions. A frame interrupted by stop or a fault resumes on the next call.
+func (m *Machine) runFrameUntil(stop func() bool) (bool, error) {
+    if !m.inFrame {
+        m.context.vblank = false
+        m.cycles += m.speed
+        m.inFrame = true
+        if input, ok := m.context.window.(frameInput); ok {
+            input.startFrame()
+        }
+    }
+    for m.cycles >= ticksPerSecond {
+        if stop != nil && stop() {
+            return true, nil
+        }
+        if err := m.Step(); err != nil {
+            return false, err
+        }
+        m.cycles -= ticksPerSecond
+        if m.context.vblank {
+            // Remaining instructions in this frame are spent waiting for the display
+            m.cycles %= ticksPerSecond
+            break
+        }
+    }
+    m.inFrame = false
+    m.updateTimers()
+    if m.recorder != nil {
+        m.recorder.advance()
+    }
+    return false, nil
+}
+
+func (m *Machine) updateTimers() {
+    // The buzzer sounds for as many frames as the sound timer was set to
+    sounding := m.context.cpu.st > 0
+    if m.context.cpu.dt > 0 {
+        m.context.cpu.dt--
+    }
+    if m.context.cpu.st > 0 {
+        m.context.cpu.st--
+    }
+
+    // XO-CHIP music changes the pattern and pitch while the buzzer sounds
+    if sounding && m.playing && !m.tone().sameSound(&m.started) {
+        m.stopTone()
+        m.startTone()
+    } else if sounding && !m.playing {
+        m.startTone()
+    } else if !sounding && m.playing {
+        m.stopTone()
+    }
+    m.playing = sounding
+}
+
+func (m *Machine) startTone() {
+    tone := m.tone()
+    m.started = *tone
+    m.audio.StartTone(tone)
+    if m.recorder != nil {
+        // Separate copy so the two consumers don't share a phase
+        recorded := *tone
+        m.recorder.StartTone(&recorded)
+    }
+}
+
+func (m *Machine) stopTone() {
+    m.audio.StopTone()
+    if m.recorder != nil {
+        m.recorder.StopTone()
+    }
+}
+
+// Tone for the current XO-CHIP audio state
+func (m *Machine) tone() *Tone {
+    return &Tone{Pattern: m.context.audio, Pitch: m.context.pitch, HasPattern: m.context.hasAudio}
+}
+
+func (m *Machine) PC() uint16 {
+    return m.context.cpu.pc
+}
+
+func (m *Machine) I() uint16 {
+    return m.context.cpu.i
+}
+
+func (m *Machine) SP() byte {
+    return m.context.cpu.sp
+}
+
+// General purpose registers V0 through VF
+func (m *Machine) V() [16]byte {
+    return m.context.cpu.v
+}
+
+func (m *Machine) Stack() [16]uint16 {
+    return m.context.stack
+}
+
+// Delay timer
+func (m *Machine) DT() byte {
+    return m.context.cpu.dt
+}
+
+// Sound timer
+func (m *Machine) ST() byte {
+    return m.context.cpu.st
+}
+
+// Copy of the addressable memory, including the font and ROM. It is 64K with XO-CHIP, 4K
+// otherwise.
+func (m *Machine) Memory() []byte {
+    memory := make([]byte, m.context.memorySize())
+    copy(memory, m.context.memory[:])
+    return memory
+}
+
+// Copy of the framebuffer, 1 for a lit pixel
+func (m *Machine) Screen() Screen {
+    return m.context.screen
+}
+
+// Window used when a machine runs headless
+type nullWindow struct{}
+
+func (nullWindow) Update() {
+    // Noop
+}
+
+func (nullWindow) IsKeyPressed(key HexKey) bool {
+    return false
+}
+
+func (nullWindow) WaitForKeyPress() HexKey {
+    return 0
+}
+
+func (nullWindow) Draw(screen *Screen) {
+    // Noop
+}
+
+func (nullWindow) Clear() {
+    // Noop
+}
+
+func (nullWindow) ShouldClose() bool {
+    return false
+}
+
+func (nullWindow) Release() {
+    // Noop
+}
@@ -0,0 +1,93 @@
+package chip8
+
+import (
+    "github.com/stretchr/testify/assert"
+    "testing"
+)
+
+func TestNewMachine(t *testing.T) {
+    assert := assert.New(t)
+
+    machine, err := NewMachine([]byte{0x12, 0x34})
+    assert.NoError(err)
+    memory := machine.Memory()
+    assert.Equal(font[:], memory[:len(font)])
+    assert.Equal([]byte{0x12, 0x34}, memory[0x200:0x202])
+    assert.Equal(uint16(0x200), machine.PC())
+}
+
+func TestNewMachineROMTooLarge(t *testing.T) {
+    assert := assert.New(t)
+
+    _, err := NewMachine(make([]byte, maxROMSize + 1))
+    assert.Equal(ErrROMTooLarge, err)
+
+    machine, err := NewXOChipMachine(make([]byte, maxROMSize + 1))
+    assert.NoError(err)
+    assert.True(machine.XOChip())
+    assert.Len(machine.Memory(), 0x10000)
+    _, err = NewXOChipMachine(make([]byte, maxXOChipROMSize + 1))
+    assert.Equal(ErrXOChipROMTooLarge, err)
+}
+
+func TestStep(t *testing.T) {
+    assert := assert.New(t)
+
+    // LD V3, 0x42; CALL 0x300
+    machine, _ := NewMachine([]byte{0x63, 0x42, 0x23, 0x00})
+    assert.NoError(machine.Step())
+    assert.Equal(byte(0x42), machine.V()[3])
+    assert.Equal(uint16(0x202), machine.PC())
+
+    assert.NoError(machine.Step())
+    assert.Equal(uint16(0x300), machine.PC())
+    assert.Equal(byte(1), machine.SP())
+    // The return address is the instruction after the CALL
+    assert.Equal(uint16(0x204), machine.Stack()[0])
+}
+
+func TestRunFrames(t *testing.T) {
+    assert := assert.New(t)
+
+    // Fill program memory with ADD V0, 1
+    rom := make([]byte, maxROMSize)
+    for k := 0; k < len(rom); k += 2 {
+        rom[k] = 0x70
+        rom[k + 1] = 0x01
+    }
+    machine, _ := NewMachine(rom)
+    machine.SetSpeed(570)
+    machine.context.cpu.dt = 5
+
+    // 570 instructions per second over a 1/60 s frame is 9.5 instructions
+    assert.NoError(machine.RunFrames(1))
+    assert.Equal(byte(9), machine.V()[0])
+    assert.Equal(byte(4), machine.DT())
+
+    // The leftover fraction carries into the next frame
+    assert.NoError(machine.RunFrames(1))
+    assert.Equal(byte(19), machine.V()[0])
+    assert.Equal(byte(3), machine.DT())
+}
+
+func TestRunFramesFault(t *testing.T) {
+    assert := assert.New(t)
+
+    // RET with an empty stack
+    machine, _ := NewMachine([]byte{0x00, 0xEE})
+    err := machine.RunFrames(10)
+    assert.Equal(&StackError{PC: 0x200, Overflow: false}, err)
+}
+
+func TestDisplayWait(t *testing.T) {
+    assert := assert.New(t)
+
+    // ADD V0, 1; DRW V1, V1, 0; JP 0x200
+    machine, _ := NewMachine([]byte{0x70, 0x01, 0xD1, 0x10, 0x12, 0x00})
+    machine.SetSpeed(6000)
+    machine.SetQuirks(VIPQuirks)
+
+    // Each frame ends at the first DRW
+    assert.NoError(machine.RunFrames(3))
+    assert.Equal(byte(3), machine.V()[0])
+}
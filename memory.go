@@ -0,0 +1,108 @@
+package chip8
+
+import "fmt"
+
+// Kinds of memory access, combinable as a mask
+type Access byte
+
+const (
+    Read Access = 1 << iota
+    Write
+    Execute
+)
+
+func (a Access) String() string {
+    s := ""
+    for _, kind := range []struct {
+        access Access
+        name   string
+    }{{Read, "r"}, {Write, "w"}, {Execute, "x"}} {
+        if a & kind.access != 0 {
+            s += kind.name
+        }
+    }
+    return s
+}
+
+// Parse a mask such as "rw" from the letters r, w and x
+func ParseAccess(text string) (Access, error) {
+    var a Access
+    for _, c := range text {
+        switch c {
+        case 'r':
+            a |= Read
+        case 'w':
+            a |= Write
+        case 'x':
+            a |= Execute
+        default:
+            return 0, fmt.Errorf("unknown access %q, use r, w and x", c)
+        }
+    }
+    return a, nil
+}
+
+// One byte of memory accessed by the instruction at PC
+type MemoryAccess struct {
+    Kind  Access
+    Addr  uint16
+    Value byte // Value read, or value written
+    PC    uint16
+}
+
+func (a MemoryAccess) String() string {
+    return fmt.Sprintf("%03X: %s %04X = %02X", a.PC, a.Kind, a.Addr, a.Value)
+}
+
+// Called for every memory access made by instructions
+type MemoryHook func(access MemoryAccess)
+
+type memoryHook struct {
+    id   int
+    hook MemoryHook
+}
+
+// Instructions access memory through the bus so hooks can observe them. Callers check
+// bounds with checkMemory first.
+func (c *Context) read(addr int) byte {
+    value := c.memory[addr]
+    c.notify(Read, addr, value)
+    return value
+}
+
+func (c *Context) write(addr int, value byte) {
+    c.memory[addr] = value
+    c.notify(Write, addr, value)
+}
+
+func (c *Context) fetch(addr int) byte {
+    value := c.memory[addr]
+    c.notify(Execute, addr, value)
+    return value
+}
+
+func (c *Context) notify(kind Access, addr int, value byte) {
+    for _, h := range c.hooks {
+        h.hook(MemoryAccess{Kind: kind, Addr: uint16(addr), Value: value, PC: c.cpu.pc})
+    }
+}
+
+// Log of accesses to an address range, for finding which instructions touch which bytes
+type AccessLog struct {
+    Start, End uint16 // Inclusive range
+    Kinds      Access
+    Entries    []MemoryAccess
+}
+
+func NewAccessLog(start, end uint16, kinds Access) *AccessLog {
+    return &AccessLog{Start: start, End: end, Kinds: kinds}
+}
+
+// Hook recording matching accesses, for Machine.AddMemoryHook
+func (l *AccessLog) Hook() MemoryHook {
+    return func(access MemoryAccess) {
+        if access.Kind & l.Kinds != 0 && access.Addr >= l.Start && access.Addr <= l.End {
+            l.Entries = append(l.Entries, access)
+        }
+    }
+}
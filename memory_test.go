@@ -0,0 +1,65 @@
+package chip8
+
+import (
+    "github.com/stretchr/testify/assert"
+    "testing"
+)
+
+func TestParseAccess(t *testing.T) {
+    assert := assert.New(t)
+
+    kinds, err := ParseAccess("rx")
+    assert.NoError(err)
+    assert.Equal(Read | Execute, kinds)
+    assert.Equal("rx", kinds.String())
+
+    _, err = ParseAccess("rq")
+    assert.Error(err)
+}
+
+func TestMemoryHooks(t *testing.T) {
+    assert := assert.New(t)
+
+    // LD I, 0x300; LD V0, 0x2A; ST B, V0; LD V0 - V1, [I]
+    machine, _ := NewXOChipMachine([]byte{0xA3, 0x00, 0x60, 0x2A, 0xF0, 0x33, 0x50, 0x13})
+    writes := NewAccessLog(0x300, 0x302, Write)
+    machine.AddMemoryHook(writes.Hook())
+    reads := NewAccessLog(0x300, 0x3FF, Read)
+    id := machine.AddMemoryHook(reads.Hook())
+    fetches := NewAccessLog(0x200, 0x203, Execute)
+    machine.AddMemoryHook(fetches.Hook())
+
+    for k := 0; k < 4; k++ {
+        assert.NoError(machine.Step())
+    }
+    assert.Equal([]MemoryAccess{
+        {Kind: Write, Addr: 0x300, Value: 0, PC: 0x204},
+        {Kind: Write, Addr: 0x301, Value: 4, PC: 0x204},
+        {Kind: Write, Addr: 0x302, Value: 2, PC: 0x204},
+    }, writes.Entries)
+    assert.Equal([]MemoryAccess{
+        {Kind: Read, Addr: 0x300, Value: 0, PC: 0x206},
+        {Kind: Read, Addr: 0x301, Value: 4, PC: 0x206},
+    }, reads.Entries)
+    assert.Len(fetches.Entries, 4)
+    assert.Equal("204: w 0301 = 04", writes.Entries[1].String())
+
+    // Removed hooks see nothing more
+    machine.RemoveMemoryHook(id)
+    machine.context.cpu.pc = 0x206
+    assert.NoError(machine.Step())
+    assert.Len(reads.Entries, 2)
+}
+
+func TestMemoryHookSeesSpriteReads(t *testing.T) {
+    assert := assert.New(t)
+
+    // LD I, 0x300; DRW V0, V0, 2
+    machine, _ := NewMachine([]byte{0xA3, 0x00, 0xD0, 0x02})
+    log := NewAccessLog(0x300, 0x3FF, Read)
+    machine.AddMemoryHook(log.Hook())
+    machine.Step()
+    machine.Step()
+    assert.Len(log.Entries, 2)
+    assert.Equal(uint16(0x301), log.Entries[1].Addr)
+}
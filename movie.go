@@ -0,0 +1,287 @@
+package chip8
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "encoding/binary"
+    "fmt"
+    "io"
+    "io/ioutil"
+)
+
+// Movies start with this, followed by the format version
+const movieMagic = "CH8M"
+
+// Increase when the movie layout or the machine's behavior changes, so older movies are
+// refused rather than replayed differently. Version 3 returns from subroutines past the CALL,
+// version 4 fixes the 8xy_ flags, version 5 allows 16 nested CALLs, version 6 records the
+// XO-CHIP mode, version 7 adds a quirk, version 8 changes the VIP RND's lookup table and
+// version 9 runs frames at 60 Hz rather than every 16 ms.
+const movieVersion = 9
+
+// Movie is a recorded session: the settings the machine started with and the keys held
+// in every frame. Replaying it on the same ROM runs the same instructions, so a movie
+// reproduces a bug without the keyboard that found it.
+type Movie struct {
+    ROMHash [sha256.Size]byte
+    Speed   int
+    Quirks  Quirks
+    Stack   StackPolicy
+    XOChip  bool
+    Random  RandomAlgorithm
+    Seed    uint64
+    Frames  []uint16  // Keys held during each frame, bit n for key n
+    Waits   []KeyWait // Keys returned by WaitForKeyPress, in order
+    Screen  Screen    // Screen at the end of the recording
+}
+
+// Key that ended a wait for a key press
+type KeyWait struct {
+    Frame int // Index into Movie.Frames
+    Key   HexKey
+}
+
+// Fixed part of a movie file, followed by the frames and then the waits
+type movieHeader struct {
+    ROMHash [sha256.Size]byte
+    Speed   int64
+    Quirks  Quirks
+    Stack   StackPolicy
+    XOChip  bool
+    Random  RandomAlgorithm
+    Seed    uint64
+    Frames  uint32
+    Waits   uint32
+    Width   uint16
+    Height  uint16
+    Pixels  [128][64]byte
+}
+
+// Entries read at a time from a movie's lists
+const movieChunk = 4096
+
+type movieWait struct {
+    Frame uint32
+    Key   byte
+}
+
+// Implemented by windows that need to know when the machine starts a frame
+type frameInput interface {
+    startFrame()
+}
+
+func (movie *Movie) Write(w io.Writer) error {
+    header := &movieHeader{
+        ROMHash: movie.ROMHash, Speed: int64(movie.Speed), Quirks: movie.Quirks, Stack: movie.Stack,
+        XOChip: movie.XOChip, Random: movie.Random, Seed: movie.Seed,
+        Frames: uint32(len(movie.Frames)), Waits: uint32(len(movie.Waits)),
+        Width: uint16(movie.Screen.Width), Height: uint16(movie.Screen.Height), Pixels: movie.Screen.Pixels,
+    }
+    waits := make([]movieWait, len(movie.Waits))
+    for k, wait := range movie.Waits {
+        waits[k] = movieWait{Frame: uint32(wait.Frame), Key: byte(wait.Key)}
+    }
+    if _, err := io.WriteString(w, movieMagic); err != nil {
+        return err
+    }
+    for _, data := range []interface{}{uint16(movieVersion), header, movie.Frames, waits} {
+        if err := binary.Write(w, binary.LittleEndian, data); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func ReadMovie(r io.Reader) (*Movie, error) {
+    magic := make([]byte, len(movieMagic))
+    var version uint16
+    if _, err := io.ReadFull(r, magic); err != nil || string(magic) != movieMagic {
+        return nil, ErrNotMovie
+    }
+    if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+        return nil, ErrNotMovie
+    }
+    if version != movieVersion {
+        return nil, fmt.Errorf("movie version %d is not supported, expected %d", version, movieVersion)
+    }
+    header := new(movieHeader)
+    if err := binary.Read(r, binary.LittleEndian, header); err != nil {
+        return nil, fmt.Errorf("could not read movie: %v", err)
+    }
+    lores := header.Width == 64 && header.Height == 32
+    hires := header.Width == 128 && header.Height == 64
+    if !lores && !hires || header.Speed < 1 || header.Stack > StackWrap || header.Random > RandomVIP {
+        return nil, ErrNotMovie
+    }
+
+    movie := &Movie{
+        ROMHash: header.ROMHash, Speed: int(header.Speed), Quirks: header.Quirks, Stack: header.Stack,
+        XOChip: header.XOChip, Random: header.Random, Seed: header.Seed,
+        Screen: Screen{Width: int(header.Width), Height: int(header.Height), Pixels: header.Pixels},
+    }
+    // Read the lists in bounded pieces so a corrupt count fails on a short read rather
+    // than allocating the whole count up front
+    for remaining := int(header.Frames); remaining > 0; remaining -= movieChunk {
+        n := remaining
+        if n > movieChunk {
+            n = movieChunk
+        }
+        frames := make([]uint16, n)
+        if err := binary.Read(r, binary.LittleEndian, frames); err != nil {
+            return nil, fmt.Errorf("could not read movie: %v", err)
+        }
+        movie.Frames = append(movie.Frames, frames...)
+    }
+    for remaining := int(header.Waits); remaining > 0; remaining -= movieChunk {
+        n := remaining
+        if n > movieChunk {
+            n = movieChunk
+        }
+        waits := make([]movieWait, n)
+        if err := binary.Read(r, binary.LittleEndian, waits); err != nil {
+            return nil, fmt.Errorf("could not read movie: %v", err)
+        }
+        for _, wait := range waits {
+            if int(wait.Frame) >= len(movie.Frames) {
+                return nil, ErrNotMovie
+            }
+            movie.Waits = append(movie.Waits, KeyWait{Frame: int(wait.Frame), Key: HexKey(wait.Key)})
+        }
+    }
+    return movie, nil
+}
+
+func (movie *Movie) SaveFile(path string) error {
+    var buf bytes.Buffer
+    // Writing to a buffer can't fail
+    movie.Write(&buf)
+    return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
+func LoadMovieFile(path string) (*Movie, error) {
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    return ReadMovie(bytes.NewReader(data))
+}
+
+// Run the movie on a new machine for the ROM, feeding it the recorded keys. Returns the
+// machine as it was left, with ErrReplayMismatch if its screen differs from the recording.
+func (movie *Movie) Replay(rom []byte) (*Machine, error) {
+    if sha256.Sum256(rom) != movie.ROMHash {
+        return nil, ErrMovieROM
+    }
+    newMachine := NewMachine
+    if movie.XOChip {
+        newMachine = NewXOChipMachine
+    }
+    machine, err := newMachine(rom)
+    if err != nil {
+        return nil, err
+    }
+    machine.SetSpeed(movie.Speed)
+    machine.SetQuirks(movie.Quirks)
+    machine.SetStackPolicy(movie.Stack)
+    machine.SetRandom(movie.Random, movie.Seed)
+    machine.SetWindow(&moviePlayer{movie: movie, frame: -1})
+
+    for range movie.Frames {
+        if err := machine.runFrame(); err == ErrExit {
+            break
+        } else if err != nil {
+            return machine, err
+        }
+    }
+    if machine.Screen() != movie.Screen {
+        return machine, ErrReplayMismatch
+    }
+    return machine, nil
+}
+
+// MovieRecorder is a window that records the input of another window into a movie.
+// Quick saves and rewinding would break the replay, so the recorder doesn't pass them on.
+type MovieRecorder struct {
+    Window
+    machine *Machine
+    movie   *Movie
+    keys    uint16 // Snapshot of the keys for the current frame
+}
+
+// Record a machine that has just been created for the ROM, reading input from window.
+// The machine's RND sequence restarts from its seed so that the replay draws the same
+// numbers. Set the recorder as the machine's window.
+func NewMovieRecorder(machine *Machine, rom []byte, window Window) *MovieRecorder {
+    algorithm, seed := machine.Random()
+    machine.SetRandom(algorithm, seed)
+    movie := &Movie{
+        ROMHash: sha256.Sum256(rom), Speed: int(machine.speed), Quirks: machine.Quirks(),
+        Stack: machine.StackPolicy(), XOChip: machine.XOChip(), Random: algorithm, Seed: seed,
+    }
+    return &MovieRecorder{Window: window, machine: machine, movie: movie}
+}
+
+// Keys are read once at the start of each frame, so that the program sees the same
+// state through the frame when recording and replaying
+func (r *MovieRecorder) startFrame() {
+    r.keys = 0
+    for key := HexKey(0); key < 16; key++ {
+        if r.Window.IsKeyPressed(key) {
+            r.keys |= 1 << key
+        }
+    }
+    r.movie.Frames = append(r.movie.Frames, r.keys)
+}
+
+func (r *MovieRecorder) IsKeyPressed(key HexKey) bool {
+    return r.keys & (1 << (key & 0xF)) != 0
+}
+
+func (r *MovieRecorder) WaitForKeyPress() HexKey {
+    key := r.Window.WaitForKeyPress()
+    r.movie.Waits = append(r.movie.Waits, KeyWait{Frame: len(r.movie.Frames) - 1, Key: key})
+    return key
+}
+
+// Keys remapped in the recorded window. Remapping changes which keyboard keys press the
+// hex keys, not the hex keys the movie records.
+func (r *MovieRecorder) RemappedKeys() *Keymap {
+    if remapping, ok := r.Window.(KeyRemapping); ok {
+        return remapping.RemappedKeys()
+    }
+    return nil
+}
+
+// The recording so far, ending with the machine's current screen
+func (r *MovieRecorder) Movie() *Movie {
+    movie := *r.movie
+    movie.Frames = append([]uint16(nil), r.movie.Frames...)
+    movie.Waits = append([]KeyWait(nil), r.movie.Waits...)
+    movie.Screen = r.machine.Screen()
+    return &movie
+}
+
+// Window that feeds a movie's input to a replaying machine
+type moviePlayer struct {
+    nullWindow
+    movie *Movie
+    frame int
+    waits int // Waits used so far
+}
+
+func (p *moviePlayer) startFrame() {
+    p.frame++
+}
+
+func (p *moviePlayer) IsKeyPressed(key HexKey) bool {
+    return p.frame < len(p.movie.Frames) && p.movie.Frames[p.frame] & (1 << (key & 0xF)) != 0
+}
+
+func (p *moviePlayer) WaitForKeyPress() HexKey {
+    if p.waits == len(p.movie.Waits) {
+        // The recording never got past this wait
+        return 0xFF
+    }
+    p.waits++
+    return p.movie.Waits[p.waits - 1].Key
+}
@@ -0,0 +1,106 @@
+package chip8
+
+import (
+    "bytes"
+    "github.com/stretchr/testify/assert"
+    "testing"
+)
+
+// Draws a column that grows while key 5 is held, at random positions:
+// LD V2, 5; SKNP V2; ADD V3, 1; RND V0, 0x3F; LD I, 0; DRW V0, V3, 1; JP 0x202
+var movieROM = []byte{
+    0x62, 0x05, 0xE2, 0xA1, 0x73, 0x01, 0xC0, 0x3F, 0xA0, 0x00, 0xD0, 0x31, 0x12, 0x02,
+}
+
+func recordMovie(rom []byte, events []KeyEvent, frames int) *Movie {
+    machine, _ := NewMachine(rom)
+    machine.SetRandom(RandomSplitMix, 7)
+    recorder := NewMovieRecorder(machine, rom, NewHeadlessWindow(events, frames))
+    NewMachineDriver(recorder, machine).RunFast()
+    return recorder.Movie()
+}
+
+func TestMovieReplaysRecording(t *testing.T) {
+    assert := assert.New(t)
+
+    events := []KeyEvent{{Frame: 3, Key: 5, Pressed: true}, {Frame: 8, Key: 5, Pressed: false}}
+    movie := recordMovie(movieROM, events, 20)
+    assert.Len(movie.Frames, 20)
+    assert.Equal(uint16(1 << 5), movie.Frames[4])
+    assert.Equal(uint16(0), movie.Frames[10])
+
+    var buf bytes.Buffer
+    assert.NoError(movie.Write(&buf))
+    loaded, err := ReadMovie(&buf)
+    assert.NoError(err)
+    assert.Equal(movie, loaded)
+
+    machine, err := loaded.Replay(movieROM)
+    assert.NoError(err)
+    assert.Equal(movie.Screen, machine.Screen())
+}
+
+func TestMovieRecorderForwardsRemapping(t *testing.T) {
+    assert := assert.New(t)
+
+    machine, _ := NewMachine(movieROM)
+    window := &TerminalWindow{keymap: DefaultKeymap()}
+    var recorder Window = NewMovieRecorder(machine, movieROM, window)
+    remapping, ok := recorder.(KeyRemapping)
+    assert.True(ok)
+    assert.Nil(remapping.RemappedKeys())
+
+    // Ctrl-R, then Escape keeps every key's binding
+    window.handle([]byte{0x12}, true)
+    for k := 0; k < 16; k++ {
+        window.handle([]byte{0x1B}, true)
+    }
+    assert.Equal([]string{"x"}, remapping.RemappedKeys().Keys(0x0))
+    assert.Nil(NewMovieRecorder(machine, movieROM, new(HeadlessWindow)).RemappedKeys())
+}
+
+func TestMovieDetectsMismatch(t *testing.T) {
+    assert := assert.New(t)
+
+    movie := recordMovie(movieROM, []KeyEvent{{Frame: 3, Key: 5, Pressed: true}}, 20)
+    other := append([]byte{}, movieROM...)
+    other[1] = 6
+    _, err := movie.Replay(other)
+    assert.Equal(ErrMovieROM, err)
+
+    // Without the recorded key the program draws elsewhere
+    movie.Frames = make([]uint16, len(movie.Frames))
+    _, err = movie.Replay(movieROM)
+    assert.Equal(ErrReplayMismatch, err)
+}
+
+func TestMovieReplaysKeyWaits(t *testing.T) {
+    assert := assert.New(t)
+
+    // LD V0, K; LD F, V0; DRW V1, V1, 5; JP 0x200
+    rom := []byte{0xF0, 0x0A, 0xF0, 0x29, 0xD1, 0x15, 0x12, 0x00}
+    events := []KeyEvent{{Frame: 2, Key: 7, Pressed: true}, {Frame: 4, Key: 9, Pressed: true}}
+    movie := recordMovie(rom, events, 10)
+    assert.Equal([]KeyWait{{Frame: 0, Key: 7}, {Frame: 0, Key: 9}}, movie.Waits[:2])
+
+    _, err := movie.Replay(rom)
+    assert.NoError(err)
+}
+
+func TestReadMovieRejectsBadData(t *testing.T) {
+    assert := assert.New(t)
+
+    _, err := ReadMovie(bytes.NewReader([]byte("not a movie")))
+    assert.Equal(ErrNotMovie, err)
+
+    var buf bytes.Buffer
+    recordMovie(movieROM, nil, 5).Write(&buf)
+    _, err = ReadMovie(bytes.NewReader(buf.Bytes()[:buf.Len() - 1]))
+    assert.Error(err)
+
+    // Movies from before CALL pushed return addresses would replay differently
+    old := append([]byte{}, buf.Bytes()...)
+    old[4] = 2
+    _, err = ReadMovie(bytes.NewReader(old))
+    assert.EqualError(err, "movie version 2 is not supported, expected 9")
+}
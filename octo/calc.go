@@ -0,0 +1,117 @@
+package octo
+
+import (
+    "math"
+    "strconv"
+)
+
+// Operators of :calc expressions. Like Octo, expressions have no precedence and evaluate
+// from right to left, so 2 * 3 + 1 is 8. Parentheses group.
+var binaryOps = map[string]func(a, b float64) float64 {
+    "+":   func(a, b float64) float64 { return a + b },
+    "-":   func(a, b float64) float64 { return a - b },
+    "*":   func(a, b float64) float64 { return a * b },
+    "/":   func(a, b float64) float64 { return a / b },
+    "%":   func(a, b float64) float64 { return float64(int(a) % int(b)) },
+    "&":   func(a, b float64) float64 { return float64(int(a) & int(b)) },
+    "|":   func(a, b float64) float64 { return float64(int(a) | int(b)) },
+    "^":   func(a, b float64) float64 { return float64(int(a) ^ int(b)) },
+    "<<":  func(a, b float64) float64 { return float64(int(a) << uint(b)) },
+    ">>":  func(a, b float64) float64 { return float64(int(a) >> uint(b)) },
+    "pow": math.Pow,
+    "min": math.Min,
+    "max": math.Max,
+    "<":   func(a, b float64) float64 { return truth(a < b) },
+    "<=":  func(a, b float64) float64 { return truth(a <= b) },
+    ">":   func(a, b float64) float64 { return truth(a > b) },
+    ">=":  func(a, b float64) float64 { return truth(a >= b) },
+    "==":  func(a, b float64) float64 { return truth(a == b) },
+    "!=":  func(a, b float64) float64 { return truth(a != b) },
+}
+
+var unaryOps = map[string]func(a float64) float64 {
+    "-":     func(a float64) float64 { return -a },
+    "~":     func(a float64) float64 { return float64(^int(a)) },
+    "!":     func(a float64) float64 { return truth(a == 0) },
+    "sin":   math.Sin,
+    "cos":   math.Cos,
+    "tan":   math.Tan,
+    "exp":   math.Exp,
+    "log":   math.Log,
+    "abs":   math.Abs,
+    "sqrt":  math.Sqrt,
+    "floor": math.Floor,
+    "ceil":  math.Ceil,
+    "sign": func(a float64) float64 {
+        if a == 0 {
+            return 0
+        }
+        return math.Copysign(1, a)
+    },
+}
+
+func truth(b bool) float64 {
+    if b {
+        return 1
+    }
+    return 0
+}
+
+// Evaluate an expression up to the closing brace, which is consumed
+func (c *compiler) calc() float64 {
+    value := c.calcExpr()
+    c.expect("}")
+    return value
+}
+
+func (c *compiler) calcExpr() float64 {
+    value := c.calcTerm()
+    if op, ok := binaryOps[c.peek()]; ok {
+        name := c.next()
+        rhs := c.calcExpr()
+        // The integer operators would panic rather than give an infinity
+        if name == "%" && int(rhs) == 0 {
+            c.errorf("modulo by zero in expression")
+        }
+        return op(value, rhs)
+    }
+    return value
+}
+
+func (c *compiler) calcTerm() float64 {
+    t := c.next()
+    if t == "(" {
+        value := c.calcExpr()
+        c.expect(")")
+        return value
+    }
+    if op, ok := unaryOps[t]; ok {
+        return op(c.calcTerm())
+    }
+    switch t {
+    case "@":
+        // Byte already compiled at an address
+        addr := int(c.calcTerm())
+        if addr < 0 || addr >= len(c.rom) {
+            c.errorf("address %X is outside memory", addr)
+        }
+        return float64(c.rom[addr])
+    case "HERE":
+        return float64(c.here)
+    case "PI":
+        return math.Pi
+    case "E":
+        return math.E
+    }
+    if value, ok := c.constant(t); ok {
+        return value
+    }
+    if value, err := strconv.ParseFloat(t, 64); err == nil {
+        return value
+    }
+    if r, ok := c.aliases[t]; ok {
+        return float64(r)
+    }
+    c.errorf("undefined name %s in expression", t)
+    return 0
+}
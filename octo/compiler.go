@@ -0,0 +1,791 @@
+// Package octo compiles Octo, the high-level CHIP-8 assembly language used by most modern
+// homebrew, into ROM images for the interpreter, including the SUPER-CHIP and XO-CHIP
+// instructions.
+package octo
+
+import (
+    "fmt"
+    "io/ioutil"
+    "strconv"
+    "strings"
+)
+
+// Programs are loaded here, and execution starts with a jump to the main label
+const origin = 0x200
+
+// Macro expansions allowed per program, to stop runaway recursion
+const maxExpansions = 10000
+
+// Problem at a line of source
+type Error struct {
+    File string
+    Line int
+    Msg  string
+}
+
+func (e *Error) Error() string {
+    return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+// Compiled ROM image
+type Program struct {
+    Bytes  []byte
+    Labels map[string]uint16
+}
+
+// Compile the Octo source file at path
+func CompileFile(path string) (*Program, error) {
+    source, err := ioutil.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    return Compile(path, source)
+}
+
+// Compile source read from the file name, which is used in error messages. Stops at the
+// first problem, returning an Error.
+func Compile(name string, source []byte) (program *Program, err error) {
+    c := &compiler{
+        file:    name,
+        tokens:  tokenize(string(source)),
+        here:    origin + 2, // Room for the jump to main
+        length:  origin + 2,
+        labels:  map[string]int{},
+        consts:  map[string]float64{},
+        aliases: map[string]int{"unpack-hi": 0x0, "unpack-lo": 0x1, "compare-temp": 0xF},
+        macros:  map[string]*macro{},
+    }
+    defer func() {
+        if r := recover(); r != nil {
+            e, ok := r.(*Error)
+            if !ok {
+                panic(r)
+            }
+            program, err = nil, e
+        }
+    }()
+    return c.compile(), nil
+}
+
+type token struct {
+    text string
+    line int
+}
+
+// Split source into whitespace separated tokens, dropping comments. Quoted strings are
+// single tokens.
+func tokenize(source string) []token {
+    var tokens []token
+    for n, line := range strings.Split(source, "\n") {
+        rest := line
+        for {
+            rest = strings.TrimLeft(rest, " \t\r")
+            if rest == "" || rest[0] == '#' {
+                break
+            }
+            end := strings.IndexAny(rest, " \t\r")
+            if rest[0] == '"' {
+                if quote := strings.IndexByte(rest[1:], '"'); quote >= 0 {
+                    end = quote + 2
+                }
+            }
+            if end < 0 {
+                end = len(rest)
+            }
+            tokens = append(tokens, token{text: rest[:end], line: n + 1})
+            rest = rest[end:]
+        }
+    }
+    return tokens
+}
+
+type macro struct {
+    args []string
+    body []token
+}
+
+// Reference to a label that wasn't defined yet when it was used
+type fixup struct {
+    addr  int
+    label string
+    kind  int
+    tok   token
+}
+
+const (
+    fixAddr     = iota // Low 12 bits of the opcode at addr
+    fixLong            // 16 bits at addr
+    fixUnpackHi        // Low 4 bits of the byte at addr
+    fixUnpackLo        // Byte at addr
+)
+
+// if ... begin or loop under construction
+type block struct {
+    kind   string // "begin" or "loop"
+    addr   int    // Jump to patch for begin, start of the loop for loop
+    breaks []int  // Jumps out of a loop made by while
+    tok    token
+}
+
+type compiler struct {
+    file       string
+    tokens     []token
+    pos        int
+    last       token // Most recently read token, for error positions
+    rom        [0x10000]byte
+    here       int
+    length     int // End of the highest address written
+    labels     map[string]int
+    consts     map[string]float64
+    aliases    map[string]int
+    macros     map[string]*macro
+    fixups     []fixup
+    blocks     []*block
+    expansions int
+}
+
+func (c *compiler) errorf(format string, args ...interface{}) {
+    panic(&Error{File: c.file, Line: c.last.line, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (c *compiler) done() bool {
+    return c.pos >= len(c.tokens)
+}
+
+func (c *compiler) peek() string {
+    if c.done() {
+        return ""
+    }
+    return c.tokens[c.pos].text
+}
+
+func (c *compiler) next() string {
+    if c.done() {
+        c.errorf("unexpected end of file")
+    }
+    c.last = c.tokens[c.pos]
+    c.pos++
+    return c.last.text
+}
+
+func (c *compiler) expect(text string) {
+    if t := c.next(); t != text {
+        c.errorf("expected %s, found %s", text, t)
+    }
+}
+
+func (c *compiler) compile() *Program {
+    for !c.done() {
+        c.statement()
+    }
+    if len(c.blocks) > 0 {
+        b := c.blocks[len(c.blocks) - 1]
+        closer := "end"
+        if b.kind == "loop" {
+            closer = "again"
+        }
+        c.last = b.tok
+        c.errorf("%s without a matching %s", b.tok.text, closer)
+    }
+    for _, f := range c.fixups {
+        addr, ok := c.labels[f.label]
+        if !ok {
+            c.last = f.tok
+            c.errorf("undefined name %s", f.label)
+        }
+        c.patch(f.addr, f.kind, addr)
+    }
+    main, ok := c.labels["main"]
+    if !ok {
+        c.errorf("program has no main label")
+    }
+    if main != origin {
+        c.rom[origin] = byte(0x10 | main >> 8 & 0xF)
+        c.rom[origin + 1] = byte(main)
+    }
+
+    labels := map[string]uint16{}
+    for name, addr := range c.labels {
+        labels[name] = uint16(addr)
+    }
+    return &Program{Bytes: append([]byte{}, c.rom[origin:c.length]...), Labels: labels}
+}
+
+func (c *compiler) patch(addr, kind, value int) {
+    switch kind {
+    case fixAddr:
+        if value > 0xFFF {
+            c.errorf("address %X is out of range, use i := long", value)
+        }
+        c.rom[addr] = c.rom[addr] & 0xF0 | byte(value >> 8)
+        c.rom[addr + 1] = byte(value)
+    case fixLong:
+        c.rom[addr] = byte(value >> 8)
+        c.rom[addr + 1] = byte(value)
+    case fixUnpackHi:
+        c.rom[addr] = c.rom[addr] & 0xF0 | byte(value >> 8 & 0xF)
+    case fixUnpackLo:
+        c.rom[addr] = byte(value)
+    }
+}
+
+func (c *compiler) emit(b ...byte) {
+    for _, v := range b {
+        if c.here >= len(c.rom) {
+            c.errorf("program runs past the end of memory")
+        }
+        c.rom[c.here] = v
+        c.here++
+    }
+    if c.here > c.length {
+        c.length = c.here
+    }
+}
+
+func (c *compiler) inst(opcode int) {
+    c.emit(byte(opcode >> 8), byte(opcode))
+}
+
+// Resolve the next token as an address. Names not defined yet resolve to zero, and are
+// patched into each of the given places once the program is complete.
+func (c *compiler) addrOperand(places ...fixup) int {
+    name := c.next()
+    if value, ok := c.constant(name); ok {
+        return int(value)
+    }
+    if !isName(name) {
+        c.errorf("expected an address, found %s", name)
+    }
+    for _, f := range places {
+        f.label, f.tok = name, c.last
+        c.fixups = append(c.fixups, f)
+    }
+    return 0
+}
+
+// Emit an instruction whose low 12 bits are an address
+func (c *compiler) jumpTo(opcode int) {
+    value := c.addrOperand(fixup{addr: c.here, kind: fixAddr})
+    if value > 0xFFF || value < 0 {
+        c.errorf("address %X is out of range", value)
+    }
+    c.inst(opcode | value)
+}
+
+// Value of a number, constant or defined label
+func (c *compiler) constant(name string) (float64, bool) {
+    if value, err := strconv.ParseInt(name, 0, 32); err == nil {
+        return float64(value), true
+    }
+    if value, ok := c.consts[name]; ok {
+        return value, true
+    }
+    if addr, ok := c.labels[name]; ok {
+        return float64(addr), true
+    }
+    return 0, false
+}
+
+// Next token as a number, constant, label or calc expression
+func (c *compiler) number() float64 {
+    if c.peek() == "{" {
+        c.next()
+        return c.calc()
+    }
+    name := c.next()
+    value, ok := c.constant(name)
+    if !ok {
+        c.errorf("undefined name %s", name)
+    }
+    return value
+}
+
+// Next token as a byte, accepting negative numbers
+func (c *compiler) byteValue() int {
+    value := int(c.number())
+    if value < -128 || value > 0xFF {
+        c.errorf("%d does not fit in a byte", value)
+    }
+    return value & 0xFF
+}
+
+func (c *compiler) nibble() int {
+    value := int(c.number())
+    if value < 0 || value > 0xF {
+        c.errorf("%d does not fit in a nibble", value)
+    }
+    return value
+}
+
+func isName(text string) bool {
+    if text == "" || text[0] >= '0' && text[0] <= '9' || strings.ContainsAny(text, "{}:\"") {
+        return false
+    }
+    _, keyword := keywords[text]
+    return !keyword
+}
+
+// Words with meaning to the compiler, which can't be used as names
+var keywords = map[string]bool{
+    ":=": true, "+=": true, "-=": true, "=-": true, "|=": true, "&=": true, "^=": true, ">>=": true,
+    "<<=": true, "==": true, "!=": true, "<": true, ">": true, "<=": true, ">=": true, "key": true,
+    "-key": true, "i": true, "if": true, "then": true, "begin": true, "else": true, "end": true,
+    "loop": true, "again": true, "while": true, "jump": true, "jump0": true, "return": true,
+    ";": true, "clear": true, "sprite": true, "random": true, "delay": true, "buzzer": true,
+    "hex": true, "bighex": true, "long": true, "bcd": true, "save": true, "load": true,
+    "saveflags": true, "loadflags": true, "hires": true, "lores": true, "exit": true,
+    "scroll-down": true, "scroll-up": true, "scroll-left": true, "scroll-right": true,
+    "plane": true, "audio": true, "pitch": true,
+}
+
+// Register name or alias, or -1
+func (c *compiler) registerIndex(text string) int {
+    if r, ok := c.aliases[text]; ok {
+        return r
+    }
+    lower := strings.ToLower(text)
+    if len(lower) == 2 && lower[0] == 'v' {
+        if r, err := strconv.ParseUint(lower[1:], 16, 4); err == nil {
+            return int(r)
+        }
+    }
+    return -1
+}
+
+func (c *compiler) isRegister() bool {
+    return !c.done() && c.registerIndex(c.peek()) >= 0
+}
+
+func (c *compiler) register() int {
+    text := c.next()
+    r := c.registerIndex(text)
+    if r < 0 {
+        c.errorf("expected a register, found %s", text)
+    }
+    return r
+}
+
+func (c *compiler) name() string {
+    text := c.next()
+    if !isName(text) || c.registerIndex(text) >= 0 {
+        c.errorf("%s can't be used as a name", text)
+    }
+    return text
+}
+
+func (c *compiler) defineLabel(name string, addr int) {
+    if _, ok := c.labels[name]; ok {
+        c.errorf("%s is already defined", name)
+    }
+    if _, ok := c.consts[name]; ok {
+        c.errorf("%s is already defined", name)
+    }
+    c.labels[name] = addr
+}
+
+func (c *compiler) statement() {
+    t := c.next()
+    switch t {
+    case ":":
+        name := c.name()
+        // A main label at the start needs no jump to reach it
+        if name == "main" && c.here == origin + 2 && c.length == origin + 2 {
+            c.here, c.length = origin, origin
+        }
+        c.defineLabel(name, c.here)
+    case ":next":
+        c.defineLabel(c.name(), c.here + 1)
+    case ":alias":
+        // Aliases may be redefined, including the ones the compiler uses itself
+        name := c.next()
+        if !isName(name) {
+            c.errorf("%s can't be used as a name", name)
+        }
+        if c.peek() == "{" {
+            c.next()
+            c.aliases[name] = int(c.calc()) & 0xF
+        } else {
+            c.aliases[name] = c.register()
+        }
+    case ":const":
+        name := c.name()
+        c.consts[name] = c.number()
+    case ":calc":
+        name := c.name()
+        c.expect("{")
+        c.consts[name] = c.calc()
+    case ":unpack":
+        nibble := 0
+        if c.peek() == "long" {
+            c.next()
+        } else {
+            nibble = c.nibble()
+        }
+        // Load the address into two registers, the high nibble ORed with the given one
+        hi, lo := c.aliases["unpack-hi"], c.aliases["unpack-lo"]
+        value := c.addrOperand(fixup{addr: c.here + 1, kind: fixUnpackHi}, fixup{addr: c.here + 3, kind: fixUnpackLo})
+        c.inst(0x6000 | hi << 8 | nibble << 4 | value >> 8 & 0xF)
+        c.inst(0x6000 | lo << 8 | value & 0xFF)
+    case ":org":
+        addr := int(c.number())
+        if addr < 0 || addr >= len(c.rom) {
+            c.errorf("address %X is outside memory", addr)
+        }
+        c.here = addr
+    case ":byte":
+        c.emit(byte(c.byteValue()))
+    case ":pointer":
+        value := c.addrOperand(fixup{addr: c.here, kind: fixLong})
+        c.emit(byte(value >> 8), byte(value))
+    case ":call":
+        c.jumpTo(0x2000)
+    case ":macro":
+        c.defineMacro()
+    case ":breakpoint", ":proto":
+        c.next()
+    case ":monitor":
+        c.next()
+        c.next()
+    case ":assert":
+        message := c.next()
+        c.expect("{")
+        if c.calc() == 0 {
+            c.errorf("assertion failed: %s", strings.Trim(message, `"`))
+        }
+    case ";", "return":
+        c.inst(0x00EE)
+    case "clear":
+        c.inst(0x00E0)
+    case "scroll-right":
+        c.inst(0x00FB)
+    case "scroll-left":
+        c.inst(0x00FC)
+    case "exit":
+        c.inst(0x00FD)
+    case "lores":
+        c.inst(0x00FE)
+    case "hires":
+        c.inst(0x00FF)
+    case "audio":
+        c.inst(0xF002)
+    case "scroll-down":
+        c.inst(0x00C0 | c.nibble())
+    case "scroll-up":
+        c.inst(0x00D0 | c.nibble())
+    case "plane":
+        plane := c.nibble()
+        if plane > 3 {
+            c.errorf("plane %d should be 0 to 3", plane)
+        }
+        c.inst(0xF001 | plane << 8)
+    case "jump":
+        c.jumpTo(0x1000)
+    case "jump0":
+        c.jumpTo(0xB000)
+    case "sprite":
+        x, y := c.register(), c.register()
+        c.inst(0xD000 | x << 8 | y << 4 | c.nibble())
+    case "bcd":
+        c.inst(0xF033 | c.register() << 8)
+    case "saveflags":
+        c.inst(0xF075 | c.register() << 8)
+    case "loadflags":
+        c.inst(0xF085 | c.register() << 8)
+    case "save", "load":
+        x := c.register()
+        if c.peek() == "-" {
+            c.next()
+            y := c.register()
+            c.inst(map[string]int{"save": 0x5002, "load": 0x5003}[t] | x << 8 | y << 4)
+        } else {
+            c.inst(map[string]int{"save": 0xF055, "load": 0xF065}[t] | x << 8)
+        }
+    case "delay":
+        c.expect(":=")
+        c.inst(0xF015 | c.register() << 8)
+    case "buzzer":
+        c.expect(":=")
+        c.inst(0xF018 | c.register() << 8)
+    case "pitch":
+        c.expect(":=")
+        c.inst(0xF03A | c.register() << 8)
+    case "i":
+        c.indexStatement()
+    case "if":
+        c.ifStatement()
+    case "else":
+        b := c.topBlock("begin", "else")
+        jump := c.here
+        c.inst(0x1000)
+        c.patch(b.addr, fixAddr, c.here)
+        b.addr = jump
+    case "end":
+        b := c.topBlock("begin", "end")
+        c.patch(b.addr, fixAddr, c.here)
+        c.blocks = c.blocks[:len(c.blocks) - 1]
+    case "loop":
+        c.blocks = append(c.blocks, &block{kind: "loop", addr: c.here, tok: c.last})
+    case "while":
+        b := c.innermostLoop()
+        c.conditional(true)
+        b.breaks = append(b.breaks, c.here)
+        c.inst(0x1000)
+    case "again":
+        b := c.topBlock("loop", "again")
+        c.inst(0x1000 | b.addr)
+        for _, addr := range b.breaks {
+            c.patch(addr, fixAddr, c.here)
+        }
+        c.blocks = c.blocks[:len(c.blocks) - 1]
+    default:
+        c.otherStatement(t)
+    }
+}
+
+// Register operations, macro calls, data bytes and subroutine calls
+func (c *compiler) otherStatement(t string) {
+    if r := c.registerIndex(t); r >= 0 {
+        c.registerStatement(r)
+        return
+    }
+    if m, ok := c.macros[t]; ok {
+        c.expand(m)
+        return
+    }
+    // Numbers and constants are data bytes
+    if _, isLabel := c.labels[t]; !isLabel {
+        if value, ok := c.constant(t); ok {
+            if value < -128 || value > 0xFF {
+                c.errorf("%v does not fit in a byte", value)
+            }
+            c.emit(byte(int(value)))
+            return
+        }
+    }
+    if !isName(t) {
+        c.errorf("unexpected %s", t)
+    }
+    // Anything else names a subroutine to call
+    c.pos--
+    c.jumpTo(0x2000)
+}
+
+func (c *compiler) registerStatement(x int) {
+    op := c.next()
+    if op == ":=" {
+        switch c.peek() {
+        case "random":
+            c.next()
+            c.inst(0xC000 | x << 8 | c.byteValue())
+        case "key":
+            c.next()
+            c.inst(0xF00A | x << 8)
+        case "delay":
+            c.next()
+            c.inst(0xF007 | x << 8)
+        default:
+            if c.isRegister() {
+                c.inst(0x8000 | x << 8 | c.register() << 4)
+            } else {
+                c.inst(0x6000 | x << 8 | c.byteValue())
+            }
+        }
+        return
+    }
+    if !c.isRegister() {
+        switch op {
+        case "+=":
+            c.inst(0x7000 | x << 8 | c.byteValue())
+            return
+        case "-=":
+            c.inst(0x7000 | x << 8 | -c.byteValue() & 0xFF)
+            return
+        }
+    }
+    codes := map[string]int{"|=": 0x1, "&=": 0x2, "^=": 0x3, "+=": 0x4, "-=": 0x5, ">>=": 0x6, "=-": 0x7, "<<=": 0xE}
+    code, ok := codes[op]
+    if !ok {
+        c.errorf("unknown operator %s", op)
+    }
+    c.inst(0x8000 | x << 8 | c.register() << 4 | code)
+}
+
+func (c *compiler) indexStatement() {
+    switch c.next() {
+    case ":=":
+        switch c.peek() {
+        case "hex":
+            c.next()
+            c.inst(0xF029 | c.register() << 8)
+        case "bighex":
+            c.next()
+            c.inst(0xF030 | c.register() << 8)
+        case "long":
+            c.next()
+            c.inst(0xF000)
+            value := c.addrOperand(fixup{addr: c.here, kind: fixLong})
+            c.emit(byte(value >> 8), byte(value))
+        default:
+            c.jumpTo(0xA000)
+        }
+    case "+=":
+        c.inst(0xF01E | c.register() << 8)
+    default:
+        c.errorf("unknown operator %s for i", c.last.text)
+    }
+}
+
+type condition struct {
+    x   int
+    op  string
+    reg int // Right hand register, or -1 for a value
+    val int
+}
+
+func (c *compiler) parseCondition() condition {
+    cond := condition{x: c.register(), op: c.next(), reg: -1}
+    switch cond.op {
+    case "key", "-key":
+    case "==", "!=", "<", ">", "<=", ">=":
+        if c.isRegister() {
+            cond.reg = c.register()
+        } else {
+            cond.val = c.byteValue()
+        }
+    default:
+        c.errorf("unknown comparison %s", cond.op)
+    }
+    return cond
+}
+
+// Emit instructions that skip the next one when the condition is false, or when it is
+// true if negated
+func (c *compiler) conditional(negated bool) {
+    cond := c.parseCondition()
+    c.emitCondition(cond, negated)
+}
+
+func (c *compiler) emitCondition(cond condition, negated bool) {
+    if negated {
+        cond.op = map[string]string{
+            "==": "!=", "!=": "==", "key": "-key", "-key": "key", "<": ">=", ">": "<=", ">=": "<", "<=": ">",
+        }[cond.op]
+    }
+    x := cond.x
+    switch cond.op {
+    case "==":
+        if cond.reg >= 0 {
+            c.inst(0x9000 | x << 8 | cond.reg << 4)
+        } else {
+            c.inst(0x4000 | x << 8 | cond.val)
+        }
+    case "!=":
+        if cond.reg >= 0 {
+            c.inst(0x5000 | x << 8 | cond.reg << 4)
+        } else {
+            c.inst(0x3000 | x << 8 | cond.val)
+        }
+    case "key":
+        c.inst(0xE0A1 | x << 8)
+    case "-key":
+        c.inst(0xE09E | x << 8)
+    default:
+        // Compare through a temporary register. The subtraction's carry says which side is
+        // larger.
+        temp := c.aliases["compare-temp"]
+        if cond.reg >= 0 {
+            c.inst(0x8000 | temp << 8 | cond.reg << 4)
+        } else {
+            c.inst(0x6000 | temp << 8 | cond.val)
+        }
+        switch cond.op {
+        case ">":
+            c.inst(0x8005 | temp << 8 | x << 4) // temp -= vx
+            c.inst(0x3001 | temp << 8)
+        case "<":
+            c.inst(0x8007 | temp << 8 | x << 4) // temp =- vx
+            c.inst(0x3001 | temp << 8)
+        case ">=":
+            c.inst(0x8007 | temp << 8 | x << 4)
+            c.inst(0x4001 | temp << 8)
+        case "<=":
+            c.inst(0x8005 | temp << 8 | x << 4)
+            c.inst(0x4001 | temp << 8)
+        }
+    }
+}
+
+func (c *compiler) ifStatement() {
+    start := c.last
+    cond := c.parseCondition()
+    switch c.next() {
+    case "then":
+        c.emitCondition(cond, false)
+    case "begin":
+        c.emitCondition(cond, true)
+        c.blocks = append(c.blocks, &block{kind: "begin", addr: c.here, tok: start})
+        c.inst(0x1000)
+    default:
+        c.errorf("expected then or begin, found %s", c.last.text)
+    }
+}
+
+// Innermost open block, which must be of the given kind
+func (c *compiler) topBlock(kind, word string) *block {
+    if len(c.blocks) == 0 || c.blocks[len(c.blocks) - 1].kind != kind {
+        c.errorf("%s without a matching %s", word, kind)
+    }
+    return c.blocks[len(c.blocks) - 1]
+}
+
+func (c *compiler) innermostLoop() *block {
+    for k := len(c.blocks) - 1; k >= 0; k-- {
+        if c.blocks[k].kind == "loop" {
+            return c.blocks[k]
+        }
+    }
+    c.errorf("while outside of a loop")
+    return nil
+}
+
+// :macro name args { body }
+func (c *compiler) defineMacro() {
+    name := c.name()
+    m := &macro{}
+    for c.peek() != "{" {
+        m.args = append(m.args, c.name())
+    }
+    c.next()
+    for depth := 1; ; {
+        t := c.tokens[c.pos]
+        c.next()
+        if t.text == "{" {
+            depth++
+        } else if t.text == "}" {
+            if depth--; depth == 0 {
+                break
+            }
+        }
+        m.body = append(m.body, t)
+    }
+    c.macros[name] = m
+}
+
+// Replace a macro call with its body, substituting the arguments that follow the call
+func (c *compiler) expand(m *macro) {
+    if c.expansions++; c.expansions > maxExpansions {
+        c.errorf("too many macro expansions, is a macro calling itself?")
+    }
+    args := map[string]string{}
+    for _, arg := range m.args {
+        args[arg] = c.next()
+    }
+    body := make([]token, len(m.body))
+    for k, t := range m.body {
+        if value, ok := args[t.text]; ok {
+            t.text = value
+        }
+        body[k] = t
+    }
+    c.tokens = append(c.tokens[:c.pos], append(body, c.tokens[c.pos:]...)...)
+}
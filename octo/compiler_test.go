@@ -0,0 +1,220 @@
+package octo
+
+import (
+    "fmt"
+    "github.com/eskrm/chip8"
+    "github.com/stretchr/testify/assert"
+    "testing"
+)
+
+func compile(assert *assert.Assertions, source string) []byte {
+    program, err := Compile("test.8o", []byte(source))
+    if !assert.NoError(err) {
+        return nil
+    }
+    return program.Bytes
+}
+
+func TestCompileStatements(t *testing.T) {
+    assert := assert.New(t)
+
+    assert.Equal([]byte{
+        0x00, 0xE0, // clear
+        0x6A, 0x05, // va := 5
+        0x81, 0x20, // v1 := v2
+        0x71, 0xFF, // v1 -= 1
+        0x81, 0x25, // v1 -= v2
+        0x81, 0x27, // v1 =- v2
+        0x81, 0x2E, // v1 <<= v2
+        0xC3, 0x0F, // v3 := random 15
+        0xF4, 0x0A, // v4 := key
+        0xF4, 0x07, // v4 := delay
+        0xF4, 0x15, // delay := v4
+        0xF4, 0x18, // buzzer := v4
+        0xA2, 0x34, // i := 0x234
+        0xF0, 0x00, 0x12, 0x34, // i := long 0x1234
+        0xF5, 0x29, // i := hex v5
+        0xF5, 0x30, // i := bighex v5
+        0xF5, 0x1E, // i += v5
+        0xD1, 0x28, // sprite v1 v2 8
+        0xF3, 0x33, // bcd v3
+        0xF3, 0x55, // save v3
+        0x52, 0x43, // load v2 - v4
+        0xF7, 0x75, // saveflags v7
+        0x00, 0xFF, // hires
+        0x00, 0xC4, // scroll-down 4
+        0xF2, 0x01, // plane 2
+        0xF6, 0x3A, // pitch := v6
+        0x00, 0xEE, // ;
+    }, compile(assert, `
+        : main
+        clear
+        va := 5  v1 := v2  v1 -= 1  v1 -= v2  v1 =- v2  v1 <<= v2
+        v3 := random 15  v4 := key  v4 := delay  delay := v4  buzzer := v4
+        i := 0x234  i := long 0x1234  i := hex v5  i := bighex v5  i += v5
+        sprite v1 v2 8  bcd v3  save v3  load v2 - v4  saveflags v7
+        hires  scroll-down 4  plane 2  pitch := v6 ;
+    `))
+}
+
+func TestCompileLabelsAndData(t *testing.T) {
+    assert := assert.New(t)
+
+    program, err := Compile("test.8o", []byte(`
+        :const SIZE 3
+        : main
+            i := ship
+            draw
+            jump main
+        : draw sprite v0 v1 SIZE ;
+        : ship 0x3C 0b01000010 SIZE
+        :next target v0 := 0
+        :byte { SIZE * 2 + 1 }
+    `))
+    assert.NoError(err)
+    assert.Equal([]byte{
+        0xA2, 0x0A, 0x22, 0x06, 0x12, 0x00,
+        0xD0, 0x13, 0x00, 0xEE,
+        0x3C, 0x42, 0x03,
+        0x60, 0x00,
+        0x09,
+    }, program.Bytes[:16])
+    assert.Equal(uint16(0x20A), program.Labels["ship"])
+    assert.Equal(uint16(0x20E), program.Labels["target"])
+}
+
+func TestCompileJumpToMain(t *testing.T) {
+    assert := assert.New(t)
+
+    // Code before main is reached by a jump at the start
+    assert.Equal([]byte{0x12, 0x04, 0x00, 0xEE, 0x00, 0xE0},
+                 compile(assert, ": sub ; : main clear"))
+}
+
+func TestCompileControlFlow(t *testing.T) {
+    assert := assert.New(t)
+
+    assert.Equal([]byte{
+        0x40, 0x01, // if v0 == 1 then
+        0x61, 0x02, // v1 := 2
+        0x41, 0x03, // if v1 != 3 begin
+        0x12, 0x0C,
+        0x62, 0x00, // v2 := 0
+        0x12, 0x0E, // else
+        0x62, 0x01, // v2 := 1, end
+        0x70, 0x01, // loop v0 += 1
+        0x80, 0x00, // v0 := v0
+        0x6F, 0x05, // while v0 < 5: vf := 5
+        0x8F, 0x07, // vf =- v0
+        0x4F, 0x01,
+        0x12, 0x1C,
+        0x12, 0x0E, // again
+    }, compile(assert, `: main
+        if v0 == 1 then v1 := 2
+        if v1 != 3 begin v2 := 0 else v2 := 1 end
+        loop v0 += 1 v0 := v0 while v0 < 5 again
+    `)[:28])
+}
+
+func TestCompileComparisons(t *testing.T) {
+    assert := assert.New(t)
+
+    // Each comparison skips the next instruction when it is false
+    cases := map[string][]byte{
+        "v1 > 5":    {0x6F, 0x05, 0x8F, 0x15, 0x3F, 0x01},
+        "v1 < 5":    {0x6F, 0x05, 0x8F, 0x17, 0x3F, 0x01},
+        "v1 >= v2":  {0x8F, 0x20, 0x8F, 0x17, 0x4F, 0x01},
+        "v1 <= v2":  {0x8F, 0x20, 0x8F, 0x15, 0x4F, 0x01},
+        "v1 key":    {0xE1, 0xA1},
+        "v1 -key":   {0xE1, 0x9E},
+        "v1 == v2":  {0x91, 0x20},
+    }
+    for cond, code := range cases {
+        assert.Equal(code, compile(assert, ": main if " + cond + " then")[:len(code)], cond)
+    }
+}
+
+// Runs the comparisons on a machine, since their VF juggling is easy to get wrong
+func TestComparisonsRun(t *testing.T) {
+    assert := assert.New(t)
+
+    results := map[string][3]bool{
+        "==": {false, true, false},
+        "!=": {true, false, true},
+        "<":  {true, false, false},
+        ">":  {false, false, true},
+        "<=": {true, true, false},
+        ">=": {false, true, true},
+    }
+    for op, want := range results {
+        for i, v0 := range []int{3, 5, 7} {
+            for _, rhs := range []string{"5", "v2"} {
+                cond := fmt.Sprintf("v0 %s %s", op, rhs)
+                then := fmt.Sprintf(": main v0 := %d v2 := 5 v1 := 0 if %s then v1 := 1 loop again", v0, cond)
+                assert.Equal(want[i], runCompiled(assert, then)[1] == 1, "%s with v0 = %d", cond, v0)
+                block := fmt.Sprintf(": main v0 := %d v2 := 5 if %s begin v1 := 1 else v1 := 2 end loop again", v0, cond)
+                assert.Equal(want[i], runCompiled(assert, block)[1] == 1, "%s begin with v0 = %d", cond, v0)
+            }
+        }
+    }
+}
+
+func runCompiled(assert *assert.Assertions, source string) [16]byte {
+    machine, err := chip8.NewMachine(compile(assert, source))
+    if !assert.NoError(err) {
+        return [16]byte{}
+    }
+    for i := 0; i < 20; i++ {
+        assert.NoError(machine.Step())
+    }
+    return machine.V()
+}
+
+func TestCompileMacrosAndAliases(t *testing.T) {
+    assert := assert.New(t)
+
+    assert.Equal([]byte{0x73, 0x02, 0x74, 0x02, 0x63, 0x12, 0x64, 0x34, 0x6A, 0x03}, compile(assert, `
+        :alias x v3
+        :macro bump reg { reg += 2 }
+        :calc ADDR { 0x1234 }
+        :alias unpack-hi x
+        :alias unpack-lo v4
+        : main bump x bump v4
+        :unpack 1 ADDR
+        va := { 6 / 2 }
+    `))
+}
+
+func TestCompileCalc(t *testing.T) {
+    assert := assert.New(t)
+
+    // Expressions evaluate right to left
+    assert.Equal([]byte{8, 7, 4, 0xF0, 0x04, 0x05}, compile(assert, `
+        :calc A { 2 * 3 + 1 }
+        :calc B { ( 2 * 3 ) + 1 }
+        : main
+        :byte A :byte B :byte { 4 max -1 } :byte { 0xFF & ~ 0x0F }
+        :byte { HERE - 0x200 } :byte { @ 0x201 - 2 }
+    `))
+}
+
+func TestCompileErrors(t *testing.T) {
+    assert := assert.New(t)
+
+    _, err := Compile("test.8o", []byte(": main\nv0 := 256"))
+    assert.EqualError(err, "test.8o:2: 256 does not fit in a byte")
+    _, err = Compile("test.8o", []byte(": main\njump nowhere"))
+    assert.EqualError(err, "test.8o:2: undefined name nowhere")
+    _, err = Compile("test.8o", []byte("clear"))
+    assert.EqualError(err, "test.8o:1: program has no main label")
+    _, err = Compile("test.8o", []byte(": main\n\nloop clear"))
+    assert.EqualError(err, "test.8o:3: loop without a matching again")
+    _, err = Compile("test.8o", []byte(": main end"))
+    assert.EqualError(err, "test.8o:1: end without a matching begin")
+    _, err = Compile("test.8o", []byte(":calc x { 1 % 0 }\n: main"))
+    assert.EqualError(err, "test.8o:1: modulo by zero in expression")
+    _, err = Compile("test.8o", []byte(": main\n:byte { 7 % 0.5 }"))
+    assert.EqualError(err, "test.8o:2: modulo by zero in expression")
+    _, err = Compile("test.8o", []byte(":macro m { m }\n: main m"))
+    assert.Error(err)
+}
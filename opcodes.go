@@ -1,429 +1,800 @@
 package chip8
 
 import (
-    "fmt"
-    "math/rand"
     "time"
 )
 
-type Opcode func(*Context)
+type Opcode func(*Context) error
 
-var opcodes = [17]Opcode { ops0, jp, call, seb, sneb, se, ldb, addb, ops8,
+var opcodes = [17]Opcode { ops0, jp, call, seb, sneb, ops5, ldb, addb, ops8,
                            sne, ldn, jpn, rnd, drw, opse, opsf }
 
-func runOpcode(context *Context) {
-    opcodes[(context.opcode & 0xF000) >> 12](context)
+func runOpcode(context *Context) error {
+    return opcodes[(context.opcode & 0xF000) >> 12](context)
+}
+
+func illegal(context *Context) error {
+    return &IllegalInstructionError{PC: context.cpu.pc, Opcode: context.opcode}
+}
+
+// Advance past the next instruction, which is four bytes long if it is an XO-CHIP long load
+func skip(context *Context) {
+    pc := int(context.cpu.pc) + 2
+    if context.xochip && pc + 1 < len(context.memory) && context.memory[pc] == 0xF0 && context.memory[pc + 1] == 0x00 {
+        context.cpu.pc += 2
+    }
+    context.cpu.pc += 2
+}
+
+// Check that the n bytes starting at addr lie within memory
+func checkMemory(context *Context, addr uint16, n int) error {
+    if int(addr) + n > context.memorySize() {
+        return &MemoryError{PC: context.cpu.pc, Address: int(addr) + n - 1}
+    }
+    return nil
 }
 
 // 0xxx opcodes
-func ops0(context *Context) {
+func ops0(context *Context) error {
+    switch context.opcode & 0x00F0 {
+    case 0xC0:
+        return scd(context)
+    case 0xD0:
+        if !context.xochip {
+            return illegal(context)
+        }
+        return scu(context)
+    }
     switch context.opcode & 0x00FF {
     case 0xE0:
-        cls(context)
+        return cls(context)
     case 0xEE:
-        ret(context)
+        return ret(context)
+    case 0xFB:
+        return scr(context)
+    case 0xFC:
+        return scl(context)
+    case 0xFD:
+        return exit(context)
+    case 0xFE:
+        return low(context)
+    case 0xFF:
+        return high(context)
     default:
-        panic(fmt.Sprintf("Unrecognized opcode %v!", context.opcode))
+        return illegal(context)
     }
 }
 
+// 00Cn - SCD nibble
+// Scroll display down n lines
+func scd(context *Context) error {
+    context.screen.scroll(0, int(context.opcode & 0x000F), context.planes)
+    context.window.Draw(&context.screen)
+    context.cpu.pc += 2
+    return nil
+}
+
+// 00Dn - SCU nibble
+// Scroll display up n lines
+func scu(context *Context) error {
+    context.screen.scroll(0, -int(context.opcode & 0x000F), context.planes)
+    context.window.Draw(&context.screen)
+    context.cpu.pc += 2
+    return nil
+}
+
 // 00E0 - CLS
-// Clear the display
-func cls(context *Context) {
-    for i := range(context.screen) {
-        for j := range context.screen[i] {
-            context.screen[i][j] = 0
-        }
+// Clear the selected planes of the display
+func cls(context *Context) error {
+    context.screen.clear(context.planes)
+    if context.screen.Pixels == [128][64]byte{} {
+        context.window.Clear()
+    } else {
+        context.window.Draw(&context.screen)
     }
-    context.window.Clear()
     context.cpu.pc += 2
+    return nil
 }
 
 // 00EE - RET
 // Return from a subroutine
-func ret(context *Context) {
-    context.cpu.pc = context.stack[context.cpu.sp]
-    context.cpu.sp--
+func ret(context *Context) error {
+    addr, err := context.pop()
+    if err != nil {
+        return err
+    }
+    context.cpu.pc = addr
+    return nil
+}
+
+// 00FB - SCR
+// Scroll display right 4 pixels
+func scr(context *Context) error {
+    context.screen.scroll(4, 0, context.planes)
+    context.window.Draw(&context.screen)
+    context.cpu.pc += 2
+    return nil
+}
+
+// 00FC - SCL
+// Scroll display left 4 pixels
+func scl(context *Context) error {
+    context.screen.scroll(-4, 0, context.planes)
+    context.window.Draw(&context.screen)
+    context.cpu.pc += 2
+    return nil
+}
+
+// 00FD - EXIT
+// Exit the interpreter
+func exit(context *Context) error {
+    return ErrExit
+}
+
+// 00FE - LOW
+// Disable high resolution mode and clear the display
+func low(context *Context) error {
+    context.screen.setHires(false)
+    context.window.Clear()
+    context.cpu.pc += 2
+    return nil
+}
+
+// 00FF - HIGH
+// Enable 128x64 high resolution mode and clear the display
+func high(context *Context) error {
+    context.screen.setHires(true)
+    context.window.Clear()
+    context.cpu.pc += 2
+    return nil
 }
 
 // 1nnn - JP nibble
 // Jump to location nnn
-func jp(context *Context) {
+func jp(context *Context) error {
     context.cpu.pc = context.opcode & 0x0FFF
+    return nil
 }
 
 // 2nnn - CALL nibble
-// Call subroutine at nnn
-func call(context *Context) {
-    context.cpu.sp++
-    context.stack[context.cpu.sp] = context.cpu.pc
+// Call subroutine at nnn, pushing the address of the next instruction to return to
+func call(context *Context) error {
+    if err := context.push(context.cpu.pc + 2); err != nil {
+        return err
+    }
     context.cpu.pc = context.opcode & 0x0FFF
+    return nil
 }
 
 // 3xkk - SE Vx, byte
 // Skip next instruction if Vx = kk
-func seb(context *Context) {
+func seb(context *Context) error {
     x := context.opcode & 0x0F00 >> 8
     b := byte(context.opcode & 0xFF)
     if context.cpu.v[x] == b {
-        context.cpu.pc += 2
+        skip(context)
     }
     context.cpu.pc += 2
+    return nil
 }
 
 // 4xkk - SNE Vx, byte
 // Skip next instruction if Vx != kk
-func sneb(context *Context) {
+func sneb(context *Context) error {
     x := context.opcode & 0x0F00 >> 8
     b := byte(context.opcode & 0xFF)
     if context.cpu.v[x] != b {
-        context.cpu.pc += 2
+        skip(context)
     }
     context.cpu.pc += 2
+    return nil
+}
+
+// 5xxx opcodes
+func ops5(context *Context) error {
+    switch context.opcode & 0x000F {
+    case 0x0:
+        return se(context)
+    case 0x2:
+        if !context.xochip {
+            return illegal(context)
+        }
+        return strange(context)
+    case 0x3:
+        if !context.xochip {
+            return illegal(context)
+        }
+        return ldrange(context)
+    default:
+        return illegal(context)
+    }
 }
 
 // 5xy0 - SE Vx, Vy
 // Skip next instruction if Vx = Vy
-func se(context *Context) {
+func se(context *Context) error {
     x := context.opcode & 0x0F00 >> 8
     y := context.opcode & 0x00F0 >> 4
     if context.cpu.v[x] == context.cpu.v[y] {
-        context.cpu.pc += 2
+        skip(context)
+    }
+    context.cpu.pc += 2
+    return nil
+}
+
+// Registers Vx through Vy in order, which is descending if x > y
+func registerRange(context *Context) []uint16 {
+    x := context.opcode & 0x0F00 >> 8
+    y := context.opcode & 0x00F0 >> 4
+    regs := []uint16{x}
+    for r := x; r != y; {
+        if x < y {
+            r++
+        } else {
+            r--
+        }
+        regs = append(regs, r)
+    }
+    return regs
+}
+
+// 5xy2 - ST [I], Vx - Vy
+// Store registers Vx through Vy in memory starting at location I, leaving I unchanged
+func strange(context *Context) error {
+    regs := registerRange(context)
+    if err := checkMemory(context, context.cpu.i, len(regs)); err != nil {
+        return err
+    }
+    for k, r := range regs {
+        context.write(int(context.cpu.i) + k, context.cpu.v[r])
     }
     context.cpu.pc += 2
+    return nil
+}
+
+// 5xy3 - LD Vx - Vy, [I]
+// Read registers Vx through Vy from memory starting at location I, leaving I unchanged
+func ldrange(context *Context) error {
+    regs := registerRange(context)
+    if err := checkMemory(context, context.cpu.i, len(regs)); err != nil {
+        return err
+    }
+    for k, r := range regs {
+        context.cpu.v[r] = context.read(int(context.cpu.i) + k)
+    }
+    context.cpu.pc += 2
+    return nil
 }
 
 // 6xkk - LD Vx, byte
 // Set Vx = kk
-func ldb(context *Context) {
+func ldb(context *Context) error {
     x := context.opcode & 0x0F00 >> 8
     b := byte(context.opcode & 0x00FF)
     context.cpu.v[x] = b
     context.cpu.pc += 2
+    return nil
 }
 
 // 7xkk - ADD Vx, byte
 // Set Vx = Vx + kk
-func addb(context *Context) {
+func addb(context *Context) error {
     x := context.opcode & 0x0F00 >> 8
     b := byte(context.opcode & 0x00FF)
     context.cpu.v[x] += b
     context.cpu.pc += 2
+    return nil
 }
 
 // 8xxx opcodes
-func ops8(context *Context) {
+func ops8(context *Context) error {
+    var err error
     switch context.opcode & 0x000F {
     case 0x0:
-        mv(context)
+        err = mv(context)
     case 0x1:
-        or(context)
+        err = or(context)
     case 0x2:
-        and(context)
+        err = and(context)
     case 0x3:
-        xor(context)
+        err = xor(context)
     case 0x4:
-        add(context)
+        err = add(context)
     case 0x5:
-        sub(context)
+        err = sub(context)
     case 0x6:
-        shr(context)
+        err = shr(context)
     case 0x7:
-        subn(context)
+        err = subn(context)
     case 0xE:
-        shl(context)
+        err = shl(context)
     default:
-        panic(fmt.Sprintf("Unrecognized opcode %v!", context.opcode))
+        return illegal(context)
+    }
+    if err != nil {
+        return err
     }
     context.cpu.pc += 2
+    return nil
 }
 
 // 8xy0 - MV Vx, Vy
 // Set Vx = Vy
-func mv(context *Context) {
+func mv(context *Context) error {
     x := context.opcode & 0x0F00 >> 8
     y := context.opcode & 0x00F0 >> 4
     context.cpu.v[x] = context.cpu.v[y]
+    return nil
 }
 
 // 8xy1 - OR Vx, Vy
 // Set Vx = Vx OR Vy
-func or(context *Context) {
+func or(context *Context) error {
     x := context.opcode & 0x0F00 >> 8
     y := context.opcode & 0x00F0 >> 4
     context.cpu.v[x] = context.cpu.v[x] | context.cpu.v[y]
+    if context.quirks.LogicResetsVF {
+        context.cpu.v[0xF] = 0
+    }
+    return nil
 }
 
 // 8xy2 - AND Vx, Vy
 // Set Vx = Vx AND Vy
-func and(context *Context) {
+func and(context *Context) error {
     x := context.opcode & 0x0F00 >> 8
     y := context.opcode & 0x00F0 >> 4
     context.cpu.v[x] = context.cpu.v[x] & context.cpu.v[y]
+    if context.quirks.LogicResetsVF {
+        context.cpu.v[0xF] = 0
+    }
+    return nil
 }
 
 // 8xy3 - XOR Vx, Vy
 // Set Vx = Vx XOR Vy.
-func xor(context *Context) {
+func xor(context *Context) error {
     x := context.opcode & 0x0F00 >> 8
     y := context.opcode & 0x00F0 >> 4
     context.cpu.v[x] = context.cpu.v[x] ^ context.cpu.v[y]
+    if context.quirks.LogicResetsVF {
+        context.cpu.v[0xF] = 0
+    }
+    return nil
+}
+
+// Set Vx to an arithmetic result, then VF to its flag. VF is written last so that it
+// holds the flag when x is F.
+func setWithFlag(context *Context, x uint16, result byte, flag bool) {
+    context.cpu.v[x] = result
+    if flag {
+        context.cpu.v[0xF] = 1
+    } else {
+        context.cpu.v[0xF] = 0
+    }
 }
 
 // 8xy4 - ADD Vx, Vy
 // Set Vx = Vx + Vy, set VF = carry
-func add(context *Context) {
+func add(context *Context) error {
     x := context.opcode & 0x0F00 >> 8
     y := context.opcode & 0x00F0 >> 4
     sum := uint16(context.cpu.v[x]) + uint16(context.cpu.v[y])
-    if sum > 255 {
-        context.cpu.v[0xF] = 1
-    } else {
-        context.cpu.v[0xF] = 0
-    }
-    context.cpu.v[x] = byte(sum & 0xFF)
+    setWithFlag(context, x, byte(sum & 0xFF), sum > 255)
+    return nil
 }
 
 // 8xy5 - SUB Vx, Vy
 // Set Vx = Vx - Vy, set VF = NOT borrow
-func sub(context *Context) {
+func sub(context *Context) error {
     x := context.opcode & 0x0F00 >> 8
     y := context.opcode & 0x00F0 >> 4
-    if context.cpu.v[x] > context.cpu.v[y] {
-        context.cpu.v[0xF] = 1
-    } else {
-        context.cpu.v[0xF] = 0
-    }
-    context.cpu.v[x] = context.cpu.v[x] - context.cpu.v[y]
+    vx, vy := context.cpu.v[x], context.cpu.v[y]
+    setWithFlag(context, x, vx - vy, vx >= vy)
+    return nil
 }
 
 // 8xy6 - SHR Vx {, Vy}
-// Set Vx = Vx SHR 1
-func shr(context *Context) {
+// Set Vx = Vx SHR 1, or Vy SHR 1 with the ShiftUsesVy quirk, set VF = the bit shifted out
+func shr(context *Context) error {
     x := context.opcode & 0x0F00 >> 8
-    if context.cpu.v[x] & 0x1 == 0x1 {
-        context.cpu.v[0xF] = 1
-    } else {
-        context.cpu.v[0xF] = 0
+    value := context.cpu.v[x]
+    if context.quirks.ShiftUsesVy {
+        value = context.cpu.v[context.opcode & 0x00F0 >> 4]
     }
-    context.cpu.v[x] /= 2
+    setWithFlag(context, x, value >> 1, value & 0x1 == 0x1)
+    return nil
 }
 
 // 8xy7 - SUBN Vx, Vy
 // Set Vx = Vy - Vx, set VF = NOT borrow
-func subn(context *Context) {
+func subn(context *Context) error {
     x := context.opcode & 0x0F00 >> 8
     y := context.opcode & 0x00F0 >> 4
-    if context.cpu.v[y] > context.cpu.v[x] {
-        context.cpu.v[0xF] = 1
-    } else {
-        context.cpu.v[0xF] = 0
-    }
-    context.cpu.v[x] = context.cpu.v[x] - context.cpu.v[y]
+    vx, vy := context.cpu.v[x], context.cpu.v[y]
+    setWithFlag(context, x, vy - vx, vy >= vx)
+    return nil
 }
 
 // 8xyE - SHL Vx {, Vy}
-// Set Vx = Vx SHL 1
-func shl(context *Context) {
+// Set Vx = Vx SHL 1, or Vy SHL 1 with the ShiftUsesVy quirk, set VF = the bit shifted out
+func shl(context *Context) error {
     x := context.opcode & 0x0F00 >> 8
-    if context.cpu.v[x] & 0x8 == 0x8 {
-        context.cpu.v[0xF] = 1
-    } else {
-        context.cpu.v[0xF] = 0
+    value := context.cpu.v[x]
+    if context.quirks.ShiftUsesVy {
+        value = context.cpu.v[context.opcode & 0x00F0 >> 4]
     }
-    context.cpu.v[x] *= 2
+    setWithFlag(context, x, value << 1, value & 0x80 == 0x80)
+    return nil
 }
 
 // 9xy0 - SNE Vx, Vy
 // Skip next instruction if Vx != Vy
-func sne(context *Context) {
+func sne(context *Context) error {
     x := context.opcode & 0x0F00 >> 8
     y := context.opcode & 0x00F0 >> 4
     if context.cpu.v[x] != context.cpu.v[y] {
-        context.cpu.pc += 2
+        skip(context)
     }
     context.cpu.pc += 2
+    return nil
 }
 
 // Annn - LD I, nibble
 // Set I = nnn
-func ldn(context *Context) {
+func ldn(context *Context) error {
     n := context.opcode & 0x0FFF
     context.cpu.i = n
     context.cpu.pc += 2
+    return nil
 }
 
 // Bnnn - JP V0, nibble
-// Jump to location V0 + nnn
-func jpn(context *Context) {
+// Jump to location V0 + nnn, or xnn + Vx with the JumpUsesVx quirk
+func jpn(context *Context) error {
     n := context.opcode & 0x0FFF
-    context.cpu.pc = uint16(context.cpu.v[0]) + n
+    if context.quirks.JumpUsesVx {
+        context.cpu.pc = uint16(context.cpu.v[n >> 8]) + n
+    } else {
+        context.cpu.pc = uint16(context.cpu.v[0]) + n
+    }
+    return nil
 }
 
 // Cxkk - RND Vx, byte
 // Set Vx = random byte AND kk
-func rnd(context *Context) {
+func rnd(context *Context) error {
     x := context.opcode & 0x0F00 >> 8
     b := byte(context.opcode & 0xFF)
-    context.cpu.v[x] = b & byte(rand.Intn(256))
+    context.cpu.v[x] = b & context.rng.byte()
     context.cpu.pc += 2
+    return nil
 }
 
 // Dxyn - DRW Vx, Vy, nibble
 // Display n-byte sprite starting at memory location I at (Vx, Vy), set VF = collision
-func drw(context *Context) {
+// Dxy0 displays a 16x16 sprite of 32 bytes. With two XO-CHIP planes selected, the
+// sprite for the second plane follows the first in memory.
+func drw(context *Context) error {
     x := context.opcode & 0x0F00 >> 8
     y := context.opcode & 0x00F0 >> 4
-    n := context.opcode & 0x000F
-    vx, vy := int(context.cpu.v[x]), int(context.cpu.v[y])
+    n := int(context.opcode & 0x000F)
+    screen := &context.screen
+    vx, vy := int(context.cpu.v[x]) % screen.Width, int(context.cpu.v[y]) % screen.Height
 
-    sprite := context.memory[context.cpu.i:context.cpu.i + n]
+    width, height := 8, n
+    if n == 0 {
+        width, height = 16, 16
+    }
+    size := width / 8 * height
+    planes := []byte{}
+    for plane := byte(1); plane <= 2; plane <<= 1 {
+        if context.planes & plane != 0 {
+            planes = append(planes, plane)
+        }
+    }
+    if err := checkMemory(context, context.cpu.i, size * len(planes)); err != nil {
+        return err
+    }
 
     // Xor screen with sprite
-    // Clear VF and set to 1 if there is any pixel collision
+    // Clear VF and set to 1 if any pixel is turned off
     context.cpu.v[0xF] = 0
-    for j := 0; j < len(sprite); j++ {
-        for i := 0; i < 8; i++ {
-            shift := uint(8 - i - 1)
-            pixel := context.screen[(vx + i) % 64][(vy + j) % 32] ^ (sprite[j] >> shift) & 0x1
-            context.screen[(vx + i) % 64][(vy + j) % 32] = pixel
-            context.cpu.v[0xF] |= pixel
+    for k, plane := range planes {
+        sprite := make([]byte, size)
+        for b := range sprite {
+            sprite[b] = context.read(int(context.cpu.i) + k * size + b)
+        }
+        for j := 0; j < height; j++ {
+            row := uint16(sprite[j]) << 8
+            if width == 16 {
+                row = uint16(sprite[2 * j]) << 8 | uint16(sprite[2 * j + 1])
+            }
+            for i := 0; i < width; i++ {
+                px, py := vx + i, vy + j
+                if context.quirks.ClipSprites && (px >= screen.Width || py >= screen.Height) {
+                    continue
+                }
+                px, py = px % screen.Width, py % screen.Height
+                if (row >> uint(16 - i - 1)) & 0x1 == 0 {
+                    continue
+                }
+                if screen.Pixels[px][py] & plane != 0 {
+                    context.cpu.v[0xF] = 1
+                }
+                screen.Pixels[px][py] ^= plane
+            }
         }
     }
 
-    if context.cpu.v[0xF] > 0 {
-        context.window.Draw(&context.screen)
+    context.window.Draw(screen)
+    if context.quirks.DisplayWait {
+        context.vblank = true
     }
     context.cpu.pc += 2
+    return nil
 }
 
-func opse(context *Context) {
+func opse(context *Context) error {
     switch context.opcode & 0x00FF {
     case 0x9E:
-        skp(context)
+        return skp(context)
     case 0xA1:
-        sknp(context)
+        return sknp(context)
     default:
-        panic(fmt.Sprintf("Unrecognized opcode %v!", context.opcode))
+        return illegal(context)
     }
 }
 
 // Ex9E - SKP Vx
 // Skip next instruction if key with the value of Vx is pressed
-func skp(context *Context) {
+func skp(context *Context) error {
     x := context.opcode & 0x0F00 >> 8
     if context.window.IsKeyPressed(HexKey(context.cpu.v[x])) {
-        context.cpu.pc += 2
+        skip(context)
     }
     context.cpu.pc += 2
+    return nil
 }
 
 // ExA1 - SKNP Vx
 // Skip next instruction if key with the value of Vx is not pressed
-func sknp(context *Context) {
+func sknp(context *Context) error {
     x := context.opcode & 0x0F00 >> 8
     if !context.window.IsKeyPressed(HexKey(context.cpu.v[x])) {
-        context.cpu.pc += 2
+        skip(context)
     }
     context.cpu.pc += 2
+    return nil
 }
 
-func opsf(context *Context) {
+func opsf(context *Context) error {
+    var err error
     switch context.opcode & 0x00FF {
+    case 0x00:
+        if context.opcode != 0xF000 || !context.xochip {
+            return illegal(context)
+        }
+        err = ldil(context)
+    case 0x01:
+        if !context.xochip {
+            return illegal(context)
+        }
+        err = plane(context)
+    case 0x02:
+        if context.opcode != 0xF002 || !context.xochip {
+            return illegal(context)
+        }
+        err = ldaudio(context)
     case 0x07:
-        stdt(context)
+        err = stdt(context)
     case 0x0A:
-        ldk(context)
+        err = ldk(context)
     case 0x15:
-        mvdt(context)
+        err = mvdt(context)
     case 0x18:
-        mvst(context)
+        err = mvst(context)
     case 0x1E:
-        addi(context)
+        err = addi(context)
     case 0x29:
-        ldf(context)
+        err = ldf(context)
+    case 0x30:
+        err = ldhf(context)
     case 0x33:
-        stbcd(context)
+        err = stbcd(context)
+    case 0x3A:
+        if !context.xochip {
+            return illegal(context)
+        }
+        err = ldpitch(context)
     case 0x55:
-        st(context)
+        err = st(context)
     case 0x65:
-        ld(context)
+        err = ld(context)
+    case 0x75:
+        err = str(context)
+    case 0x85:
+        err = ldr(context)
     default:
-        panic(fmt.Sprintf("Unrecognized opcode %v!", context.opcode))
+        return illegal(context)
+    }
+    if err != nil {
+        return err
+    }
+    context.cpu.pc += 2
+    return nil
+}
+
+// F000 nnnn - LD I, long
+// Set I = nnnn, the 16-bit word following the instruction
+func ldil(context *Context) error {
+    if err := checkMemory(context, context.cpu.pc + 2, 2); err != nil {
+        return err
     }
+    pc := context.cpu.pc
+    context.cpu.i = uint16(context.fetch(int(pc) + 2)) << 8 | uint16(context.fetch(int(pc) + 3))
     context.cpu.pc += 2
+    return nil
+}
+
+// Fn01 - PLANE n
+// Select the bit planes DRW, CLS and the scroll instructions operate on
+func plane(context *Context) error {
+    n := byte(context.opcode & 0x0F00 >> 8)
+    if n > allPlanes {
+        return illegal(context)
+    }
+    context.planes = n
+    return nil
+}
+
+// F002 - AUDIO
+// Load the 16-byte audio pattern starting at memory location I
+func ldaudio(context *Context) error {
+    if err := checkMemory(context, context.cpu.i, len(context.audio)); err != nil {
+        return err
+    }
+    for k := range context.audio {
+        context.audio[k] = context.read(int(context.cpu.i) + k)
+    }
+    context.hasAudio = true
+    return nil
 }
 
 // Fx07 - ST Vx, DT
 // Set Vx = delay timer value
-func stdt(context *Context) {
+func stdt(context *Context) error {
     x := context.opcode & 0x0F00 >> 8
     context.cpu.v[x] = context.cpu.dt
+    return nil
 }
 
 // Fx15 - MV DT, Vx
 // Set delay timer = Vx.
-func mvdt(context *Context) {
+func mvdt(context *Context) error {
     x := context.opcode & 0x0F00 >> 8
     context.cpu.dt = context.cpu.v[x]
+    return nil
 }
 
 // Fx0A - LD Vx, K
 // Wait for a key press, store the value of the key in Vx
-func ldk(context *Context) {
+func ldk(context *Context) error {
     x := context.opcode & 0x0F00 >> 8
     before := time.Now()
     key := context.window.WaitForKeyPress()
     // Don't count blocking time against delay
-    context.cpu.delay -= time.Since(before).Nanoseconds() / 1000000
+    context.cpu.delay -= time.Since(before).Nanoseconds() / 1000000 * ticksPerSecond
     context.cpu.v[x] = byte(key)
+    return nil
 }
 
 // Fx18 - MV ST, Vx
 // Set sound timer = Vx
-func mvst(context *Context) {
+func mvst(context *Context) error {
     x := context.opcode & 0x0F00 >> 8
     context.cpu.st = context.cpu.v[x]
+    return nil
 }
 
 // Fx1E - ADD I, Vx
 // Set I = I + Vx
-func addi(context *Context) {
+func addi(context *Context) error {
     x := context.opcode & 0x0F00 >> 8
     context.cpu.i += uint16(context.cpu.v[x])
+    return nil
 }
 
 // Fx29 - LD F, Vx
 // Set I = location of sprite for digit Vx
-func ldf(context *Context) {
+func ldf(context *Context) error {
     x := context.opcode & 0x0F00 >> 8
     context.cpu.i = 5 * uint16(context.cpu.v[x])
+    return nil
+}
+
+// Fx30 - LD HF, Vx
+// Set I = location of SUPER-CHIP 8x10 sprite for digit Vx
+func ldhf(context *Context) error {
+    x := context.opcode & 0x0F00 >> 8
+    context.cpu.i = bigFontAddr + 10 * uint16(context.cpu.v[x] & 0xF)
+    return nil
 }
 
 // Fx33 - ST B, Vx
 // Store BCD representation of Vx in memory locations I, I+1, and I+2
-func stbcd(context *Context) {
+func stbcd(context *Context) error {
     x := context.opcode & 0x0F00 >> 8
     num := context.cpu.v[x]
-    context.memory[context.cpu.i] = byte((num / 100) % 10)
-    context.memory[context.cpu.i + 1] = byte((num / 10) % 10)
-    context.memory[context.cpu.i + 2] = byte(num % 10)
+    if err := checkMemory(context, context.cpu.i, 3); err != nil {
+        return err
+    }
+    context.write(int(context.cpu.i), byte((num / 100) % 10))
+    context.write(int(context.cpu.i) + 1, byte((num / 10) % 10))
+    context.write(int(context.cpu.i) + 2, byte(num % 10))
+    return nil
+}
+
+// Fx3A - PITCH Vx
+// Set audio playback pitch = Vx
+func ldpitch(context *Context) error {
+    x := context.opcode & 0x0F00 >> 8
+    context.pitch = context.cpu.v[x]
+    return nil
 }
 
 // Fx55 - ST [I], Vx
 // Store registers V0 through Vx in memory starting at location I
-func st(context *Context) {
+// With the LoadStoreIncrementsI quirk, I is left at I + x + 1, and with
+// LoadStoreIncrementsIByX at I + x
+func st(context *Context) error {
     x := context.opcode & 0x0F00 >> 8
+    if err := checkMemory(context, context.cpu.i, int(x) + 1); err != nil {
+        return err
+    }
     for k := uint16(0); k <= x; k++ {
-        context.memory[context.cpu.i + k] = context.cpu.v[k]
+        context.write(int(context.cpu.i + k), context.cpu.v[k])
     }
+    if context.quirks.LoadStoreIncrementsI {
+        context.cpu.i += x + 1
+    } else if context.quirks.LoadStoreIncrementsIByX {
+        context.cpu.i += x
+    }
+    return nil
 }
 
 // Fx65 - LD Vx, [I]
 // Read registers V0 through Vx from memory starting at location I
-func ld(context *Context) {
+// With the LoadStoreIncrementsI quirk, I is left at I + x + 1, and with
+// LoadStoreIncrementsIByX at I + x
+func ld(context *Context) error {
     x := context.opcode & 0x0F00 >> 8
+    if err := checkMemory(context, context.cpu.i, int(x) + 1); err != nil {
+        return err
+    }
     for k := uint16(0); k <= x; k++ {
-        context.cpu.v[k] = context.memory[context.cpu.i + k]
+        context.cpu.v[k] = context.read(int(context.cpu.i + k))
+    }
+    if context.quirks.LoadStoreIncrementsI {
+        context.cpu.i += x + 1
+    } else if context.quirks.LoadStoreIncrementsIByX {
+        context.cpu.i += x
     }
+    return nil
+}
+
+// Fx75 - LD R, Vx
+// Store registers V0 through Vx in the RPL user flags
+func str(context *Context) error {
+    x := context.opcode & 0x0F00 >> 8
+    copy(context.flags[:x + 1], context.cpu.v[:x + 1])
+    return nil
+}
+
+// Fx85 - LD Vx, R
+// Read registers V0 through Vx from the RPL user flags
+func ldr(context *Context) error {
+    x := context.opcode & 0x0F00 >> 8
+    copy(context.cpu.v[:x + 1], context.flags[:x + 1])
+    return nil
 }
@@ -5,45 +5,13 @@ import (
     "testing"
 )
 
-type TestWindow struct {
-    screen [64][32]byte
-}
-
-func (w *TestWindow) Update() {
-    // Noop
-}
-
-func (w *TestWindow) IsKeyPressed(key HexKey) bool {
-    return false
-}
-
-func (w *TestWindow) WaitForKeyPress() HexKey {
-    return 0xA
-}
-
-func (w *TestWindow) Draw(screen *[64][32]byte) {
-    w.screen = *screen
-}
-
-func (w *TestWindow) Clear() {
-    // Noop
-}
-
-func (w *TestWindow) ShouldClose() bool {
-    return false
-}
-
-func (w *TestWindow) Release() {
-    // Noop
-}
-
 func TestRet(t *testing.T) {
     assert := assert.New(t)
-    context := newContext(newCPU(), new(TestWindow), [4096]byte{})
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
 
     context.opcode = 0x00EE
     context.cpu.sp = 1
-    context.stack[context.cpu.sp] = 0x321
+    context.stack[0] = 0x321
 
     runOpcode(context)
     assert.Equal(uint16(0x321), context.cpu.pc)
@@ -52,7 +20,7 @@ func TestRet(t *testing.T) {
 
 func TestJp(t *testing.T) {
     assert := assert.New(t)
-    context := newContext(newCPU(), new(TestWindow), [4096]byte{})
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
 
     context.opcode = 0x1321
 
@@ -62,7 +30,7 @@ func TestJp(t *testing.T) {
 
 func TestCall(t *testing.T) {
     assert := assert.New(t)
-    context := newContext(newCPU(), new(TestWindow), [4096]byte{})
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
 
     context.opcode = 0x2321
     context.cpu.sp = 3
@@ -71,12 +39,25 @@ func TestCall(t *testing.T) {
     runOpcode(context)
     assert.Equal(uint16(0x321), context.cpu.pc)
     assert.Equal(byte(4), context.cpu.sp)
-    assert.Equal(pc, context.stack[context.cpu.sp])
+    assert.Equal(pc + 2, context.stack[3])
+}
+
+func TestCallRet(t *testing.T) {
+    assert := assert.New(t)
+
+    // CALL 0x206; ADD V0, 1; JP 0x204; RET
+    machine, _ := NewMachine([]byte{0x22, 0x06, 0x70, 0x01, 0x12, 0x04, 0x00, 0xEE})
+    assert.NoError(machine.Step())
+    assert.NoError(machine.Step())
+    assert.Equal(uint16(0x202), machine.PC())
+    assert.Equal(byte(0), machine.SP())
+    assert.NoError(machine.Step())
+    assert.Equal(byte(1), machine.V()[0])
 }
 
 func TestSebSkip(t *testing.T) {
     assert := assert.New(t)
-    context := newContext(newCPU(), new(TestWindow), [4096]byte{})
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
 
     context.opcode = 0x3111
     context.cpu.v[1] = 17
@@ -88,7 +69,7 @@ func TestSebSkip(t *testing.T) {
 
 func TestSebNoSkip(t *testing.T) {
     assert := assert.New(t)
-    context := newContext(newCPU(), new(TestWindow), [4096]byte{})
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
 
     context.opcode = 0x3111
     context.cpu.v[1] = 15
@@ -100,7 +81,7 @@ func TestSebNoSkip(t *testing.T) {
 
 func TestSnebSkip(t *testing.T) {
     assert := assert.New(t)
-    context := newContext(newCPU(), new(TestWindow), [4096]byte{})
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
 
     context.opcode = 0x4111
     context.cpu.v[1] = 15
@@ -112,7 +93,7 @@ func TestSnebSkip(t *testing.T) {
 
 func TestSnebNoSkip(t *testing.T) {
     assert := assert.New(t)
-    context := newContext(newCPU(), new(TestWindow), [4096]byte{})
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
 
     context.opcode = 0x4111
     context.cpu.v[1] = 17
@@ -125,7 +106,7 @@ func TestSnebNoSkip(t *testing.T) {
 
 func TestSeSkip(t *testing.T) {
     assert := assert.New(t)
-    context := newContext(newCPU(), new(TestWindow), [4096]byte{})
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
 
     context.opcode = 0x5120
     context.cpu.v[1] = 17
@@ -138,7 +119,7 @@ func TestSeSkip(t *testing.T) {
 
 func TestSeNoSkip(t *testing.T) {
     assert := assert.New(t)
-    context := newContext(newCPU(), new(TestWindow), [4096]byte{})
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
 
     context.opcode = 0x5120
     context.cpu.v[1] = 15
@@ -151,7 +132,7 @@ func TestSeNoSkip(t *testing.T) {
 
 func TestMv(t *testing.T) {
     assert := assert.New(t)
-    context := newContext(newCPU(), new(TestWindow), [4096]byte{})
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
 
     context.cpu.v[2] = 0x01
     context.opcode = 0x8120
@@ -164,7 +145,7 @@ func TestMv(t *testing.T) {
 
 func TestOr(t *testing.T) {
     assert := assert.New(t)
-    context := newContext(newCPU(), new(TestWindow), [4096]byte{})
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
 
     context.cpu.v[1] = 0x01
     context.cpu.v[2] = 0x10
@@ -178,7 +159,7 @@ func TestOr(t *testing.T) {
 
 func TestAnd(t *testing.T) {
     assert := assert.New(t)
-    context := newContext(newCPU(), new(TestWindow), [4096]byte{})
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
 
     context.cpu.v[1] = 0x11
     context.cpu.v[2] = 0x10
@@ -192,7 +173,7 @@ func TestAnd(t *testing.T) {
 
 func TestXor(t *testing.T) {
     assert := assert.New(t)
-    context := newContext(newCPU(), new(TestWindow), [4096]byte{})
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
 
     context.cpu.v[1] = 0x11
     context.cpu.v[2] = 0x10
@@ -206,7 +187,7 @@ func TestXor(t *testing.T) {
 
 func TestAddNoCarry(t *testing.T) {
     assert := assert.New(t)
-    context := newContext(newCPU(), new(TestWindow), [4096]byte{})
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
 
     context.cpu.v[1] = 0x03
     context.cpu.v[2] = 0x02
@@ -222,7 +203,7 @@ func TestAddNoCarry(t *testing.T) {
 
 func TestAddCarry(t *testing.T) {
     assert := assert.New(t)
-    context := newContext(newCPU(), new(TestWindow), [4096]byte{})
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
 
     context.cpu.v[1] = 0xFF
     context.cpu.v[2] = 0x05
@@ -238,7 +219,7 @@ func TestAddCarry(t *testing.T) {
 
 func TestSubBorrow(t *testing.T) {
     assert := assert.New(t)
-    context := newContext(newCPU(), new(TestWindow), [4096]byte{})
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
 
     context.cpu.v[1] = 0x03
     context.cpu.v[2] = 0x05
@@ -254,7 +235,7 @@ func TestSubBorrow(t *testing.T) {
 
 func TestSubNoBorrow(t *testing.T) {
     assert := assert.New(t)
-    context := newContext(newCPU(), new(TestWindow), [4096]byte{})
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
 
     context.cpu.v[1] = 0x05
     context.cpu.v[2] = 0x03
@@ -268,9 +249,80 @@ func TestSubNoBorrow(t *testing.T) {
     assert.Equal(pc + 2, context.cpu.pc)
 }
 
+func TestSubEqual(t *testing.T) {
+    assert := assert.New(t)
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
+
+    context.cpu.v[1] = 0x05
+    context.cpu.v[2] = 0x05
+    context.opcode = 0x8125
+
+    runOpcode(context)
+    assert.Equal(0, int(context.cpu.v[1]))
+    assert.Equal(1, int(context.cpu.v[0xF])) // Equal values don't borrow
+}
+
+func TestSubn(t *testing.T) {
+    assert := assert.New(t)
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
+
+    context.cpu.v[1] = 0x03
+    context.cpu.v[2] = 0x05
+    context.opcode = 0x8127
+    pc := context.cpu.pc
+
+    runOpcode(context)
+    assert.Equal(2, int(context.cpu.v[1]))
+    assert.Equal(1, int(context.cpu.v[0xF])) // No borrow
+    assert.Equal(pc + 2, context.cpu.pc)
+
+    context.cpu.v[1] = 0x05
+    context.cpu.v[2] = 0x03
+    runOpcode(context)
+    assert.Equal(254, int(context.cpu.v[1]))
+    assert.Equal(0, int(context.cpu.v[0xF])) // Borrow
+
+    context.cpu.v[1] = 0x05
+    context.cpu.v[2] = 0x05
+    runOpcode(context)
+    assert.Equal(0, int(context.cpu.v[1]))
+    assert.Equal(1, int(context.cpu.v[0xF]))
+}
+
+// With VF as the destination, the flag replaces the result
+func TestFlagOverwritesVF(t *testing.T) {
+    assert := assert.New(t)
+
+    tests := []struct {
+        opcode uint16
+        vf, vy byte
+        flag   byte
+    }{
+        {0x8F14, 0xFF, 0x02, 1}, // ADD carries
+        {0x8F14, 0x01, 0x02, 0},
+        {0x8F15, 0x05, 0x03, 1}, // SUB doesn't borrow
+        {0x8F15, 0x03, 0x05, 0},
+        {0x8F16, 0x03, 0x00, 1}, // SHR shifts out a 1
+        {0x8F16, 0x02, 0x00, 0},
+        {0x8F17, 0x03, 0x05, 1}, // SUBN doesn't borrow
+        {0x8F17, 0x05, 0x03, 0},
+        {0x8F1E, 0x81, 0x00, 1}, // SHL shifts out a 1
+        {0x8F1E, 0x41, 0x00, 0},
+    }
+    for _, test := range tests {
+        context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
+        context.cpu.v[0xF] = test.vf
+        context.cpu.v[1] = test.vy
+        context.opcode = test.opcode
+
+        assert.NoError(runOpcode(context))
+        assert.Equal(test.flag, context.cpu.v[0xF], "%04X with VF = %02X", test.opcode, test.vf)
+    }
+}
+
 func TestShrLSB1(t *testing.T) {
     assert := assert.New(t)
-    context := newContext(newCPU(), new(TestWindow), [4096]byte{})
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
 
     context.cpu.v[1] = 0x05
     context.cpu.v[0xF] = 0
@@ -285,7 +337,7 @@ func TestShrLSB1(t *testing.T) {
 
 func TestShrLSB0(t *testing.T) {
     assert := assert.New(t)
-    context := newContext(newCPU(), new(TestWindow), [4096]byte{})
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
 
     context.cpu.v[1] = 0x06
     context.cpu.v[0xF] = 1
@@ -300,7 +352,7 @@ func TestShrLSB0(t *testing.T) {
 
 func TestStBCD(t *testing.T) {
     assert := assert.New(t)
-    context := newContext(newCPU(), new(TestWindow), [4096]byte{})
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
 
     context.cpu.i = 100
     context.cpu.v[1] = 123
@@ -316,7 +368,7 @@ func TestStBCD(t *testing.T) {
 
 func TestSt(t *testing.T) {
     assert := assert.New(t)
-    context := newContext(newCPU(), new(TestWindow), [4096]byte{})
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
 
     context.cpu.i = 100
     context.cpu.v[0] = 1
@@ -334,7 +386,7 @@ func TestSt(t *testing.T) {
 
 func TestLd(t *testing.T) {
     assert := assert.New(t)
-    context := newContext(newCPU(), new(TestWindow), [4096]byte{})
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
 
     context.cpu.i = 100
     context.memory[100] = 1
@@ -353,15 +405,15 @@ func TestLd(t *testing.T) {
 func TestDrwCollision(t *testing.T) {
     assert := assert.New(t)
 
-    window := new(TestWindow)
-    context := newContext(newCPU(), window, [4096]byte{})
+    window := new(HeadlessWindow)
+    context := newContext(newCPU(), window, [65536]byte{})
 
     // Stub screen with values
     x, y := 16, 16
     for j := 0; j < 3; j++ {
         for i := 0; i < 8; i++ {
             // Alternating 1s and 0s in the draw bytes
-            context.screen[x + i][y + j] = byte(i % 2)
+            context.screen.Pixels[x + i][y + j] = byte(i % 2)
         }
     }
 
@@ -388,7 +440,7 @@ func TestDrwCollision(t *testing.T) {
     for j := 0; j < 3; j++ {
         actual := [8]byte{}
         for i := 0; i < 8; i++ {
-            actual[i] = context.screen[x + i][y + j]
+            actual[i] = context.screen.Pixels[x + i][y + j]
         }
         assert.Equal(expected[j], actual[:])
     }
@@ -400,26 +452,26 @@ func TestDrwCollision(t *testing.T) {
 func TestCls(t *testing.T) {
     assert := assert.New(t)
 
-    window := new(TestWindow)
-    context := newContext(newCPU(), window, [4096]byte{})
-    for i := range context.screen {
-        for j := range context.screen[i] {
-            context.screen[i][j] = 1
+    window := new(HeadlessWindow)
+    context := newContext(newCPU(), window, [65536]byte{})
+    for i := range context.screen.Pixels {
+        for j := range context.screen.Pixels[i] {
+            context.screen.Pixels[i][j] = 1
         }
     }
     context.opcode = 0x00E0
     pc := context.cpu.pc
 
     runOpcode(context)
-    assert.Equal([64][32]byte{}, context.screen)
+    assert.Equal([128][64]byte{}, context.screen.Pixels)
     assert.Equal(pc + 2, context.cpu.pc)
 }
 
 func TestLdk(t *testing.T) {
     assert := assert.New(t)
 
-    window := new(TestWindow)
-    context := newContext(newCPU(), window, [4096]byte{})
+    window := NewHeadlessWindow([]KeyEvent{{Frame: 3, Key: 0xA, Pressed: true}}, 0)
+    context := newContext(newCPU(), window, [65536]byte{})
 
     context.opcode = 0xF50A
     pc := context.cpu.pc
@@ -432,8 +484,8 @@ func TestLdk(t *testing.T) {
 func TestLdf(t *testing.T) {
     assert := assert.New(t)
 
-    window := new(TestWindow)
-    context := newContext(newCPU(), window, [4096]byte{})
+    window := new(HeadlessWindow)
+    context := newContext(newCPU(), window, [65536]byte{})
 
     context.cpu.v[5] = 0xA
     context.opcode = 0xF529
@@ -443,3 +495,449 @@ func TestLdf(t *testing.T) {
     assert.Equal(uint16(50), context.cpu.i)
     assert.Equal(pc + 2, context.cpu.pc)
 }
+
+func TestIllegalOpcode(t *testing.T) {
+    assert := assert.New(t)
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
+
+    context.opcode = 0x8128
+    pc := context.cpu.pc
+
+    err := runOpcode(context)
+    assert.Equal(&IllegalInstructionError{PC: pc, Opcode: 0x8128}, err)
+    assert.Equal(pc, context.cpu.pc)
+}
+
+func TestCallOverflow(t *testing.T) {
+    assert := assert.New(t)
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
+
+    // All 16 levels can be used
+    context.opcode = 0x2321
+    for k := 0; k < 16; k++ {
+        assert.NoError(runOpcode(context))
+    }
+    assert.Equal(byte(16), context.cpu.sp)
+    pc := context.cpu.pc
+
+    err := runOpcode(context)
+    assert.Equal(&StackError{PC: pc, Overflow: true, SP: 16, Stack: context.stack}, err)
+    assert.Equal(byte(16), context.cpu.sp)
+}
+
+func TestRetUnderflow(t *testing.T) {
+    assert := assert.New(t)
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
+
+    context.opcode = 0x00EE
+    pc := context.cpu.pc
+
+    err := runOpcode(context)
+    assert.Equal(&StackError{PC: pc, Overflow: false}, err)
+    assert.EqualError(err, "stack underflow at 200, stack []")
+    assert.Equal(byte(0), context.cpu.sp)
+}
+
+func TestStOutOfBounds(t *testing.T) {
+    assert := assert.New(t)
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
+
+    context.cpu.i = 0xFFE
+    context.opcode = 0xF255
+    pc := context.cpu.pc
+
+    err := runOpcode(context)
+    assert.Equal(&MemoryError{PC: pc, Address: 0x1000}, err)
+    assert.Equal(pc, context.cpu.pc)
+}
+
+func TestStOutOfBoundsXOChip(t *testing.T) {
+    assert := assert.New(t)
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
+    context.xochip = true
+
+    context.cpu.i = 0xFFFE
+    context.opcode = 0xF255
+    pc := context.cpu.pc
+
+    err := runOpcode(context)
+    assert.Equal(&MemoryError{PC: pc, Address: 0x10000}, err)
+    assert.Equal(pc, context.cpu.pc)
+}
+
+func TestShlMSB1(t *testing.T) {
+    assert := assert.New(t)
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
+
+    context.cpu.v[1] = 0x81
+    context.cpu.v[0xF] = 0
+    context.opcode = 0x810E
+
+    runOpcode(context)
+    assert.Equal(0x02, int(context.cpu.v[1]))
+    assert.Equal(1, int(context.cpu.v[0xF]))
+}
+
+func TestShrShiftUsesVy(t *testing.T) {
+    assert := assert.New(t)
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
+
+    context.quirks.ShiftUsesVy = true
+    context.cpu.v[1] = 0x10
+    context.cpu.v[2] = 0x05
+    context.opcode = 0x8126
+
+    runOpcode(context)
+    assert.Equal(2, int(context.cpu.v[1]))
+    assert.Equal(1, int(context.cpu.v[0xF]))
+}
+
+func TestOrLogicResetsVF(t *testing.T) {
+    assert := assert.New(t)
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
+
+    context.quirks.LogicResetsVF = true
+    context.cpu.v[1] = 0x01
+    context.cpu.v[2] = 0x10
+    context.cpu.v[0xF] = 1
+    context.opcode = 0x8121
+
+    runOpcode(context)
+    assert.Equal(0x11, int(context.cpu.v[1]))
+    assert.Equal(0, int(context.cpu.v[0xF]))
+}
+
+func TestJpnJumpUsesVx(t *testing.T) {
+    assert := assert.New(t)
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
+
+    context.quirks.JumpUsesVx = true
+    context.cpu.v[0] = 0x10
+    context.cpu.v[3] = 0x02
+    context.opcode = 0xB321
+
+    runOpcode(context)
+    assert.Equal(uint16(0x323), context.cpu.pc)
+}
+
+func TestStLoadStoreIncrementsI(t *testing.T) {
+    assert := assert.New(t)
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
+
+    context.quirks.LoadStoreIncrementsI = true
+    context.cpu.i = 100
+    context.opcode = 0xF255
+
+    runOpcode(context)
+    assert.Equal(uint16(103), context.cpu.i)
+}
+
+func TestLdLoadStoreIncrementsIByX(t *testing.T) {
+    assert := assert.New(t)
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
+
+    context.quirks = CHIP48Quirks
+    context.cpu.i = 100
+    context.opcode = 0xF265
+
+    runOpcode(context)
+    assert.Equal(uint16(102), context.cpu.i)
+}
+
+func TestDrwClipSprites(t *testing.T) {
+    assert := assert.New(t)
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
+
+    context.quirks.ClipSprites = true
+    context.cpu.i = 100
+    context.cpu.v[1] = 60
+    context.cpu.v[2] = 31
+    context.memory[100] = 0xFF
+    context.memory[101] = 0xFF
+    context.opcode = 0xD122
+
+    runOpcode(context)
+    for i := 60; i < 64; i++ {
+        assert.Equal(byte(1), context.screen.Pixels[i][31])
+    }
+    // Nothing wraps around to the left or top edges
+    for i := 0; i < 4; i++ {
+        assert.Equal(byte(0), context.screen.Pixels[i][31])
+        assert.Equal(byte(0), context.screen.Pixels[i][0])
+    }
+    assert.Equal(byte(0), context.screen.Pixels[60][0])
+}
+
+func TestHighLow(t *testing.T) {
+    assert := assert.New(t)
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
+
+    context.screen.Pixels[1][1] = 1
+    context.opcode = 0x00FF
+    runOpcode(context)
+    assert.Equal(128, context.screen.Width)
+    assert.Equal(64, context.screen.Height)
+    assert.Equal(byte(0), context.screen.Pixels[1][1])
+
+    context.opcode = 0x00FE
+    runOpcode(context)
+    assert.Equal(64, context.screen.Width)
+    assert.Equal(32, context.screen.Height)
+    assert.Equal(uint16(0x204), context.cpu.pc)
+}
+
+func TestScd(t *testing.T) {
+    assert := assert.New(t)
+    window := new(HeadlessWindow)
+    context := newContext(newCPU(), window, [65536]byte{})
+
+    context.screen.Pixels[3][0] = 1
+    context.screen.Pixels[3][30] = 1
+    context.opcode = 0x00C2
+    pc := context.cpu.pc
+
+    runOpcode(context)
+    assert.Equal(byte(0), context.screen.Pixels[3][0])
+    assert.Equal(byte(1), context.screen.Pixels[3][2])
+    // Pixels scrolled past the bottom edge are lost
+    assert.Equal(byte(0), context.screen.Pixels[3][31])
+    assert.Equal(context.screen, window.Screen())
+    assert.Equal(pc + 2, context.cpu.pc)
+}
+
+func TestScrScl(t *testing.T) {
+    assert := assert.New(t)
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
+
+    context.screen.Pixels[0][5] = 1
+    context.opcode = 0x00FB
+    runOpcode(context)
+    assert.Equal(byte(0), context.screen.Pixels[0][5])
+    assert.Equal(byte(1), context.screen.Pixels[4][5])
+
+    context.opcode = 0x00FC
+    runOpcode(context)
+    assert.Equal(byte(1), context.screen.Pixels[0][5])
+    assert.Equal(byte(0), context.screen.Pixels[4][5])
+}
+
+func TestExit(t *testing.T) {
+    assert := assert.New(t)
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
+
+    context.opcode = 0x00FD
+    pc := context.cpu.pc
+
+    assert.Equal(ErrExit, runOpcode(context))
+    assert.Equal(pc, context.cpu.pc)
+}
+
+func TestDrwLarge(t *testing.T) {
+    assert := assert.New(t)
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
+
+    context.screen.setHires(true)
+    context.cpu.i = 100
+    context.cpu.v[1] = 120
+    context.cpu.v[2] = 10
+    for k := 0; k < 32; k++ {
+        context.memory[100 + k] = 0x80
+    }
+    context.opcode = 0xD120
+
+    runOpcode(context)
+    for j := 10; j < 26; j++ {
+        // First column of each byte is set, sprite right half wraps to x = 0
+        assert.Equal(byte(1), context.screen.Pixels[120][j])
+        assert.Equal(byte(1), context.screen.Pixels[0][j])
+        assert.Equal(byte(0), context.screen.Pixels[121][j])
+    }
+    assert.Equal(byte(0), context.screen.Pixels[120][26])
+}
+
+func TestLdhf(t *testing.T) {
+    assert := assert.New(t)
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
+
+    context.cpu.v[5] = 0x3
+    context.opcode = 0xF530
+    pc := context.cpu.pc
+
+    runOpcode(context)
+    assert.Equal(uint16(bigFontAddr + 30), context.cpu.i)
+    assert.Equal(pc + 2, context.cpu.pc)
+}
+
+func TestStrLdr(t *testing.T) {
+    assert := assert.New(t)
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
+
+    context.cpu.v[0] = 1
+    context.cpu.v[1] = 2
+    context.cpu.v[2] = 3
+    context.opcode = 0xF175
+    runOpcode(context)
+    assert.Equal(byte(1), context.flags[0])
+    assert.Equal(byte(2), context.flags[1])
+    assert.Equal(byte(0), context.flags[2])
+
+    context.cpu.v = [16]byte{}
+    context.opcode = 0xF285
+    runOpcode(context)
+    assert.Equal(byte(1), context.cpu.v[0])
+    assert.Equal(byte(2), context.cpu.v[1])
+    assert.Equal(byte(0), context.cpu.v[2])
+    assert.Equal(uint16(0x204), context.cpu.pc)
+}
+
+func TestSebSkipLongLoad(t *testing.T) {
+    assert := assert.New(t)
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
+    context.xochip = true
+
+    context.memory[0x202] = 0xF0
+    context.memory[0x203] = 0x00
+    context.opcode = 0x3111
+    context.cpu.v[1] = 17
+    pc := context.cpu.pc
+
+    runOpcode(context)
+    assert.Equal(pc + 6, context.cpu.pc)
+}
+
+func TestSeIllegal(t *testing.T) {
+    assert := assert.New(t)
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
+
+    context.opcode = 0x5121
+
+    assert.Equal(&IllegalInstructionError{PC: 0x200, Opcode: 0x5121}, runOpcode(context))
+}
+
+func TestXOChipOpcodesIllegal(t *testing.T) {
+    assert := assert.New(t)
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
+
+    // Only decoded in XO-CHIP mode
+    for _, opcode := range []uint16{0x00D2, 0x5242, 0x5A83, 0xF000, 0xF301, 0xF002, 0xF43A} {
+        context.opcode = opcode
+        assert.Equal(&IllegalInstructionError{PC: 0x200, Opcode: opcode}, runOpcode(context))
+    }
+
+    // Nor is F000 skipped as a long load
+    context.memory[0x202] = 0xF0
+    context.memory[0x203] = 0x00
+    context.opcode = 0x3111
+    context.cpu.v[1] = 17
+    runOpcode(context)
+    assert.Equal(uint16(0x204), context.cpu.pc)
+}
+
+func TestStRangeLdRange(t *testing.T) {
+    assert := assert.New(t)
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
+    context.xochip = true
+
+    context.cpu.i = 100
+    context.cpu.v[2] = 1
+    context.cpu.v[3] = 2
+    context.cpu.v[4] = 3
+    context.opcode = 0x5242
+    runOpcode(context)
+    assert.Equal([]byte{1, 2, 3}, context.memory[100:103])
+    assert.Equal(uint16(100), context.cpu.i)
+
+    // Descending range loads in reverse
+    context.opcode = 0x5A83
+    runOpcode(context)
+    assert.Equal(byte(1), context.cpu.v[0xA])
+    assert.Equal(byte(2), context.cpu.v[0x9])
+    assert.Equal(byte(3), context.cpu.v[0x8])
+    assert.Equal(uint16(0x204), context.cpu.pc)
+}
+
+func TestScu(t *testing.T) {
+    assert := assert.New(t)
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
+    context.xochip = true
+
+    context.screen.Pixels[3][5] = 1
+    context.opcode = 0x00D2
+
+    runOpcode(context)
+    assert.Equal(byte(0), context.screen.Pixels[3][5])
+    assert.Equal(byte(1), context.screen.Pixels[3][3])
+}
+
+func TestLdil(t *testing.T) {
+    assert := assert.New(t)
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
+    context.xochip = true
+
+    context.memory[0x202] = 0xAB
+    context.memory[0x203] = 0xCD
+    context.opcode = 0xF000
+    pc := context.cpu.pc
+
+    runOpcode(context)
+    assert.Equal(uint16(0xABCD), context.cpu.i)
+    assert.Equal(pc + 4, context.cpu.pc)
+}
+
+func TestPlaneDrw(t *testing.T) {
+    assert := assert.New(t)
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
+    context.xochip = true
+
+    // Select both planes, first plane row is 0x80, second is 0xC0
+    context.opcode = 0xF301
+    runOpcode(context)
+    assert.Equal(byte(3), context.planes)
+
+    context.cpu.i = 100
+    context.memory[100] = 0x80
+    context.memory[101] = 0xC0
+    context.opcode = 0xD001
+    runOpcode(context)
+    assert.Equal(byte(3), context.screen.Pixels[0][0])
+    assert.Equal(byte(2), context.screen.Pixels[1][0])
+    assert.Equal(byte(0), context.cpu.v[0xF])
+
+    // Clearing only the first plane leaves the second
+    context.opcode = 0xF101
+    runOpcode(context)
+    context.opcode = 0x00E0
+    runOpcode(context)
+    assert.Equal(byte(2), context.screen.Pixels[0][0])
+    assert.Equal(byte(2), context.screen.Pixels[1][0])
+}
+
+func TestPlaneIllegal(t *testing.T) {
+    assert := assert.New(t)
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
+    context.xochip = true
+
+    context.opcode = 0xF401
+
+    assert.Equal(&IllegalInstructionError{PC: 0x200, Opcode: 0xF401}, runOpcode(context))
+}
+
+func TestAudioPitch(t *testing.T) {
+    assert := assert.New(t)
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
+    context.xochip = true
+
+    context.cpu.i = 100
+    for k := 0; k < 16; k++ {
+        context.memory[100 + k] = byte(k)
+    }
+    context.opcode = 0xF002
+    runOpcode(context)
+    assert.Equal(byte(15), context.audio[15])
+
+    context.cpu.v[4] = 112
+    context.opcode = 0xF43A
+    runOpcode(context)
+    assert.Equal(byte(112), context.pitch)
+    assert.Equal(uint16(0x204), context.cpu.pc)
+}
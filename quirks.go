@@ -0,0 +1,42 @@
+package chip8
+
+// Quirks select between the historical interpretations of ambiguous instructions.
+// The zero value keeps this interpreter's original behavior.
+type Quirks struct {
+    ShiftUsesVy             bool // 8xy6/8xyE shift Vy into Vx instead of shifting Vx in place
+    LoadStoreIncrementsI    bool // Fx55/Fx65 leave I pointing past the last register
+    LoadStoreIncrementsIByX bool // Fx55/Fx65 leave I pointing at the last register
+    JumpUsesVx              bool // Bxnn jumps to xnn + Vx instead of nnn + V0
+    LogicResetsVF           bool // 8xy1/8xy2/8xy3 clear VF
+    ClipSprites             bool // DRW clips sprites at the screen edges instead of wrapping them
+    DisplayWait             bool // DRW waits for the next frame before execution continues
+}
+
+// Original COSMAC VIP interpreter
+var VIPQuirks = Quirks{
+    ShiftUsesVy: true,
+    LoadStoreIncrementsI: true,
+    LogicResetsVF: true,
+    ClipSprites: true,
+    DisplayWait: true,
+}
+
+// CHIP-48 on the HP-48 calculators
+var CHIP48Quirks = Quirks{
+    LoadStoreIncrementsIByX: true,
+    JumpUsesVx: true,
+    ClipSprites: true,
+}
+
+// SUPER-CHIP 1.1
+var SuperChipQuirks = Quirks{
+    JumpUsesVx: true,
+    ClipSprites: true,
+}
+
+// Presets by the names accepted on the command line
+var QuirkPresets = map[string]Quirks {
+    "vip":    VIPQuirks,
+    "chip48": CHIP48Quirks,
+    "schip":  SuperChipQuirks,
+}
@@ -0,0 +1,137 @@
+package chip8
+
+import "encoding/binary"
+
+// Default rewind history: a minute of frames, within 16 MB
+const (
+    DefaultRewindFrames = 60 * 60
+    DefaultRewindBytes  = 16 << 20
+)
+
+// Rewinder keeps a bounded history of per-frame machine states so that emulation can run
+// backwards. Only the newest state is kept whole. Each older frame is stored as the
+// compressed XOR difference from the frame after it, which is mostly zeros because little
+// changes between frames.
+type Rewinder struct {
+    machine   *Machine
+    maxFrames int
+    maxBytes  int
+    latest    []byte   // State at the most recent Record
+    deltas    [][]byte // Ring of differences, deltas[(start + k) % len] is the k-th oldest
+    start     int
+    count     int
+    size      int // Bytes held by latest and deltas
+}
+
+// Keep up to maxFrames frames of history in about maxBytes of memory
+func NewRewinder(machine *Machine, maxFrames, maxBytes int) *Rewinder {
+    if maxFrames < 1 {
+        maxFrames = 1
+    }
+    return &Rewinder{machine: machine, maxFrames: maxFrames, maxBytes: maxBytes,
+                     deltas: make([][]byte, maxFrames)}
+}
+
+// Number of frames that can be rewound
+func (r *Rewinder) Frames() int {
+    return r.count
+}
+
+// Memory used by the history in bytes
+func (r *Rewinder) Size() int {
+    return r.size
+}
+
+// Forget the history
+func (r *Rewinder) Reset() {
+    for k := range r.deltas {
+        r.deltas[k] = nil
+    }
+    r.latest, r.start, r.count, r.size = nil, 0, 0, 0
+}
+
+// Add the machine's current state to the history. Call once per frame.
+func (r *Rewinder) Record() {
+    state := r.machine.SaveState()
+    if r.latest != nil {
+        delta := compressDelta(r.latest, state)
+        if r.count == len(r.deltas) {
+            r.dropOldest()
+        }
+        r.deltas[(r.start + r.count) % len(r.deltas)] = delta
+        r.count++
+        r.size += len(delta)
+        r.size -= len(r.latest)
+    }
+    r.latest = state
+    r.size += len(state)
+    for r.size > r.maxBytes && r.count > 0 {
+        r.dropOldest()
+    }
+}
+
+func (r *Rewinder) dropOldest() {
+    r.size -= len(r.deltas[r.start])
+    r.deltas[r.start] = nil
+    r.start = (r.start + 1) % len(r.deltas)
+    r.count--
+}
+
+// Restore the machine to the previous frame in the history. Returns false when there is
+// nothing left to rewind.
+func (r *Rewinder) Rewind() bool {
+    if r.count == 0 {
+        return false
+    }
+    newest := (r.start + r.count - 1) % len(r.deltas)
+    delta := r.deltas[newest]
+    r.deltas[newest] = nil
+    r.count--
+    r.size -= len(delta)
+
+    applyDelta(r.latest, delta)
+    // States in the history were written by this machine, so they always load
+    r.machine.LoadState(r.latest)
+    return true
+}
+
+// Encode the XOR of two equal length states as alternating runs: a varint count of
+// unchanged bytes, a varint count of changed bytes, then the changed bytes XORed
+func compressDelta(a, b []byte) []byte {
+    var out []byte
+    var buf [binary.MaxVarintLen64]byte
+    for k := 0; k < len(a); {
+        same := k
+        for same < len(a) && a[same] == b[same] {
+            same++
+        }
+        changed := same
+        for changed < len(a) && a[changed] != b[changed] {
+            changed++
+        }
+        out = append(out, buf[:binary.PutUvarint(buf[:], uint64(same - k))]...)
+        out = append(out, buf[:binary.PutUvarint(buf[:], uint64(changed - same))]...)
+        for j := same; j < changed; j++ {
+            out = append(out, a[j] ^ b[j])
+        }
+        k = changed
+    }
+    return out
+}
+
+// XOR a delta from compressDelta into state, turning one of its two states into the other
+func applyDelta(state, delta []byte) {
+    k := 0
+    for len(delta) > 0 {
+        same, n := binary.Uvarint(delta)
+        delta = delta[n:]
+        changed, n := binary.Uvarint(delta)
+        delta = delta[n:]
+        k += int(same)
+        for j := 0; j < int(changed); j++ {
+            state[k + j] ^= delta[j]
+        }
+        k += int(changed)
+        delta = delta[changed:]
+    }
+}
@@ -0,0 +1,67 @@
+package chip8
+
+import (
+    "github.com/stretchr/testify/assert"
+    "testing"
+)
+
+func TestRewindRestoresEarlierFrames(t *testing.T) {
+    assert := assert.New(t)
+
+    machine, _ := NewMachine(stateROM)
+    rewinder := NewRewinder(machine, 100, DefaultRewindBytes)
+    var states [][]byte
+    for k := 0; k < 5; k++ {
+        machine.RunFrames(1)
+        rewinder.Record()
+        states = append(states, machine.SaveState())
+    }
+    assert.Equal(4, rewinder.Frames())
+    // Deltas between frames are far smaller than whole states
+    assert.True(rewinder.Size() < len(states[0]) + 4 * 1000)
+
+    for k := 3; k >= 0; k-- {
+        assert.True(rewinder.Rewind())
+        assert.Equal(states[k], machine.SaveState())
+    }
+    assert.False(rewinder.Rewind())
+
+    // Recording resumes from the rewound frame
+    machine.RunFrames(1)
+    rewinder.Record()
+    assert.True(rewinder.Rewind())
+    assert.Equal(states[0], machine.SaveState())
+}
+
+func TestRewindLimits(t *testing.T) {
+    assert := assert.New(t)
+
+    machine, _ := NewMachine(stateROM)
+    rewinder := NewRewinder(machine, 3, DefaultRewindBytes)
+    for k := 0; k < 10; k++ {
+        machine.RunFrames(1)
+        rewinder.Record()
+    }
+    assert.Equal(3, rewinder.Frames())
+
+    // A budget that only fits the newest state keeps no history
+    rewinder = NewRewinder(machine, 100, len(machine.SaveState()))
+    machine.RunFrames(1)
+    rewinder.Record()
+    machine.RunFrames(1)
+    rewinder.Record()
+    assert.Equal(0, rewinder.Frames())
+    assert.Equal(len(machine.SaveState()), rewinder.Size())
+}
+
+func TestDeltaRoundTrip(t *testing.T) {
+    assert := assert.New(t)
+
+    a := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+    b := []byte{1, 9, 9, 4, 5, 6, 7, 0}
+    delta := compressDelta(a, b)
+    applyDelta(a, delta)
+    assert.Equal(b, a)
+    applyDelta(a, delta)
+    assert.Equal([]byte{1, 2, 3, 4, 5, 6, 7, 8}, a)
+}
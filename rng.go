@@ -0,0 +1,85 @@
+package chip8
+
+import "fmt"
+
+// Algorithm used by RND
+type RandomAlgorithm byte
+
+const (
+    // SplitMix64, a fast generator with good statistical quality
+    RandomSplitMix RandomAlgorithm = iota
+    // The COSMAC VIP interpreter's routine. It increments a 16 bit seed, adds a byte looked
+    // up by the seed's low byte in the interpreter's code page at 0x0100, then mixes the
+    // sum with a shifted copy of itself.
+    RandomVIP
+)
+
+// Algorithms by the names accepted on the command line
+var RandomAlgorithms = map[string]RandomAlgorithm {
+    "splitmix": RandomSplitMix,
+    "vip":      RandomVIP,
+}
+
+func (a RandomAlgorithm) String() string {
+    for name, algorithm := range RandomAlgorithms {
+        if algorithm == a {
+            return name
+        }
+    }
+    return fmt.Sprintf("RandomAlgorithm(%d)", byte(a))
+}
+
+// The VIP interpreter's code at 0x0100-0x01FF, which its RND reads as a table of bytes.
+// Program memory doesn't hold it here, the fonts end below this page. Transcribed from a
+// listing of the interpreter rather than a ROM dump.
+var vipCodePage = [256]byte{
+    0x45, 0xA3, 0x98, 0x56, 0xD4, 0xF8, 0x81, 0xBC, 0xF8, 0x95, 0xAC, 0x22, 0xDC, 0x12, 0x56, 0xD4, // 0100
+    0x06, 0xB8, 0xD4, 0x06, 0xA8, 0xD4, 0x64, 0x0A, 0x01, 0xE6, 0x8A, 0xF4, 0xAA, 0x3B, 0x28, 0x9A, // 0110
+    0xFC, 0x01, 0xBA, 0xD4, 0xF8, 0x81, 0xBA, 0x06, 0xFA, 0x0F, 0xAA, 0x0A, 0xAA, 0xD4, 0xE6, 0x06, // 0120
+    0xBF, 0x93, 0xBE, 0xF8, 0x1B, 0xAE, 0x2A, 0x1A, 0xF8, 0x00, 0x5A, 0x0E, 0xF5, 0x3B, 0x4B, 0x56, // 0130
+    0x0A, 0xFC, 0x01, 0x5A, 0x30, 0x40, 0x4E, 0xF6, 0x3B, 0x3C, 0x9F, 0x56, 0x2A, 0x2A, 0xD4, 0x00, // 0140
+    0x22, 0x86, 0x52, 0xF8, 0xF0, 0xA7, 0x07, 0x5A, 0x87, 0xF3, 0x17, 0x1A, 0x3A, 0x5B, 0x12, 0xD4, // 0150
+    0x22, 0x86, 0x52, 0xF8, 0xF0, 0xA7, 0x0A, 0x57, 0x87, 0xF3, 0x17, 0x1A, 0x3A, 0x6B, 0x12, 0xD4, // 0160
+    0x15, 0x85, 0x22, 0x73, 0x95, 0x52, 0x25, 0x45, 0xA5, 0x86, 0xFA, 0x0F, 0xB5, 0xD4, 0x45, 0xE6, // 0170
+    0xF3, 0x3A, 0x82, 0x15, 0x15, 0xD4, 0x45, 0xE6, 0xF3, 0x3A, 0x88, 0xD4, 0x45, 0x07, 0x30, 0x8C, // 0180
+    0x45, 0x07, 0x30, 0x84, 0xE6, 0x62, 0x26, 0x45, 0xA3, 0x36, 0x88, 0xD4, 0x3E, 0x88, 0xD4, 0xF8, // 0190
+    0xF0, 0xA7, 0xE7, 0x45, 0xF4, 0xA5, 0x86, 0xFA, 0x0F, 0x3B, 0xB2, 0xFC, 0x01, 0xB5, 0xD4, 0x45, // 01A0
+    0x56, 0xD4, 0x45, 0xE6, 0xF4, 0x56, 0xD4, 0x45, 0xFA, 0x0F, 0x3A, 0xC4, 0x07, 0x56, 0xD4, 0xAF, // 01B0
+    0x22, 0xF8, 0xD3, 0x73, 0x8F, 0xF9, 0xF0, 0x52, 0xE6, 0x07, 0xD2, 0x56, 0xF8, 0xFF, 0xA6, 0xF8, // 01C0
+    0x00, 0x7E, 0x56, 0xD4, 0x19, 0x89, 0xAE, 0x93, 0xBE, 0x99, 0xEE, 0xF4, 0x56, 0x76, 0xE6, 0xF4, // 01D0
+    0xB9, 0x56, 0x45, 0xF2, 0x56, 0xD4, 0x45, 0xAA, 0x86, 0xFA, 0x0F, 0xBA, 0xD4, 0x00, 0x00, 0x00, // 01E0
+    0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xE0, 0x00, 0x4B, // 01F0
+}
+
+// Pseudo-random source for RND. Its whole state is one word so that save states and
+// movies can capture it and replay the same sequence.
+type rng struct {
+    algorithm RandomAlgorithm
+    seed      uint64 // Seed given to SetRandom, kept for movies
+    state     uint64
+}
+
+func (r *rng) reset(algorithm RandomAlgorithm, seed uint64) {
+    r.algorithm, r.seed, r.state = algorithm, seed, seed
+}
+
+// Next random byte
+func (r *rng) byte() byte {
+    if r.algorithm == RandomVIP {
+        // R9 in the VIP interpreter, incremented on every call
+        seed := uint16(r.state) + 1
+        sum := uint16(seed >> 8) + uint16(vipCodePage[seed & 0xFF])
+        // Shift right through the carry, then add the sum back in
+        mixed := byte(sum >> 8 << 7) | byte(sum) >> 1
+        result := mixed + byte(sum)
+        r.state = uint64(uint16(result) << 8 | seed & 0xFF)
+        return result
+    }
+
+    // Top byte of a SplitMix64 output
+    r.state += 0x9E3779B97F4A7C15
+    z := r.state
+    z = (z ^ z >> 30) * 0xBF58476D1CE4E5B9
+    z = (z ^ z >> 27) * 0x94D049BB133111EB
+    return byte((z ^ z >> 31) >> 56)
+}
@@ -0,0 +1,93 @@
+package chip8
+
+import (
+    "github.com/stretchr/testify/assert"
+    "testing"
+)
+
+func randomBytes(machine *Machine, n int) []byte {
+    var out []byte
+    for k := 0; k < n; k++ {
+        machine.RunFrames(1)
+        out = append(out, machine.V()[0])
+    }
+    return out
+}
+
+func TestSeededRandomRepeats(t *testing.T) {
+    assert := assert.New(t)
+
+    for _, algorithm := range []RandomAlgorithm{RandomSplitMix, RandomVIP} {
+        first, _ := NewMachine(stateROM)
+        first.SetRandom(algorithm, 1234)
+        second, _ := NewMachine(stateROM)
+        second.SetRandom(algorithm, 1234)
+        assert.Equal(randomBytes(first, 20), randomBytes(second, 20), algorithm.String())
+
+        chosen, seed := second.Random()
+        assert.Equal(algorithm, chosen)
+        assert.Equal(uint64(1234), seed)
+    }
+
+    first, _ := NewMachine(stateROM)
+    first.SetRandom(RandomSplitMix, 1)
+    second, _ := NewMachine(stateROM)
+    second.SetRandom(RandomSplitMix, 2)
+    assert.NotEqual(randomBytes(first, 20), randomBytes(second, 20))
+}
+
+func TestVIPRandom(t *testing.T) {
+    assert := assert.New(t)
+
+    r := rng{}
+    r.reset(RandomVIP, 0)
+    // 0x00 + 0xA3 = 0xA3, shifted to 0x51, plus 0xA3
+    assert.Equal(byte(0xF4), r.byte())
+    assert.Equal(uint64(0xF401), r.state)
+    // 0xF4 + 0x98 = 0x18C carries, shifted to 0xC6, plus 0x8C
+    assert.Equal(byte(0x52), r.byte())
+    assert.Equal(uint64(0x5202), r.state)
+}
+
+// Both algorithms spread RND over the byte range. The VIP's is weaker than SplitMix but
+// still reaches most values, rather than the zeros and ones an empty lookup page gives.
+func TestRandomDistribution(t *testing.T) {
+    assert := assert.New(t)
+
+    for _, algorithm := range []RandomAlgorithm{RandomSplitMix, RandomVIP} {
+        for _, seed := range []uint64{0, 1234} {
+            r := rng{}
+            r.reset(algorithm, seed)
+            var counts [256]int
+            for k := 0; k < 2000; k++ {
+                counts[r.byte()]++
+            }
+            distinct, most := 0, 0
+            for _, count := range counts {
+                if count > 0 {
+                    distinct++
+                }
+                if count > most {
+                    most = count
+                }
+            }
+            assert.True(distinct > 128, "%v seed %d gives %d distinct values", algorithm, seed, distinct)
+            assert.True(most < 100, "%v seed %d gives one value %d times", algorithm, seed, most)
+            assert.True(counts[0] + counts[1] < 100, "%v seed %d mostly gives 0 and 1", algorithm, seed)
+        }
+    }
+}
+
+func TestSaveStateKeepsRandomAlgorithm(t *testing.T) {
+    assert := assert.New(t)
+
+    machine, _ := NewMachine(stateROM)
+    machine.SetRandom(RandomVIP, 99)
+    state := machine.SaveState()
+    machine.SetRandom(RandomSplitMix, 1)
+
+    assert.NoError(machine.LoadState(state))
+    algorithm, seed := machine.Random()
+    assert.Equal(RandomVIP, algorithm)
+    assert.Equal(uint64(99), seed)
+}
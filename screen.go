@@ -0,0 +1,72 @@
+package chip8
+
+import "bytes"
+
+// Display buffer indexed by [x][y]. Only the top-left Width x Height pixels are in use,
+// 64x32 normally or 128x64 in SUPER-CHIP high resolution mode. Each pixel holds one bit
+// per XO-CHIP plane, so lit pixels are 1, 2 or 3.
+type Screen struct {
+    Width, Height int
+    Pixels        [128][64]byte
+}
+
+// Both XO-CHIP planes
+const allPlanes = 0x3
+
+func newScreen() Screen {
+    return Screen{Width: 64, Height: 32}
+}
+
+// Text rendering with one character per pixel: '.' when off, otherwise the pixel value
+func (s *Screen) String() string {
+    var buf bytes.Buffer
+    for j := 0; j < s.Height; j++ {
+        for i := 0; i < s.Width; i++ {
+            if s.Pixels[i][j] == 0 {
+                buf.WriteByte('.')
+            } else {
+                buf.WriteByte('0' + s.Pixels[i][j])
+            }
+        }
+        buf.WriteByte('\n')
+    }
+    return buf.String()
+}
+
+func (s *Screen) Hires() bool {
+    return s.Width == 128
+}
+
+// Clear the given planes
+func (s *Screen) clear(planes byte) {
+    for i := range s.Pixels {
+        for j := range s.Pixels[i] {
+            s.Pixels[i][j] &^= planes
+        }
+    }
+}
+
+// Switch resolution, clearing the display
+func (s *Screen) setHires(hires bool) {
+    if hires {
+        s.Width, s.Height = 128, 64
+    } else {
+        s.Width, s.Height = 64, 32
+    }
+    s.clear(allPlanes)
+}
+
+// Move the given planes right by dx and down by dy pixels. Pixels moved past an edge are lost.
+func (s *Screen) scroll(dx, dy int, planes byte) {
+    prev := s.Pixels
+    for i := 0; i < s.Width; i++ {
+        for j := 0; j < s.Height; j++ {
+            var moved byte
+            si, sj := i - dx, j - dy
+            if si >= 0 && si < s.Width && sj >= 0 && sj < s.Height {
+                moved = prev[si][sj] & planes
+            }
+            s.Pixels[i][j] = prev[i][j] &^ planes | moved
+        }
+    }
+}
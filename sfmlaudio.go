@@ -0,0 +1,44 @@
+// +build !nosfml
+
+package chip8
+
+import (
+    sf "bitbucket.org/krepa098/gosfml2"
+)
+
+type SFMLAudio struct {
+    sound  *sf.Sound
+    buffer *sf.SoundBuffer
+}
+
+func NewSFMLAudio() *SFMLAudio {
+    return &SFMLAudio{}
+}
+
+// Loop one cycle of the tone until stopped
+func (a *SFMLAudio) StartTone(tone *Tone) {
+    a.StopTone()
+    samples := make([]int16, tone.Period(SampleRate))
+    tone.Fill(samples, SampleRate)
+
+    buffer, err := sf.NewSoundBufferFromSamples(samples, 1, SampleRate)
+    if err != nil {
+        return
+    }
+    a.buffer = buffer
+    a.sound = sf.NewSound(buffer)
+    a.sound.SetLoop(true)
+    a.sound.Play()
+}
+
+func (a *SFMLAudio) StopTone() {
+    if a.sound != nil {
+        a.sound.Stop()
+        a.sound = nil
+        a.buffer = nil
+    }
+}
+
+func (a *SFMLAudio) Release() {
+    a.StopTone()
+}
@@ -1,89 +1,190 @@
+// +build !nosfml
+
 package chip8
 
 import (
     sf "bitbucket.org/krepa098/gosfml2"
+    "fmt"
 )
 
+// RGBA colors for pixel values 0-3, one bit per XO-CHIP plane
+var palette = [4][4]byte {
+    {0x00, 0x00, 0x00, 0xFF},
+    {0xFF, 0xFF, 0xFF, 0xFF},
+    {0xAA, 0xAA, 0xAA, 0xFF},
+    {0x55, 0x55, 0x55, 0xFF},
+}
+
 type SFMLWindow struct {
-    window *sf.RenderWindow
-    scale  sf.Vector2f
-    bitmap [4 * 64 * 32]byte
-    keys   map[HexKey]sf.KeyCode
+    window        *sf.RenderWindow
+    width, height uint
+    bitmap        [4 * 128 * 64]byte
+    keymap        *Keymap
+    codes         [16][]sf.KeyCode     // Key codes bound to each hex key
+    hexKeys       map[sf.KeyCode]HexKey // Hex key bound to each key code
+    requests      []StateRequest
+    remapper      *Remapper // Non-nil while remapping keys
+    remapped      *Keymap   // Finished remap not yet collected by RemappedKeys
+}
+
+// SFML key codes by the names used in keymaps, besides letters and digits
+var sfKeyCodes = map[string]sf.KeyCode {
+    "space": sf.KeySpace, "enter": sf.KeyReturn, "tab": sf.KeyTab,
+    "up": sf.KeyUp, "down": sf.KeyDown, "left": sf.KeyLeft, "right": sf.KeyRight,
+    ",": sf.KeyComma, ".": sf.KeyPeriod, "/": sf.KeySlash, ";": sf.KeySemiColon, "'": sf.KeyQuote,
+    "[": sf.KeyLBracket, "]": sf.KeyRBracket, "-": sf.KeyDash, "=": sf.KeyEqual,
+    "`": sf.KeyTilde, "\\": sf.KeyBackSlash,
+}
+
+func init() {
+    for k := 0; k < 10; k++ {
+        sfKeyCodes[fmt.Sprintf("num%d", k)] = sf.KeyNumpad0 + sf.KeyCode(k)
+        sfKeyCodes[string('0' + byte(k))] = sf.KeyNum0 + sf.KeyCode(k)
+    }
+    for c := byte('a'); c <= 'z'; c++ {
+        sfKeyCodes[string(c)] = sf.KeyA + sf.KeyCode(c - 'a')
+    }
 }
 
 func NewSFMLWindow(width, height uint) *SFMLWindow {
     videoMode := sf.VideoMode{Width: width, Height: height, BitsPerPixel: 32}
     windowStyle := sf.StyleTitlebar | sf.StyleClose
     window := sf.NewRenderWindow(videoMode, "chip8", windowStyle, sf.DefaultContextSettings())
-    bitmap := [4 * 64 * 32]byte{}
-    keys := map[HexKey]sf.KeyCode {
-        0x0: sf.KeyX,
-        0x1: sf.KeyNum1,
-        0x2: sf.KeyNum2,
-        0x3: sf.KeyNum3,
-        0x4: sf.KeyQ,
-        0x5: sf.KeyW,
-        0x6: sf.KeyE,
-        0x7: sf.KeyA,
-        0x8: sf.KeyS,
-        0x9: sf.KeyD,
-        0xA: sf.KeyZ,
-        0xB: sf.KeyC,
-        0xC: sf.KeyNum4,
-        0xD: sf.KeyR,
-        0xE: sf.KeyF,
-        0xF: sf.KeyV,
+    bitmap := [4 * 128 * 64]byte{}
+
+    w := &SFMLWindow{window: window, width: width, height: height, bitmap: bitmap}
+    w.SetKeymap(DefaultKeymap())
+    return w
+}
+
+func (w *SFMLWindow) SetKeymap(keymap *Keymap) {
+    w.keymap = keymap
+    w.hexKeys = map[sf.KeyCode]HexKey{}
+    for key := HexKey(0); key < 16; key++ {
+        w.codes[key] = nil
+        for _, name := range keymap.Keys(key) {
+            if code, ok := sfKeyCodes[name]; ok {
+                w.codes[key] = append(w.codes[key], code)
+                w.hexKeys[code] = key
+            }
+        }
+    }
+}
+
+// Name of the key with a code, as used in keymaps
+func sfKeyName(code sf.KeyCode) (string, bool) {
+    for name, c := range sfKeyCodes {
+        if c == code {
+            return name, true
+        }
     }
+    return "", false
+}
 
-    return &SFMLWindow{window: window, scale: sf.Vector2f{float32(width / 64), float32(height / 32)},
-                       bitmap: bitmap, keys: keys}
+// Handle an event. Returns the hex key pressed, if any.
+func (w *SFMLWindow) handle(event sf.Event) (HexKey, bool) {
+    switch ev := event.(type) {
+    case sf.EventKeyPressed:
+        if w.remapper != nil {
+            w.remap(ev.Code)
+            return 0, false
+        }
+        w.hotkey(ev)
+        key, ok := w.hexKeys[ev.Code]
+        return key, ok
+    case sf.EventClosed:
+        w.window.Close()
+    }
+    return 0, false
 }
 
 func (w *SFMLWindow) Update() {
     for event := w.window.PollEvent(); event != nil; event = w.window.PollEvent() {
-        switch event.(type) {
-        case sf.EventClosed:
-            w.window.Close()
-        }
+        w.handle(event)
+    }
+}
+
+// F1-F4 load quick save slots 1-4, and with Shift save them. F5 remaps the keys.
+func (w *SFMLWindow) hotkey(ev sf.EventKeyPressed) {
+    if ev.Code >= sf.KeyF1 && ev.Code <= sf.KeyF4 {
+        w.requests = append(w.requests, StateRequest{Slot: int(ev.Code - sf.KeyF1) + 1, Save: ev.Shift})
+    }
+    if ev.Code == sf.KeyF5 {
+        w.remapper = NewRemapper(w.keymap)
+        w.window.SetTitle("chip8: " + w.remapper.Prompt())
     }
 }
 
+// Bind the next hex key while remapping. The prompt is shown in the title bar.
+func (w *SFMLWindow) remap(code sf.KeyCode) {
+    if code == sf.KeyEscape {
+        w.remapper.Skip()
+    } else if name, ok := sfKeyName(code); ok {
+        w.remapper.Press(name)
+    } else {
+        return
+    }
+    if _, waiting := w.remapper.Next(); waiting {
+        w.window.SetTitle("chip8: " + w.remapper.Prompt())
+        return
+    }
+    w.remapped = w.remapper.Keymap()
+    w.SetKeymap(w.remapped)
+    w.remapper = nil
+    w.window.SetTitle("chip8")
+}
+
+func (w *SFMLWindow) RemappedKeys() *Keymap {
+    keymap := w.remapped
+    w.remapped = nil
+    return keymap
+}
+
+// Backspace runs the emulation backwards
+func (w *SFMLWindow) RewindHeld() bool {
+    return sf.KeyboardIsKeyPressed(sf.KeyBack)
+}
+
+func (w *SFMLWindow) StateRequests() []StateRequest {
+    requests := w.requests
+    w.requests = nil
+    return requests
+}
+
 func (w *SFMLWindow) IsKeyPressed(key HexKey) bool {
-    return sf.KeyboardIsKeyPressed(w.keys[key])
+    if w.remapper != nil {
+        return false
+    }
+    for _, code := range w.codes[key & 0xF] {
+        if sf.KeyboardIsKeyPressed(code) {
+            return true
+        }
+    }
+    return false
 }
 
 func (w *SFMLWindow) WaitForKeyPress() HexKey {
     for !w.ShouldClose() {
-        event := w.window.WaitEvent()
-        switch ev := event.(type) {
-        case sf.EventKeyPressed:
-            // Inefficient lookup. Something more elegant than storing reverse map?
-            for k, v := range w.keys {
-                if ev.Code == v {
-                    return k
-                }
-            }
-        case sf.EventClosed:
-            w.window.Close()
+        if key, ok := w.handle(w.window.WaitEvent()); ok {
+            return key
         }
     }
     // Dummy return value. Program will exit.
     return 0xFF
 }
 
-func (w *SFMLWindow) Draw(screen *[64][32]byte) {
-    for j := uint(0); j < 32; j++ {
-        for i := uint(0); i < 64; i++ {
-            for k := uint(0); k < 4; k++ {
-                w.bitmap[4 * (64 * j + i) + k] = 255 * screen[i][j]
-            }
+func (w *SFMLWindow) Draw(screen *Screen) {
+    width, height := uint(screen.Width), uint(screen.Height)
+    for j := uint(0); j < height; j++ {
+        for i := uint(0); i < width; i++ {
+            copy(w.bitmap[4 * (width * j + i):], palette[screen.Pixels[i][j] & allPlanes][:])
         }
     }
 
-    image, _ := sf.NewImageFromPixels(64, 32, w.bitmap[:])
+    image, _ := sf.NewImageFromPixels(width, height, w.bitmap[:4 * width * height])
     texture, _ := sf.NewTextureFromImage(image, nil)
     sprite, _ := sf.NewSprite(texture)
-    sprite.Scale(w.scale)
+    sprite.Scale(sf.Vector2f{float32(w.width) / float32(width), float32(w.height) / float32(height)})
 
     w.window.Draw(sprite, sf.DefaultRenderStates())
     w.window.Display()
@@ -0,0 +1,77 @@
+package chip8
+
+import "fmt"
+
+// What CALL does with a full stack and RET with an empty one
+type StackPolicy byte
+
+const (
+    StackHalt StackPolicy = iota // Fault with a StackError, ending the run
+    StackTrap                    // Fault with a StackError, stopping in a GDB client if one can attach
+    StackWrap                    // Let SP wrap around and keep the deeper entries in memory
+)
+
+// Policies by the names accepted on the command line
+var StackPolicies = map[string]StackPolicy {
+    "halt": StackHalt,
+    "trap": StackTrap,
+    "wrap": StackWrap,
+}
+
+func (p StackPolicy) String() string {
+    for name, policy := range StackPolicies {
+        if policy == p {
+            return name
+        }
+    }
+    return fmt.Sprintf("StackPolicy(%d)", p)
+}
+
+// When the stack wraps, return addresses that don't fit in Context.stack are stored below
+// this address, two bytes each, as the COSMAC VIP's stack grew down from here into the
+// program when it overflowed
+const stackMemory = 0xEA0
+
+// Address in memory of stack entry k, for entries past Context.stack
+func stackSlot(k byte) int {
+    return stackMemory - 2 * (int(k) - 15)
+}
+
+// Push a return address for CALL. SP counts the entries, so the top one is stack[SP-1].
+func (c *Context) push(addr uint16) error {
+    sp := c.cpu.sp
+    if int(sp) >= len(c.stack) && c.stackPolicy != StackWrap {
+        return c.stackError(true)
+    }
+    if int(sp) < len(c.stack) {
+        c.stack[sp] = addr
+    } else {
+        slot := stackSlot(sp)
+        c.write(slot, byte(addr >> 8))
+        c.write(slot + 1, byte(addr))
+    }
+    c.cpu.sp = sp + 1
+    return nil
+}
+
+// Pop the return address for RET
+func (c *Context) pop() (uint16, error) {
+    sp := c.cpu.sp
+    if sp == 0 && c.stackPolicy != StackWrap {
+        return 0, c.stackError(false)
+    }
+    sp--
+    var addr uint16
+    if int(sp) < len(c.stack) {
+        addr = c.stack[sp]
+    } else {
+        slot := stackSlot(sp)
+        addr = uint16(c.read(slot)) << 8 | uint16(c.read(slot + 1))
+    }
+    c.cpu.sp = sp
+    return addr, nil
+}
+
+func (c *Context) stackError(overflow bool) error {
+    return &StackError{PC: c.cpu.pc, Overflow: overflow, SP: c.cpu.sp, Stack: c.stack}
+}
@@ -0,0 +1,49 @@
+package chip8
+
+import (
+    "github.com/stretchr/testify/assert"
+    "testing"
+)
+
+func TestStackWrapsIntoMemory(t *testing.T) {
+    assert := assert.New(t)
+
+    // CALL 0x200, recursing until the stack is well past its 16 entries
+    machine, _ := NewMachine([]byte{0x22, 0x00})
+    machine.SetStackPolicy(StackWrap)
+    for k := 0; k < 18; k++ {
+        assert.NoError(machine.Step())
+    }
+    assert.Equal(byte(18), machine.SP())
+    memory := machine.Memory()
+    assert.Equal([]byte{0x02, 0x02, 0x02, 0x02}, memory[stackSlot(17):stackSlot(15)])
+
+    // RET with an empty stack wraps SP around to the top
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
+    context.stackPolicy = StackWrap
+    context.memory[stackSlot(255)], context.memory[stackSlot(255) + 1] = 0x03, 0x21
+    assert.NoError(context.push(0x456))
+    for _, want := range []uint16{0x456, 0x321, 0} {
+        addr, err := context.pop()
+        assert.NoError(err)
+        assert.Equal(want, addr)
+    }
+    assert.Equal(byte(254), context.cpu.sp)
+}
+
+func TestStackErrorShowsStack(t *testing.T) {
+    assert := assert.New(t)
+    context := newContext(newCPU(), new(HeadlessWindow), [65536]byte{})
+
+    for k := uint16(0); k < 16; k++ {
+        assert.NoError(context.push(0x200 + 2 * k))
+    }
+    err := context.push(0x300)
+    if assert.IsType(&StackError{}, err) {
+        fault := err.(*StackError)
+        assert.True(fault.Overflow)
+        assert.Equal(byte(16), fault.SP)
+        assert.Equal(uint16(0x21E), fault.Stack[15])
+    }
+    assert.EqualError(err, "stack overflow at 200, stack [200 202 204 206 208 20A 20C 20E 210 212 214 216 218 21A 21C 21E]")
+}
@@ -0,0 +1,141 @@
+package chip8
+
+import (
+    "bytes"
+    "encoding/binary"
+    "fmt"
+    "io"
+    "io/ioutil"
+)
+
+// Save states start with this, followed by the format version
+const stateMagic = "CH8S"
+
+// Increase when savedState or the meaning of its fields changes, so older states are
+// refused rather than misread. Version 4 stack entries are return addresses, version 5
+// keeps them in stack[0] through stack[SP-1], version 6 records the XO-CHIP mode, version 7
+// adds a quirk and version 8 counts Cycles in sixtieths for 60 Hz frames.
+const stateVersion = 8
+
+// Everything needed to resume a machine, in a fixed layout for encoding/binary
+type savedState struct {
+    PC, I        uint16
+    DT, ST, SP   byte
+    V            [16]byte
+    Stack        [16]uint16
+    Memory       [65536]byte
+    Width        uint16
+    Height       uint16
+    Pixels       [128][64]byte
+    Quirks       Quirks
+    StackPolicy  StackPolicy
+    XOChip       bool
+    Flags        [16]byte
+    Planes       byte
+    Pitch        byte
+    Audio        [16]byte
+    HasAudio     bool
+    RNG          uint64
+    RNGAlgorithm RandomAlgorithm
+    RNGSeed      uint64
+    Speed        int64
+    Cycles       int64
+    InFrame      bool
+    VBlank       bool
+}
+
+// Write the machine's state. The window, audio and memory hooks are not part of it.
+func (m *Machine) WriteState(w io.Writer) error {
+    c, cpu := m.context, m.context.cpu
+    state := &savedState{
+        PC: cpu.pc, I: cpu.i, DT: cpu.dt, ST: cpu.st, SP: cpu.sp, V: cpu.v,
+        Stack: c.stack, Memory: c.memory,
+        Width: uint16(c.screen.Width), Height: uint16(c.screen.Height), Pixels: c.screen.Pixels,
+        Quirks: c.quirks, StackPolicy: c.stackPolicy, XOChip: c.xochip, Flags: c.flags, Planes: c.planes, Pitch: c.pitch, Audio: c.audio,
+        HasAudio: c.hasAudio, RNG: c.rng.state,
+        RNGAlgorithm: c.rng.algorithm, RNGSeed: c.rng.seed,
+        Speed: m.speed, Cycles: m.cycles, InFrame: m.inFrame, VBlank: c.vblank,
+    }
+    if _, err := io.WriteString(w, stateMagic); err != nil {
+        return err
+    }
+    if err := binary.Write(w, binary.LittleEndian, uint16(stateVersion)); err != nil {
+        return err
+    }
+    return binary.Write(w, binary.LittleEndian, state)
+}
+
+// Restore a state written by WriteState. The machine is unchanged if the state can't be
+// read.
+func (m *Machine) ReadState(r io.Reader) error {
+    magic := make([]byte, len(stateMagic))
+    var version uint16
+    if _, err := io.ReadFull(r, magic); err != nil || string(magic) != stateMagic {
+        return ErrNotSaveState
+    }
+    if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+        return ErrNotSaveState
+    }
+    if version != stateVersion {
+        return fmt.Errorf("save state version %d is not supported, expected %d", version, stateVersion)
+    }
+    state := new(savedState)
+    if err := binary.Read(r, binary.LittleEndian, state); err != nil {
+        return fmt.Errorf("could not read save state: %v", err)
+    }
+    lores := state.Width == 64 && state.Height == 32
+    hires := state.Width == 128 && state.Height == 64
+    // Only a wrapping stack goes deeper than Context.stack
+    deep := state.SP > 16 && state.StackPolicy != StackWrap
+    // Only XO-CHIP selects planes other than the first
+    planes := state.Planes <= 3 && (state.XOChip || state.Planes == 1)
+    if !lores && !hires || deep || !planes || state.StackPolicy > StackWrap || state.Speed < 1 ||
+       state.RNGAlgorithm > RandomVIP {
+        return ErrNotSaveState
+    }
+
+    c, cpu := m.context, m.context.cpu
+    cpu.pc, cpu.i, cpu.dt, cpu.st, cpu.sp, cpu.v = state.PC, state.I, state.DT, state.ST, state.SP, state.V
+    c.stack, c.memory = state.Stack, state.Memory
+    c.screen = Screen{Width: int(state.Width), Height: int(state.Height), Pixels: state.Pixels}
+    c.quirks, c.stackPolicy, c.xochip = state.Quirks, state.StackPolicy, state.XOChip
+    c.flags, c.planes, c.pitch = state.Flags, state.Planes, state.Pitch
+    c.audio, c.hasAudio = state.Audio, state.HasAudio
+    c.rng = rng{algorithm: state.RNGAlgorithm, seed: state.RNGSeed, state: state.RNG}
+    c.vblank = state.VBlank
+    m.speed, m.cycles, m.inFrame = state.Speed, state.Cycles, state.InFrame
+
+    // The buzzer restarts with the restored tone on the next frame if it is still sounding
+    if m.playing {
+        m.audio.StopTone()
+        if m.recorder != nil {
+            m.recorder.StopTone()
+        }
+        m.playing = false
+    }
+    c.window.Draw(&c.screen)
+    return nil
+}
+
+func (m *Machine) SaveState() []byte {
+    var buf bytes.Buffer
+    // Writing to a buffer can't fail
+    m.WriteState(&buf)
+    return buf.Bytes()
+}
+
+func (m *Machine) LoadState(state []byte) error {
+    return m.ReadState(bytes.NewReader(state))
+}
+
+func (m *Machine) SaveStateFile(path string) error {
+    return ioutil.WriteFile(path, m.SaveState(), 0644)
+}
+
+func (m *Machine) LoadStateFile(path string) error {
+    state, err := ioutil.ReadFile(path)
+    if err != nil {
+        return err
+    }
+    return m.LoadState(state)
+}
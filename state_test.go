@@ -0,0 +1,87 @@
+package chip8
+
+import (
+    "github.com/stretchr/testify/assert"
+    "testing"
+)
+
+// RND V0, 0xFF; ADD V1, 1; ST [I], V1; DRW V0, V1, 1; JP 0x200
+var stateROM = []byte{0xC0, 0xFF, 0x71, 0x01, 0xF1, 0x55, 0xD0, 0x11, 0x12, 0x00}
+
+func TestSaveStateRestoresMachine(t *testing.T) {
+    assert := assert.New(t)
+
+    machine, _ := NewMachine(stateROM)
+    machine.SetQuirks(VIPQuirks)
+    machine.SetStackPolicy(StackWrap)
+    machine.SetSpeed(700)
+    machine.context.cpu.dt = 30
+    assert.NoError(machine.RunFrames(3))
+    state := machine.SaveState()
+    v, memory, screen := machine.V(), machine.Memory(), machine.Screen()
+
+    assert.NoError(machine.RunFrames(5))
+    machine.SetQuirks(Quirks{})
+    machine.SetStackPolicy(StackHalt)
+    assert.NotEqual(v, machine.V())
+
+    window := new(HeadlessWindow)
+    machine.SetWindow(window)
+    assert.NoError(machine.LoadState(state))
+    assert.Equal(v, machine.V())
+    assert.Equal(memory, machine.Memory())
+    assert.Equal(screen, machine.Screen())
+    assert.Equal(VIPQuirks, machine.Quirks())
+    assert.Equal(StackWrap, machine.StackPolicy())
+    assert.Equal(byte(27), machine.DT())
+    assert.Equal(1, window.DrawCount())
+}
+
+func TestSaveStateReplaysRandomNumbers(t *testing.T) {
+    assert := assert.New(t)
+
+    machine, _ := NewMachine(stateROM)
+    state := machine.SaveState()
+    var first []byte
+    for k := 0; k < 10; k++ {
+        machine.RunFrames(1)
+        first = append(first, machine.V()[0])
+    }
+
+    assert.NoError(machine.LoadState(state))
+    for k := 0; k < 10; k++ {
+        machine.RunFrames(1)
+        assert.Equal(first[k], machine.V()[0])
+    }
+}
+
+func TestLoadStateRejectsBadData(t *testing.T) {
+    assert := assert.New(t)
+
+    machine, _ := NewMachine(stateROM)
+    machine.Step()
+    state := machine.SaveState()
+
+    assert.Equal(ErrNotSaveState, machine.LoadState([]byte("not a state")))
+    versioned := append([]byte{}, state...)
+    versioned[4] = 99
+    assert.EqualError(machine.LoadState(versioned), "save state version 99 is not supported, expected 8")
+    assert.Error(machine.LoadState(state[:len(state) - 1]))
+
+    // Failed loads leave the machine alone
+    assert.Equal(uint16(0x202), machine.PC())
+}
+
+func TestLoadStateRejectsBadPlanes(t *testing.T) {
+    assert := assert.New(t)
+
+    machine, _ := NewMachine(stateROM)
+    machine.context.planes = 2
+    assert.Equal(ErrNotSaveState, machine.LoadState(machine.SaveState()))
+
+    xochip, _ := NewXOChipMachine(stateROM)
+    xochip.context.planes = 3
+    assert.NoError(xochip.LoadState(xochip.SaveState()))
+    xochip.context.planes = 4
+    assert.Equal(ErrNotSaveState, xochip.LoadState(xochip.SaveState()))
+}
@@ -0,0 +1,342 @@
+package chip8
+
+import (
+    "bytes"
+    "fmt"
+    "golang.org/x/term"
+    "os"
+    "strings"
+    "time"
+)
+
+// Terminals only report key presses, so a key counts as held for this long after its last
+// press. Auto-repeat keeps a held key pressed.
+const keyHold = 150 * time.Millisecond
+
+// 256-color palette indices for pixel values 0-3, matching the SFML palette
+var terminalPalette = [4]int{16, 231, 248, 240}
+
+// Window that renders to a raw-mode ANSI terminal using Unicode half blocks, two pixels
+// per character cell. Ctrl-C closes the window, holding backspace rewinds and Ctrl-R
+// remaps the keys.
+type TerminalWindow struct {
+    in            *os.File
+    out           *os.File
+    state         *term.State
+    input         chan []byte // Each read of the terminal
+    keymap        *Keymap
+    pressed       [16]time.Time
+    rewind        time.Time // Last press of backspace, which rewinds
+    width, height int    // Terminal size in characters
+    screen        Screen   // Last frame drawn, redrawn after a resize
+    dirty         bool     // Screen changed since it was last written out
+    rows          []string // Rows last written out, so only changed rows are rewritten
+    closed        bool
+    remapper      *Remapper // Non-nil while remapping keys
+    remapped      *Keymap   // Finished remap not yet collected by RemappedKeys
+}
+
+func NewTerminalWindow() (*TerminalWindow, error) {
+    in, out := os.Stdin, os.Stdout
+    state, err := term.MakeRaw(int(in.Fd()))
+    if err != nil {
+        return nil, err
+    }
+
+    w := &TerminalWindow{in: in, out: out, state: state, input: make(chan []byte, 64), keymap: DefaultKeymap(),
+                         screen: newScreen()}
+    go w.read()
+
+    // Hide the cursor and clear the terminal
+    fmt.Fprint(out, "\x1b[?25l\x1b[2J")
+    w.width, w.height, _ = term.GetSize(int(out.Fd()))
+    return w, nil
+}
+
+// Forward input to the window a read at a time, which keeps the escape sequences the
+// terminal writes for special keys together. Runs until the process exits.
+func (w *TerminalWindow) read() {
+    for {
+        buf := make([]byte, 64)
+        n, err := w.in.Read(buf)
+        if err != nil {
+            close(w.input)
+            return
+        }
+        w.input <- buf[:n]
+    }
+}
+
+func (w *TerminalWindow) SetKeymap(keymap *Keymap) {
+    w.keymap = keymap
+}
+
+// Name of the key that types a character, as used in keymaps. Shifted letters count as
+// their key, but other shifted characters can't be told apart from different keys.
+func terminalKeyName(b byte) (string, bool) {
+    switch {
+    case b >= 'A' && b <= 'Z':
+        b += 'a' - 'A'
+    case b == ' ':
+        return "space", true
+    case b == '\r' || b == '\n':
+        return "enter", true
+    case b == '\t':
+        return "tab", true
+    }
+    name := string(b)
+    return name, IsKeyName(name)
+}
+
+// Name of the key that sends an escape sequence, for the arrow keys. Modifiers, as in
+// ESC [ 1 ; 5 A for Ctrl-Up, still count as the arrow.
+func terminalEscapeName(seq []byte) (string, bool) {
+    if len(seq) < 3 || seq[1] != '[' && seq[1] != 'O' {
+        return "", false
+    }
+    switch seq[len(seq) - 1] {
+    case 'A':
+        return "up", true
+    case 'B':
+        return "down", true
+    case 'C':
+        return "right", true
+    case 'D':
+        return "left", true
+    }
+    return "", false
+}
+
+// Length of the key at the start of input: a CSI sequence such as ESC [ A, an SS3 sequence
+// such as ESC O A, Alt and a character, or a single byte. A lone ESC is the Escape key.
+func terminalKeyLength(input []byte) int {
+    if input[0] != 0x1B || len(input) == 1 || input[1] == 0x1B {
+        return 1
+    }
+    switch input[1] {
+    case '[':
+        // Parameter and intermediate bytes, then the final byte
+        for k := 2; k < len(input); k++ {
+            if input[k] >= 0x40 && input[k] <= 0x7E {
+                return k + 1
+            }
+        }
+        return len(input)
+    case 'O':
+        if len(input) > 2 {
+            return 3
+        }
+    }
+    return 2
+}
+
+// Record a read of input. Returns the last hex key pressed, if any.
+func (w *TerminalWindow) handle(input []byte, ok bool) (HexKey, bool) {
+    if !ok {
+        w.closed = true
+        return 0, false
+    }
+    var key HexKey
+    var mapped bool
+    for len(input) > 0 {
+        n := terminalKeyLength(input)
+        if n == 1 {
+            if k, m := w.handleByte(input[0]); m {
+                key, mapped = k, m
+            }
+        } else if name, named := terminalEscapeName(input[:n]); named {
+            if k, m := w.press(name); m {
+                key, mapped = k, m
+            }
+        }
+        // Other escape sequences aren't mistaken for their last character
+        input = input[n:]
+    }
+    return key, mapped
+}
+
+// Record a single byte key
+func (w *TerminalWindow) handleByte(b byte) (HexKey, bool) {
+    if b == 0x03 {
+        w.closed = true
+        return 0, false
+    }
+    if w.remapper != nil {
+        if b == 0x1B {
+            w.remap("")
+        } else if name, ok := terminalKeyName(b); ok {
+            w.remap(name)
+        }
+        return 0, false
+    }
+    switch b {
+    case 0x12:
+        w.remapper = NewRemapper(w.keymap)
+        w.prompt(w.remapper.Prompt())
+        return 0, false
+    case 0x7F, 0x08:
+        w.rewind = time.Now()
+        return 0, false
+    }
+    name, named := terminalKeyName(b)
+    if !named {
+        return 0, false
+    }
+    return w.press(name)
+}
+
+// Record a press of a named key. Returns the hex key it is bound to, if any.
+func (w *TerminalWindow) press(name string) (HexKey, bool) {
+    if w.remapper != nil {
+        w.remap(name)
+        return 0, false
+    }
+    key, mapped := w.keymap.Lookup(name)
+    if mapped {
+        w.pressed[key] = time.Now()
+    }
+    return key, mapped
+}
+
+// Bind the next hex key to a named key while remapping. An empty name, for Escape, keeps the
+// current keys.
+func (w *TerminalWindow) remap(name string) {
+    if name == "" {
+        w.remapper.Skip()
+    } else {
+        w.remapper.Press(name)
+    }
+    if _, waiting := w.remapper.Next(); waiting {
+        w.prompt(w.remapper.Prompt())
+        return
+    }
+    w.remapped = w.remapper.Keymap()
+    w.keymap = w.remapped
+    w.remapper = nil
+    w.dirty = true
+}
+
+// Show a message over the top line of the display
+func (w *TerminalWindow) prompt(message string) {
+    if w.out != nil {
+        fmt.Fprintf(w.out, "\x1b[H\x1b[0m%s\x1b[K", message)
+    }
+    if len(w.rows) > 0 {
+        w.rows[0] = ""
+    }
+}
+
+func (w *TerminalWindow) RemappedKeys() *Keymap {
+    keymap := w.remapped
+    w.remapped = nil
+    return keymap
+}
+
+func (w *TerminalWindow) Update() {
+    for {
+        select {
+        case input, ok := <-w.input:
+            w.handle(input, ok)
+            if !ok {
+                return
+            }
+        default:
+            width, height, err := term.GetSize(int(w.out.Fd()))
+            if err == nil && (width != w.width || height != w.height) {
+                w.width, w.height = width, height
+                fmt.Fprint(w.out, "\x1b[2J")
+                w.rows, w.dirty = nil, true
+            }
+            w.flush()
+            return
+        }
+    }
+}
+
+func (w *TerminalWindow) IsKeyPressed(key HexKey) bool {
+    return time.Since(w.pressed[key & 0xF]) < keyHold
+}
+
+// Backspace runs the emulation backwards
+func (w *TerminalWindow) RewindHeld() bool {
+    return time.Since(w.rewind) < keyHold
+}
+
+func (w *TerminalWindow) WaitForKeyPress() HexKey {
+    for !w.closed {
+        // The emulation is blocked, so show the frame drawn before the wait
+        w.flush()
+        input, ok := <-w.input
+        if key, mapped := w.handle(input, ok); mapped {
+            return key
+        }
+    }
+    // Dummy return value. Program will exit.
+    return 0xFF
+}
+
+// Drawing is deferred to the next Update so the terminal is written at most once a frame
+func (w *TerminalWindow) Draw(screen *Screen) {
+    w.screen = *screen
+    w.dirty = true
+}
+
+// Write out the rows of the screen that changed since the last flush
+func (w *TerminalWindow) flush() {
+    if !w.dirty || w.out == nil {
+        return
+    }
+    w.dirty = false
+    screen := &w.screen
+
+    // Each character shows a pixel in the upper half and the one below it in the lower half
+    rows, cols := (screen.Height + 1) / 2, screen.Width
+    if rows > w.height {
+        rows = w.height
+    }
+    if cols > w.width {
+        cols = w.width
+    }
+    if len(w.rows) != rows {
+        w.rows = make([]string, rows)
+    }
+    var buf bytes.Buffer
+    for row := 0; row < rows; row++ {
+        var line strings.Builder
+        fg, bg := -1, -1
+        for i := 0; i < cols; i++ {
+            top := terminalPalette[screen.Pixels[i][2 * row] & allPlanes]
+            bottom := terminalPalette[screen.Pixels[i][2 * row + 1] & allPlanes]
+            if top != fg {
+                fmt.Fprintf(&line, "\x1b[38;5;%dm", top)
+                fg = top
+            }
+            if bottom != bg {
+                fmt.Fprintf(&line, "\x1b[48;5;%dm", bottom)
+                bg = bottom
+            }
+            line.WriteString("▀")
+        }
+        line.WriteString("\x1b[0m")
+        if line.String() != w.rows[row] {
+            w.rows[row] = line.String()
+            fmt.Fprintf(&buf, "\x1b[%d;1H%s", row + 1, w.rows[row])
+        }
+    }
+    w.out.Write(buf.Bytes())
+}
+
+func (w *TerminalWindow) Clear() {
+    screen := Screen{Width: w.screen.Width, Height: w.screen.Height}
+    w.Draw(&screen)
+}
+
+func (w *TerminalWindow) ShouldClose() bool {
+    return w.closed
+}
+
+func (w *TerminalWindow) Release() {
+    // Reset colors, show the cursor and leave the cursor below the display
+    fmt.Fprint(w.out, "\x1b[0m\x1b[?25h\r\n")
+    term.Restore(int(w.in.Fd()), w.state)
+}
@@ -0,0 +1,92 @@
+package chip8
+
+import (
+    "github.com/stretchr/testify/assert"
+    "io/ioutil"
+    "os"
+    "strings"
+    "testing"
+)
+
+func TestTerminalWindowKeys(t *testing.T) {
+    assert := assert.New(t)
+
+    keymap := NewKeymap()
+    keymap.Bind(0x0, "x")
+    keymap.Bind(0xF, "v")
+    w := &TerminalWindow{keymap: keymap}
+    key, mapped := w.handle([]byte{'V'}, true)
+    assert.True(mapped)
+    assert.Equal(HexKey(0xF), key)
+    assert.True(w.IsKeyPressed(0xF))
+    assert.False(w.IsKeyPressed(0x0))
+
+    _, mapped = w.handle([]byte{'p'}, true)
+    assert.False(mapped)
+    assert.False(w.ShouldClose())
+
+    // Escape sequences count as one key, not as their last character
+    keymap.Bind(0x1, "a")
+    _, mapped = w.handle([]byte("\x1b[A\x1b[1;5D\x1bOB"), true)
+    assert.False(mapped)
+    assert.False(w.IsKeyPressed(0x1))
+    key, mapped = w.handle([]byte("\x1b[Aa"), true)
+    assert.True(mapped)
+    assert.Equal(HexKey(0x1), key)
+
+    // Ctrl-R remaps, arrow keys bind by name and Escape keeps a key's binding
+    w.handle([]byte{0x12}, true)
+    w.handle([]byte{'P'}, true)
+    w.handle([]byte("\x1b[A"), true)
+    for k := 2; k < 16; k++ {
+        w.handle([]byte{0x1B}, true)
+    }
+    remapped := w.RemappedKeys()
+    assert.Equal([]string{"p"}, remapped.Keys(0x0))
+    assert.Equal([]string{"up"}, remapped.Keys(0x1))
+    assert.Equal([]string{"v"}, remapped.Keys(0xF))
+    assert.Nil(w.RemappedKeys())
+    key, mapped = w.handle([]byte{'p'}, true)
+    assert.True(mapped)
+    assert.Equal(HexKey(0x0), key)
+    key, mapped = w.handle([]byte("\x1bOA"), true)
+    assert.True(mapped)
+    assert.Equal(HexKey(0x1), key)
+
+    // Ctrl-C closes the window
+    w.handle([]byte{0x03}, true)
+    assert.True(w.ShouldClose())
+}
+
+func TestTerminalWindowDraw(t *testing.T) {
+    assert := assert.New(t)
+
+    out, err := ioutil.TempFile("", "chip8")
+    assert.NoError(err)
+    defer os.Remove(out.Name())
+
+    // Terminal narrower than the display clips the right side
+    w := &TerminalWindow{out: out, width: 2, height: 40}
+    screen := newScreen()
+    screen.Pixels[0][0] = 1
+    screen.Pixels[1][1] = 1
+    w.Draw(&screen)
+    w.flush()
+
+    // A second frame rewrites only the row that changed, and an unchanged frame nothing
+    screen.Pixels[0][5] = 1
+    w.Draw(&screen)
+    w.Draw(&screen)
+    w.flush()
+    w.Draw(&screen)
+    w.flush()
+    out.Close()
+
+    data, _ := ioutil.ReadFile(out.Name())
+    writes := strings.Split(string(data), "\x1b[")[1:]
+    assert.Equal(16 + 1, strings.Count(string(data), ";1H"))
+    assert.Equal("\x1b[1;1H\x1b[38;5;231m\x1b[48;5;16m▀\x1b[38;5;16m\x1b[48;5;231m▀\x1b[0m",
+                 "\x1b[" + strings.Join(writes[:6], "\x1b["))
+    assert.True(strings.HasSuffix(string(data),
+                "\x1b[3;1H\x1b[38;5;16m\x1b[48;5;231m▀\x1b[48;5;16m▀\x1b[0m"))
+}
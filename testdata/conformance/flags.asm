@@ -0,0 +1,163 @@
+; Checks the result and VF of the 8xy4-8xyE arithmetic, one tick or cross per case.
+; Shifts use the same register for x and y so the check holds under every quirk set.
+
+        LD V6, 0
+        LD V7, 0
+
+        ; ADD with and without carry
+        LD V1, 200
+        LD V2, 100
+        ADD V1, V2
+        LD V3, VF
+        LD V4, 44
+        LD V5, 1
+        CALL check
+        LD V1, 10
+        LD V2, 20
+        ADD V1, V2
+        LD V3, VF
+        LD V4, 30
+        LD V5, 0
+        CALL check
+
+        ; SUB without borrow, with borrow and with equal operands
+        LD V1, 100
+        LD V2, 30
+        SUB V1, V2
+        LD V3, VF
+        LD V4, 70
+        LD V5, 1
+        CALL check
+        LD V1, 30
+        LD V2, 100
+        SUB V1, V2
+        LD V3, VF
+        LD V4, 186
+        LD V5, 0
+        CALL check
+        LD V1, 50
+        LD V2, 50
+        SUB V1, V2
+        LD V3, VF
+        LD V4, 0
+        LD V5, 1
+        CALL check
+
+        ; SHR shifting a one and a zero out
+        LD V1, 5
+        SHR V1
+        LD V3, VF
+        LD V4, 2
+        LD V5, 1
+        CALL check
+        LD V1, 4
+        SHR V1
+        LD V3, VF
+        LD V4, 2
+        LD V5, 0
+        CALL check
+
+        ; SUBN is Vy - Vx
+        LD V1, 30
+        LD V2, 100
+        SUBN V1, V2
+        LD V3, VF
+        LD V4, 70
+        LD V5, 1
+        CALL check
+        LD V1, 100
+        LD V2, 30
+        SUBN V1, V2
+        LD V3, VF
+        LD V4, 186
+        LD V5, 0
+        CALL check
+        LD V1, 50
+        LD V2, 50
+        SUBN V1, V2
+        LD V3, VF
+        LD V4, 0
+        LD V5, 1
+        CALL check
+
+        ; SHL shifting a one and a zero out
+        LD V1, 0x81
+        SHL V1
+        LD V3, VF
+        LD V4, 0x02
+        LD V5, 1
+        CALL check
+        LD V1, 0x41
+        SHL V1
+        LD V3, VF
+        LD V4, 0x82
+        LD V5, 0
+        CALL check
+
+        ; With VF as the destination the flag wins over the result
+        LD VF, 200
+        LD V2, 100
+        ADD VF, V2
+        LD V1, VF
+        LD V3, VF
+        LD V4, 1
+        LD V5, 1
+        CALL check
+        LD VF, 30
+        LD V2, 100
+        SUB VF, V2
+        LD V1, VF
+        LD V3, VF
+        LD V4, 0
+        LD V5, 0
+        CALL check
+        LD VF, 4
+        SHR VF
+        LD V1, VF
+        LD V3, VF
+        LD V4, 0
+        LD V5, 0
+        CALL check
+        LD VF, 100
+        LD V2, 30
+        SUBN VF, V2
+        LD V1, VF
+        LD V3, VF
+        LD V4, 0
+        LD V5, 0
+        CALL check
+        LD VF, 0x81
+        SHL VF
+        LD V1, VF
+        LD V3, VF
+        LD V4, 1
+        LD V5, 1
+        CALL check
+
+done:   JP done
+
+; Draws a tick at V6, V7 when V1 = V4 and V3 = V5, otherwise a cross, and moves along
+check:  LD I, cross
+        SE V1, V4
+        JP draw
+        SE V3, V5
+        JP draw
+        LD I, tick
+draw:   DRW V6, V7, 5
+        ADD V6, 6
+        SE V6, 60
+        RET
+        LD V6, 0
+        ADD V7, 6
+        RET
+
+tick:   SPRITE ....#...
+        SPRITE ...#....
+        SPRITE #.#.....
+        SPRITE .#......
+        SPRITE ........
+cross:  SPRITE #...#...
+        SPRITE .#.#....
+        SPRITE ..#.....
+        SPRITE .#.#....
+        SPRITE #...#...
@@ -0,0 +1,356 @@
+package chip8
+
+import (
+    "bufio"
+    "encoding/binary"
+    "fmt"
+    "github.com/eskrm/chip8/disasm"
+    "io"
+    "sort"
+    "strings"
+)
+
+// Binary traces start with this, followed by the format version
+const traceMagic = "CH8T"
+
+const traceVersion = 1
+
+// Registers besides V0-VF whose changes are traced
+const (
+    TraceI  = 16 + iota
+    TraceSP
+    TraceDT
+    TraceST
+)
+
+// Register given a new value by a traced instruction. Register is 0-15 for V0-VF or one
+// of TraceI, TraceSP, TraceDT and TraceST.
+type RegisterChange struct {
+    Register byte
+    Value    uint16
+}
+
+func (c RegisterChange) String() string {
+    switch c.Register {
+    case TraceI:
+        return fmt.Sprintf("I=%04X", c.Value)
+    case TraceSP:
+        return fmt.Sprintf("SP=%X", c.Value)
+    case TraceDT:
+        return fmt.Sprintf("DT=%02X", c.Value)
+    case TraceST:
+        return fmt.Sprintf("ST=%02X", c.Value)
+    }
+    return fmt.Sprintf("V%X=%02X", c.Register, c.Value)
+}
+
+// One executed instruction
+type TraceEntry struct {
+    Cycle   uint64 // Instructions executed since tracing started, before this one
+    PC      uint16
+    Opcode  uint16
+    Long    uint16 // Operand of F000 nnnn
+    Changes []RegisterChange
+}
+
+func (e TraceEntry) Instruction() disasm.Instruction {
+    in := disasm.Instruction{Addr: e.PC, Opcode: e.Opcode, Long: e.Long, Size: 2}
+    if e.Opcode == 0xF000 {
+        in.Size = 4
+    }
+    return in
+}
+
+// Text form: cycle, PC, opcode, mnemonic and the registers changed
+func (e TraceEntry) String() string {
+    changes := make([]string, len(e.Changes))
+    for k, change := range e.Changes {
+        changes[k] = change.String()
+    }
+    line := fmt.Sprintf("%8d %03X: %04X  %-22s %s", e.Cycle, e.PC, e.Opcode, e.Instruction(), strings.Join(changes, " "))
+    return strings.TrimRight(line, " ")
+}
+
+// Groups of instructions that traces can be limited to, combinable as a mask
+type OpcodeClass uint16
+
+const (
+    ClassFlow    OpcodeClass = 1 << iota // Jumps, calls, returns and skips
+    ClassALU                             // Register loads and arithmetic
+    ClassMemory                          // I and the loads and stores through it
+    ClassDisplay                         // Drawing, scrolling and display modes
+    ClassInput                           // Key tests and waits
+    ClassTimer                           // Delay and sound timers
+    ClassRandom                          // RND
+    ClassSound                           // XO-CHIP audio pattern and pitch
+    ClassOther                           // EXIT and illegal opcodes
+    AllClasses   OpcodeClass = 1 << iota - 1
+)
+
+// Classes by the names accepted on the command line
+var OpcodeClasses = map[string]OpcodeClass {
+    "flow":    ClassFlow,
+    "alu":     ClassALU,
+    "memory":  ClassMemory,
+    "display": ClassDisplay,
+    "input":   ClassInput,
+    "timer":   ClassTimer,
+    "random":  ClassRandom,
+    "sound":   ClassSound,
+    "other":   ClassOther,
+}
+
+// Parse a comma separated list of class names such as "flow,alu"
+func ParseOpcodeClasses(text string) (OpcodeClass, error) {
+    var classes OpcodeClass
+    for _, name := range strings.Split(text, ",") {
+        class, ok := OpcodeClasses[strings.TrimSpace(name)]
+        if !ok {
+            names := make([]string, 0, len(OpcodeClasses))
+            for name := range OpcodeClasses {
+                names = append(names, name)
+            }
+            sort.Strings(names)
+            return 0, fmt.Errorf("unknown opcode class %q, use %s", name, strings.Join(names, ", "))
+        }
+        classes |= class
+    }
+    return classes, nil
+}
+
+// Class of an opcode
+func ClassOf(opcode uint16) OpcodeClass {
+    kk := opcode & 0xFF
+    switch opcode & 0xF000 {
+    case 0x0000:
+        switch {
+        case opcode == 0x00EE:
+            return ClassFlow
+        case opcode == 0x00E0, opcode & 0xFFE0 == 0x00C0, opcode >= 0x00FB && opcode != 0x00FD:
+            return ClassDisplay
+        }
+        return ClassOther
+    case 0x1000, 0x2000, 0x3000, 0x4000, 0x9000, 0xB000:
+        return ClassFlow
+    case 0x5000:
+        if opcode & 0xF == 0 {
+            return ClassFlow
+        }
+        return ClassMemory
+    case 0x6000, 0x7000, 0x8000:
+        return ClassALU
+    case 0xA000:
+        return ClassMemory
+    case 0xC000:
+        return ClassRandom
+    case 0xD000:
+        return ClassDisplay
+    case 0xE000:
+        return ClassInput
+    }
+    switch {
+    case opcode == 0xF002, kk == 0x3A:
+        return ClassSound
+    case opcode == 0xF000, kk == 0x1E, kk == 0x29, kk == 0x30, kk == 0x33, kk == 0x55, kk == 0x65:
+        return ClassMemory
+    case kk == 0x01:
+        return ClassDisplay
+    case kk == 0x0A:
+        return ClassInput
+    case kk == 0x07, kk == 0x15, kk == 0x18:
+        return ClassTimer
+    case kk == 0x75, kk == 0x85:
+        return ClassALU
+    }
+    return ClassOther
+}
+
+// Addresses from Start through End
+type AddrRange struct {
+    Start, End uint16
+}
+
+// Instructions to trace: those in one of the classes at an address in one of the ranges.
+// No ranges means every address.
+type TraceFilter struct {
+    Ranges  []AddrRange
+    Classes OpcodeClass
+}
+
+// Filter that passes every instruction
+var TraceAll = TraceFilter{Classes: AllClasses}
+
+func (f TraceFilter) Match(pc, opcode uint16) bool {
+    if ClassOf(opcode) & f.Classes == 0 {
+        return false
+    }
+    if len(f.Ranges) == 0 {
+        return true
+    }
+    for _, r := range f.Ranges {
+        if pc >= r.Start && pc <= r.End {
+            return true
+        }
+    }
+    return false
+}
+
+// Tracer records the instructions a machine executes, as text lines or in a compact binary
+// format that TraceReader reads back. Write errors stop the trace and are reported by
+// Flush.
+type Tracer struct {
+    w      *bufio.Writer
+    binary bool
+    filter TraceFilter
+    cycle  uint64 // Instructions executed so far
+    last   uint64 // Cycle of the last entry written, for binary deltas
+    err    error
+}
+
+// Trace as text, one line per instruction
+func NewTextTracer(w io.Writer) *Tracer {
+    return &Tracer{w: bufio.NewWriter(w), filter: TraceAll}
+}
+
+// Trace in the binary format
+func NewBinaryTracer(w io.Writer) (*Tracer, error) {
+    t := &Tracer{w: bufio.NewWriter(w), binary: true, filter: TraceAll}
+    t.w.WriteString(traceMagic)
+    binary.Write(t.w, binary.LittleEndian, uint16(traceVersion))
+    if err := t.w.Flush(); err != nil {
+        return nil, err
+    }
+    return t, nil
+}
+
+// Only trace the instructions the filter matches. Tracers start with TraceAll.
+func (t *Tracer) SetFilter(filter TraceFilter) {
+    t.filter = filter
+}
+
+// Registers traced for changes, in the order of RegisterChange numbers
+func traceRegisters(cpu *CPU) [20]uint16 {
+    var regs [20]uint16
+    for k, v := range cpu.v {
+        regs[k] = uint16(v)
+    }
+    regs[TraceI], regs[TraceSP], regs[TraceDT], regs[TraceST] = cpu.i, uint16(cpu.sp), uint16(cpu.dt), uint16(cpu.st)
+    return regs
+}
+
+// Record an instruction given the registers from before it ran
+func (t *Tracer) trace(in disasm.Instruction, before [20]uint16, cpu *CPU) {
+    cycle := t.cycle
+    t.cycle++
+    if t.err != nil || !t.filter.Match(in.Addr, in.Opcode) {
+        return
+    }
+    entry := TraceEntry{Cycle: cycle, PC: in.Addr, Opcode: in.Opcode, Long: in.Long}
+    for k, value := range traceRegisters(cpu) {
+        if value != before[k] {
+            entry.Changes = append(entry.Changes, RegisterChange{Register: byte(k), Value: value})
+        }
+    }
+    if t.binary {
+        t.err = t.writeBinary(entry)
+    } else {
+        _, t.err = fmt.Fprintln(t.w, entry)
+    }
+}
+
+// Each entry is a varint of the cycles since the previous one, the PC, the opcode, the
+// operand of a long load, then a count of changes each as a register and its value. Only
+// I takes two bytes.
+func (t *Tracer) writeBinary(e TraceEntry) error {
+    var buf [binary.MaxVarintLen64]byte
+    record := append([]byte(nil), buf[:binary.PutUvarint(buf[:], e.Cycle - t.last)]...)
+    t.last = e.Cycle
+    record = append(record, byte(e.PC), byte(e.PC >> 8), byte(e.Opcode), byte(e.Opcode >> 8))
+    if e.Opcode == 0xF000 {
+        record = append(record, byte(e.Long), byte(e.Long >> 8))
+    }
+    record = append(record, byte(len(e.Changes)))
+    for _, change := range e.Changes {
+        record = append(record, change.Register, byte(change.Value))
+        if change.Register == TraceI {
+            record = append(record, byte(change.Value >> 8))
+        }
+    }
+    _, err := t.w.Write(record)
+    return err
+}
+
+// Write out buffered entries. Returns the first error the trace met.
+func (t *Tracer) Flush() error {
+    if t.err != nil {
+        return t.err
+    }
+    return t.w.Flush()
+}
+
+// Reads entries from a binary trace
+type TraceReader struct {
+    r    *bufio.Reader
+    last uint64
+}
+
+func NewTraceReader(r io.Reader) (*TraceReader, error) {
+    br := bufio.NewReader(r)
+    magic := make([]byte, len(traceMagic))
+    var version uint16
+    if _, err := io.ReadFull(br, magic); err != nil || string(magic) != traceMagic {
+        return nil, ErrNotTrace
+    }
+    if err := binary.Read(br, binary.LittleEndian, &version); err != nil {
+        return nil, ErrNotTrace
+    }
+    if version != traceVersion {
+        return nil, fmt.Errorf("trace version %d is not supported, expected %d", version, traceVersion)
+    }
+    return &TraceReader{r: br}, nil
+}
+
+// Next entry of the trace, or io.EOF after the last one
+func (t *TraceReader) Next() (TraceEntry, error) {
+    var e TraceEntry
+    delta, err := binary.ReadUvarint(t.r)
+    if err != nil {
+        return e, err
+    }
+    var head [5]byte
+    if _, err := io.ReadFull(t.r, head[:]); err != nil {
+        return e, io.ErrUnexpectedEOF
+    }
+    t.last += delta
+    e.Cycle = t.last
+    e.PC = uint16(head[0]) | uint16(head[1]) << 8
+    e.Opcode = uint16(head[2]) | uint16(head[3]) << 8
+    count := head[4]
+    if e.Opcode == 0xF000 {
+        // The count byte was the long operand's low byte
+        var rest [2]byte
+        if _, err := io.ReadFull(t.r, rest[:]); err != nil {
+            return e, io.ErrUnexpectedEOF
+        }
+        e.Long = uint16(head[4]) | uint16(rest[0]) << 8
+        count = rest[1]
+    }
+    for k := 0; k < int(count); k++ {
+        var change [2]byte
+        if _, err := io.ReadFull(t.r, change[:]); err != nil {
+            return e, io.ErrUnexpectedEOF
+        }
+        c := RegisterChange{Register: change[0], Value: uint16(change[1])}
+        if c.Register == TraceI {
+            hi, err := t.r.ReadByte()
+            if err != nil {
+                return e, io.ErrUnexpectedEOF
+            }
+            c.Value |= uint16(hi) << 8
+        } else if c.Register > TraceST {
+            return e, ErrNotTrace
+        }
+        e.Changes = append(e.Changes, c)
+    }
+    return e, nil
+}
@@ -0,0 +1,101 @@
+package chip8
+
+import (
+    "bytes"
+    "github.com/stretchr/testify/assert"
+    "io"
+    "strings"
+    "testing"
+)
+
+// LD V1, 5; ADD V1, 3; LD I, long 0x1234; CALL 0x20C; JP 0x20A; LD DT, V1; RET
+var traceROM = []byte{0x61, 0x05, 0x71, 0x03, 0xF0, 0x00, 0x12, 0x34, 0x22, 0x0C, 0x12, 0x0A, 0xF1, 0x15, 0x00, 0xEE}
+
+func TestTextTrace(t *testing.T) {
+    assert := assert.New(t)
+
+    var buf bytes.Buffer
+    machine, _ := NewXOChipMachine(traceROM)
+    tracer := NewTextTracer(&buf)
+    machine.SetTracer(tracer)
+    for k := 0; k < 5; k++ {
+        machine.Step()
+    }
+    assert.NoError(tracer.Flush())
+    lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+    assert.Equal([]string{
+        "       0 200: 6105  LD V1, 0x05            V1=05",
+        "       1 202: 7103  ADD V1, 0x03           V1=08",
+        "       2 204: F000  LD I, long 0x1234      I=1234",
+        "       3 208: 220C  CALL 0x20C             SP=1",
+        "       4 20C: F115  MV DT, V1              DT=08",
+    }, lines)
+}
+
+func TestTraceFilter(t *testing.T) {
+    assert := assert.New(t)
+
+    var buf bytes.Buffer
+    machine, _ := NewXOChipMachine(traceROM)
+    tracer := NewTextTracer(&buf)
+    tracer.SetFilter(TraceFilter{Ranges: []AddrRange{{0x202, 0x20B}}, Classes: ClassALU | ClassFlow})
+    machine.SetTracer(tracer)
+    for k := 0; k < 5; k++ {
+        machine.Step()
+    }
+    tracer.Flush()
+    lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+    assert.Len(lines, 2)
+    assert.True(strings.HasPrefix(lines[0], "       1 202: 7103"))
+    assert.True(strings.HasPrefix(lines[1], "       3 208: 220C"))
+
+    classes, err := ParseOpcodeClasses("flow, display")
+    assert.NoError(err)
+    assert.Equal(ClassFlow | ClassDisplay, classes)
+    _, err = ParseOpcodeClasses("jumps")
+    assert.Error(err)
+    assert.Equal(ClassDisplay, ClassOf(0x00FE))
+    assert.Equal(ClassOther, ClassOf(0x00FD))
+    assert.Equal(ClassMemory, ClassOf(0x5122))
+    assert.Equal(ClassTimer, ClassOf(0xF318))
+}
+
+func TestBinaryTraceRoundTrip(t *testing.T) {
+    assert := assert.New(t)
+
+    var text, data bytes.Buffer
+    machine, _ := NewXOChipMachine(traceROM)
+    textTracer := NewTextTracer(&text)
+    machine.SetTracer(textTracer)
+    for k := 0; k < 8; k++ {
+        machine.Step()
+    }
+    textTracer.Flush()
+
+    machine, _ = NewXOChipMachine(traceROM)
+    tracer, err := NewBinaryTracer(&data)
+    assert.NoError(err)
+    machine.SetTracer(tracer)
+    for k := 0; k < 8; k++ {
+        machine.Step()
+    }
+    assert.NoError(tracer.Flush())
+    // Far smaller than the text
+    assert.True(data.Len() * 4 < text.Len())
+
+    reader, err := NewTraceReader(&data)
+    assert.NoError(err)
+    var rendered bytes.Buffer
+    for {
+        entry, err := reader.Next()
+        if err == io.EOF {
+            break
+        }
+        assert.NoError(err)
+        rendered.WriteString(entry.String() + "\n")
+    }
+    assert.Equal(text.String(), rendered.String())
+
+    _, err = NewTraceReader(strings.NewReader("not a trace"))
+    assert.Equal(ErrNotTrace, err)
+}
@@ -0,0 +1,105 @@
+package chip8
+
+import (
+    "encoding/binary"
+    "io"
+)
+
+// Size of the RIFF header written before the samples
+const wavHeaderSize = 44
+
+// WAVRecorder captures the buzzer into a 16-bit mono PCM WAV file. Samples are written as
+// the machine runs frames, so the recording follows emulated rather than wall clock time.
+type WAVRecorder struct {
+    w       io.WriteSeeker
+    tone    *Tone // Nil while the buzzer is silent
+    samples int   // Samples written so far
+    owed    int   // Samples owed to the next frame, in 1/ticksPerSecond
+    buffer  []int16
+    err     error
+}
+
+// Start a recording. The header is completed by Close.
+func NewWAVRecorder(w io.WriteSeeker) (*WAVRecorder, error) {
+    r := &WAVRecorder{w: w}
+    if err := r.writeHeader(); err != nil {
+        return nil, err
+    }
+    return r, nil
+}
+
+func (r *WAVRecorder) StartTone(tone *Tone) {
+    r.tone = tone
+}
+
+func (r *WAVRecorder) StopTone() {
+    r.tone = nil
+}
+
+func (r *WAVRecorder) Release() {
+    // Noop
+}
+
+// Write the samples covering a frame of emulated time
+func (r *WAVRecorder) advance() {
+    if r.err != nil {
+        return
+    }
+    r.owed += SampleRate
+    n := r.owed / ticksPerSecond
+    r.owed %= ticksPerSecond
+
+    if cap(r.buffer) < n {
+        r.buffer = make([]int16, n)
+    }
+    buffer := r.buffer[:n]
+    if r.tone != nil {
+        r.tone.Fill(buffer, SampleRate)
+    } else {
+        for k := range buffer {
+            buffer[k] = 0
+        }
+    }
+    r.err = binary.Write(r.w, binary.LittleEndian, buffer)
+    r.samples += n
+}
+
+// Finish the header with the final sizes. Returns the first error hit while recording.
+func (r *WAVRecorder) Close() error {
+    if r.err != nil {
+        return r.err
+    }
+    if _, err := r.w.Seek(0, io.SeekStart); err != nil {
+        return err
+    }
+    if err := r.writeHeader(); err != nil {
+        return err
+    }
+    _, err := r.w.Seek(0, io.SeekEnd)
+    return err
+}
+
+func (r *WAVRecorder) writeHeader() error {
+    dataSize := uint32(2 * r.samples)
+    header := []interface{} {
+        []byte("RIFF"),
+        uint32(wavHeaderSize - 8) + dataSize,
+        []byte("WAVE"),
+        []byte("fmt "),
+        uint32(16),             // Format chunk size
+        uint16(1),              // PCM
+        uint16(1),              // Mono
+        uint32(SampleRate),
+        uint32(2 * SampleRate), // Byte rate
+        uint16(2),              // Block align
+        uint16(16),             // Bits per sample
+        []byte("data"),
+        dataSize,
+    }
+    for _, field := range header {
+        if err := binary.Write(r.w, binary.LittleEndian, field); err != nil {
+            return err
+        }
+    }
+    return nil
+}
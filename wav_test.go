@@ -0,0 +1,46 @@
+package chip8
+
+import (
+    "encoding/binary"
+    "github.com/stretchr/testify/assert"
+    "io/ioutil"
+    "os"
+    "testing"
+)
+
+func TestWAVRecorder(t *testing.T) {
+    assert := assert.New(t)
+
+    file, err := ioutil.TempFile("", "chip8")
+    assert.NoError(err)
+    defer os.Remove(file.Name())
+
+    // LD V0, 1; LD ST, V0; JP 0x204
+    machine, _ := NewMachine([]byte{0x60, 0x01, 0xF0, 0x18, 0x12, 0x04})
+    recorder, err := NewWAVRecorder(file)
+    assert.NoError(err)
+    machine.SetRecorder(recorder)
+
+    // 1/60 s frames at 44.1 kHz are 735 samples each
+    assert.NoError(machine.RunFrames(5))
+    assert.NoError(recorder.Close())
+    file.Close()
+
+    data, err := ioutil.ReadFile(file.Name())
+    assert.NoError(err)
+    samples := 3675
+    assert.Equal(wavHeaderSize + 2 * samples, len(data))
+    assert.Equal("RIFF", string(data[0:4]))
+    assert.Equal(uint32(wavHeaderSize - 8 + 2 * samples), binary.LittleEndian.Uint32(data[4:8]))
+    assert.Equal("data", string(data[36:40]))
+    assert.Equal(uint32(2 * samples), binary.LittleEndian.Uint32(data[40:44]))
+
+    // Buzzer sounds for the first frame only
+    sample := func(k int) int16 {
+        return int16(binary.LittleEndian.Uint16(data[wavHeaderSize + 2 * k:]))
+    }
+    assert.Equal(int16(amplitude), sample(0))
+    assert.Equal(int16(amplitude), sample(734))
+    assert.Equal(int16(0), sample(735))
+    assert.Equal(int16(0), sample(samples - 1))
+}
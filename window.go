@@ -6,8 +6,46 @@ type Window interface {
     Update()
     IsKeyPressed(key HexKey) bool
     WaitForKeyPress() HexKey
-    Draw(screen *[64][32]byte)
+    Draw(screen *Screen)
     Clear()
     ShouldClose() bool
     Release()
 }
+
+// Player's request to save or load a quick save slot
+type StateRequest struct {
+    Slot int  // Numbered from 1
+    Save bool // Save if true, load otherwise
+}
+
+// Implemented by windows with hotkeys for quick save slots
+type StateHotkeys interface {
+    // Requests made since the last call, oldest first
+    StateRequests() []StateRequest
+}
+
+// Implemented by windows with a key that runs the emulation backwards while held
+type RewindKey interface {
+    RewindHeld() bool
+}
+
+// Implemented by windows whose key bindings can be changed
+type Keymapped interface {
+    SetKeymap(keymap *Keymap)
+}
+
+// Implemented by windows with a mode for rebinding keys interactively
+type KeyRemapping interface {
+    // Keymap from a remap the player finished since the last call, or nil. The window
+    // already uses it.
+    RemappedKeys() *Keymap
+}
+
+// Keyboard characters for hex keys 0-F, laid out as the 1234/QWER/ASDF/ZXCV block
+//   1 2 3 C        1 2 3 4
+//   4 5 6 D   ->   Q W E R
+//   7 8 9 E        A S D F
+//   A 0 B F        Z X C V
+var keyLayout = [16]byte {
+    'x', '1', '2', '3', 'q', 'w', 'e', 'a', 's', 'd', 'z', 'c', '4', 'r', 'f', 'v',
+}